@@ -0,0 +1,1115 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/internal"
+	"github.com/vmihailenco/msgpack/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltDB struct {
+	db      *bolt.DB
+	option  *kvdb.Option
+	loadRec *internal.LoadRec
+	hub     *internal.Hub
+	close   chan struct{}
+	// mu is held by writes until they are reported to watchers, so that
+	// events are in the same order as writes.
+	mu sync.Mutex
+}
+
+// NewDB create a KVDB instance with BoltDB file, keys of the same level of the
+// key tree are stored in the same bucket.
+func NewDB(path string, opts ...kvdb.DBOption) (kvdb.KVDB, error) {
+	o := kvdb.InitOption()
+	for _, opt := range opts {
+		opt(o)
+	}
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	v := boltDB{
+		db:      db,
+		option:  o,
+		loadRec: internal.DefaultLoadRec(),
+		hub:     internal.NewHub(o),
+		close:   make(chan struct{}),
+	}
+	if o.AutoClean {
+		go v.loadRec.StartClean(func() {
+			if err := v.Cleanup(); err != nil {
+				log.Println("cleanup error when auto clean", err)
+			}
+		}, v.close)
+	}
+	return &v, nil
+}
+
+type boltNode struct {
+	Value    string    `msgpack:"value"`
+	ExpireAt time.Time `msgpack:"expire_at,omitempty"`
+	Version  int64     `msgpack:"version,omitempty"`
+}
+
+func (b *boltDB) Get(key string, opts ...kvdb.GetOption,
+) (*kvdb.Node, error) {
+	return b.GetContext(context.Background(), key, opts...)
+}
+
+func (b *boltDB) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	if gt.Children && gt.Limit == 0 {
+		gt.Limit = b.option.DefaultLimit
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var (
+		node       *kvdb.Node
+		deleteKeys []string
+	)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, deleteKeys, err = b.get(ctx, tx, key, now, &gt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(deleteKeys) > 0 {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			return b.deleteExpired(ctx, tx, deleteKeys, now)
+		})
+	}
+	return node, err
+}
+
+func (b *boltDB) GetMulti(keys []string, opts ...kvdb.GetOption,
+) (map[string]kvdb.Node, error) {
+	return b.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (b *boltDB) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	if gt.Children && gt.Limit == 0 {
+		gt.Limit = b.option.DefaultLimit
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var (
+		v          = make(map[string]kvdb.Node, len(keys))
+		deleteKeys []string
+	)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		for i := range keys {
+			node, dks, err := b.get(ctx, tx, keys[i], now, &gt)
+			if err != nil {
+				return err
+			}
+			if node != nil {
+				v[keys[i]] = *node
+			}
+			deleteKeys = append(deleteKeys, dks...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(deleteKeys) > 0 {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			return b.deleteExpired(ctx, tx, deleteKeys, now)
+		})
+	}
+	return v, err
+}
+
+func (b *boltDB) GetBytes(key string) ([]byte, error) {
+	return b.GetBytesContext(context.Background(), key)
+}
+
+func (b *boltDB) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	node, err := b.GetContext(ctx, key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+func (b *boltDB) get(ctx context.Context, tx *bolt.Tx, key string,
+	now time.Time, gt *kvdb.Getter) (*kvdb.Node, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	bucket := tx.Bucket(b.bucket(b.level(key)))
+	if bucket == nil {
+		return nil, nil, nil
+	}
+	v := bucket.Get(b.mask(key))
+	if v == nil {
+		return nil, nil, nil
+	}
+	var deleteKeys []string
+	retrive := func(key string, data []byte) (*boltNode, error) {
+		n, err := b.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if !n.ExpireAt.IsZero() && !n.ExpireAt.After(now) {
+			if b.option.AutoClean {
+				deleteKeys = append(deleteKeys, key)
+			}
+			return nil, nil
+		}
+		return n, nil
+	}
+	n, err := retrive(key, v)
+	if err != nil {
+		return nil, nil, err
+	} else if n == nil {
+		return nil, nil, nil
+	}
+	node := kvdb.Node{
+		Value:   n.Value,
+		Version: n.Version,
+	}
+
+	isBareStartKey := b.option.IsBareKey(gt.Start)
+	parentStartKey := b.option.ParentKey(gt.Start)
+	if gt.Children && (isBareStartKey || parentStartKey == key) {
+		var kvs []kvdb.KV
+		if bucket := tx.Bucket(b.bucket(b.level(key) + 1)); bucket != nil {
+			prefix := b.childPrefix(key)
+			lower, upper := internal.ChildBounds(b.option, key, gt)
+			lowerKey := b.mask(lower)
+			var upperKey []byte
+			if upper != "" {
+				upperKey = b.mask(upper)
+			}
+			inRange := func(k []byte) bool {
+				return k != nil && bytes.HasPrefix(k, prefix) &&
+					bytes.Compare(k, lowerKey) > 0 &&
+					(upperKey == nil || bytes.Compare(k, upperKey) < 0)
+			}
+			c := bucket.Cursor()
+			move := c.Next
+			var k, v []byte
+			if gt.Reverse {
+				move = c.Prev
+				// seek to the first key not less than upper bound then move
+				// back, or the last key if there is no such key
+				seek := upperKey
+				if seek == nil {
+					seek = nextBytes(prefix)
+				}
+				if k, _ = c.Seek(seek); k == nil {
+					k, v = c.Last()
+				} else {
+					k, v = c.Prev()
+				}
+			} else {
+				k, v = c.Seek(lowerKey)
+				if bytes.Equal(k, lowerKey) {
+					k, v = c.Next()
+				}
+			}
+			for ; inRange(k); k, v = move() {
+				if err := ctx.Err(); err != nil {
+					return nil, nil, err
+				}
+				ck := b.unmask(k)
+				n, err := retrive(ck, v)
+				if err != nil {
+					return nil, nil, err
+				} else if n == nil {
+					continue
+				}
+				kvs = append(kvs, kvdb.KV{Key: ck, Value: n.Value})
+				// one more child to tell if has more
+				if gt.Limit > 0 && len(kvs) > gt.Limit {
+					break
+				}
+			}
+		}
+		internal.FillChildren(&node, kvs, gt.Limit)
+	}
+	if gt.Descendants {
+		// scan level by level, stop when no key exists at current level since
+		// deeper keys are unreachable
+		flat := make(map[string]string)
+		prefix := b.childPrefix(key)
+		for depth := 1; gt.Depth <= 0 || depth <= gt.Depth; depth++ {
+			bucket := tx.Bucket(b.bucket(b.level(key) + depth))
+			if bucket == nil {
+				break
+			}
+			var found bool
+			c := bucket.Cursor()
+			k, v := c.Seek(prefix)
+			for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				if err := ctx.Err(); err != nil {
+					return nil, nil, err
+				}
+				found = true
+				dk := b.unmask(k)
+				n, err := retrive(dk, v)
+				if err != nil {
+					return nil, nil, err
+				} else if n != nil {
+					flat[dk] = n.Value
+				}
+			}
+			if !found {
+				break
+			}
+		}
+		node.Descendants = internal.BuildDescendants(b.option, key, flat)
+	}
+	return &node, deleteKeys, nil
+}
+
+func (b *boltDB) Set(key, value string, opts ...kvdb.SetOption) error {
+	return b.SetContext(context.Background(), key, value, opts...)
+}
+
+func (b *boltDB) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if !st.IfVersion {
+		return b.SetMultiContext(ctx, []string{key, value}, opts...)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	ok, err := b.modify(key, now, func(n *boltNode) *boltNode {
+		if n.version() != st.Version {
+			return nil
+		}
+		return &boltNode{
+			Value:    value,
+			ExpireAt: internal.ExpireTime(&st, now),
+			Version:  n.version() + 1,
+		}
+	})
+	if err == nil && !ok {
+		return &kvdb.ConflictError{Key: key, Version: st.Version}
+	}
+	return err
+}
+
+func (b *boltDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return b.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (b *boltDB) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	entries, err := internal.Entries(kvPairs,
+		internal.ExpireTime(&st, time.Now()))
+	if err != nil {
+		return err
+	}
+	return b.SetEntriesContext(ctx, entries)
+}
+
+func (b *boltDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return b.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (b *boltDB) SetBytesContext(ctx context.Context, key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return b.SetContext(ctx, key, string(value), opts...)
+}
+
+func (b *boltDB) SetEntries(entries []kvdb.Entry) error {
+	return b.SetEntriesContext(context.Background(), entries)
+}
+
+func (b *boltDB) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			if err := b.put(tx, e, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.hub.SetEntries(entries)
+	return nil
+}
+
+// put write entry with version increased from live node.
+func (b *boltDB) put(tx *bolt.Tx, e kvdb.Entry, now time.Time) error {
+	n, err := b.live(tx, e.Key, now)
+	if err != nil {
+		return err
+	}
+	return b.write(tx, e.Key, &boltNode{
+		Value:    e.Value,
+		ExpireAt: e.ExpireAt,
+		Version:  n.version() + 1,
+	})
+}
+
+func (b *boltDB) write(tx *bolt.Tx, key string, n *boltNode) error {
+	v, err := b.encode(n)
+	if err != nil {
+		return err
+	}
+	bucket, err := tx.CreateBucketIfNotExists(b.bucket(b.level(key)))
+	if err != nil {
+		return err
+	}
+	return bucket.Put(b.mask(key), v)
+}
+
+// live returns live node of key, nil if key is not exist or expired.
+func (b *boltDB) live(tx *bolt.Tx, key string, now time.Time,
+) (*boltNode, error) {
+	bucket := tx.Bucket(b.bucket(b.level(key)))
+	if bucket == nil {
+		return nil, nil
+	}
+	data := bucket.Get(b.mask(key))
+	if data == nil {
+		return nil, nil
+	}
+	n, err := b.decode(data)
+	if err != nil || (!n.ExpireAt.IsZero() && !n.ExpireAt.After(now)) {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (b *boltDB) Commit(txn *kvdb.Txn) (bool, error) {
+	return b.CommitContext(context.Background(), txn)
+}
+
+func (b *boltDB) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn == nil {
+		return true, nil
+	}
+	if err := internal.CheckTxn(txn); err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ok bool
+	deleted := make([]bool, len(txn.Ops))
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		ok, err = internal.CondsHold(txn.Conds, func(key string,
+		) (string, bool, error) {
+			n, err := b.live(tx, key, now)
+			if err != nil || n == nil {
+				return "", false, err
+			}
+			return n.Value, true, nil
+		})
+		if err != nil || !ok {
+			return err
+		}
+		for i, op := range txn.Ops {
+			switch op.Type {
+			case kvdb.OpSet:
+				err = b.put(tx, kvdb.Entry{
+					Key:      op.Key,
+					Value:    op.Value,
+					ExpireAt: internal.ExpireTime(&op.Setter, now),
+				}, now)
+			case kvdb.OpDelete:
+				var dels []bool
+				dels, err = b.deleteMulti(ctx, tx, []string{op.Key},
+					&op.Deleter)
+				if err == nil {
+					deleted[i] = dels[0]
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	b.hub.Commit(txn, deleted, now)
+	return true, nil
+}
+
+func (b *boltDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return b.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (b *boltDB) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	return b.modify(key, now, func(n *boltNode) *boltNode {
+		if n != nil {
+			return nil
+		}
+		return &boltNode{
+			Value:    value,
+			ExpireAt: internal.ExpireTime(&st, now),
+			Version:  1,
+		}
+	})
+}
+
+func (b *boltDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return b.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (b *boltDB) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	return b.modify(key, now, func(n *boltNode) *boltNode {
+		if n == nil || n.Value != old {
+			return nil
+		}
+		return &boltNode{
+			Value:    new,
+			ExpireAt: internal.ExpireTime(&st, now),
+			Version:  n.Version + 1,
+		}
+	})
+}
+
+func (b *boltDB) Incr(key string, delta int64) (int64, error) {
+	return b.IncrContext(context.Background(), key, delta)
+}
+
+func (b *boltDB) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var (
+		rst int64
+		err error
+	)
+	_, merr := b.modify(key, now, func(n *boltNode) *boltNode {
+		if n == nil {
+			n = &boltNode{Value: "0"}
+		}
+		if rst, err = internal.Incr(n.Value, delta); err != nil {
+			return nil
+		}
+		return &boltNode{
+			Value:    strconv.FormatInt(rst, 10),
+			ExpireAt: n.ExpireAt,
+			Version:  n.Version + 1,
+		}
+	})
+	if merr != nil {
+		return 0, merr
+	}
+	return rst, err
+}
+
+// modify read live node of key and write node returned by fn in one
+// transaction, and returns if node is written.
+// Node passed to fn is nil if key is not exist or expired, and nothing is
+// written if fn returns nil. Written node is reported to watchers as set if
+// version is changed, otherwise only expire time is changed.
+func (b *boltDB) modify(key string, now time.Time,
+	fn func(n *boltNode) *boltNode) (bool, error) {
+	var (
+		written *boltNode
+		version int64
+	)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		n, err := b.live(tx, key, now)
+		if err != nil {
+			return err
+		}
+		version = n.version()
+		if n = fn(n); n == nil {
+			return nil
+		}
+		written = n
+		return b.write(tx, key, n)
+	})
+	if err != nil || written == nil {
+		return false, err
+	}
+	if written.Version != version {
+		b.hub.Set(key, written.Value, written.ExpireAt)
+	} else {
+		b.hub.Expire(key, written.ExpireAt)
+	}
+	return true, nil
+}
+
+func (b *boltDB) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return b.DeleteContext(context.Background(), key, opts...)
+}
+
+func (b *boltDB) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	return b.DeleteMultiContext(ctx, []string{key}, opts...)
+}
+
+func (b *boltDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return b.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (b *boltDB) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
+	var dt kvdb.Deleter
+	for _, opt := range opts {
+		opt(&dt)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var deleted []bool
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		deleted, err = b.deleteMulti(ctx, tx, keys, &dt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if deleted[i] {
+			b.hub.Delete(key, &dt)
+		}
+	}
+	return nil
+}
+
+// deleteMulti returns if key or any of it's children or descendants specified
+// by dt is deleted for each key.
+func (b *boltDB) deleteMulti(ctx context.Context, tx *bolt.Tx, keys []string,
+	dt *kvdb.Deleter) ([]bool, error) {
+	deleted := make([]bool, len(keys))
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		level := b.level(key)
+		if bucket := tx.Bucket(b.bucket(level)); bucket != nil &&
+			bucket.Get(b.mask(key)) != nil {
+			if err := bucket.Delete(b.mask(key)); err != nil {
+				return nil, err
+			}
+			deleted[i] = true
+		}
+		if dt == nil || (!dt.Children && !dt.Descendants) {
+			continue
+		}
+		if !dt.Descendants {
+			bucket := tx.Bucket(b.bucket(level + 1))
+			if bucket == nil {
+				continue
+			}
+			n, err := b.deletePrefix(bucket, b.childPrefix(key))
+			if err != nil {
+				return nil, err
+			}
+			deleted[i] = deleted[i] || n > 0
+			continue
+		}
+		err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			lv, err := strconv.Atoi(string(name[len("level:"):]))
+			if err != nil || lv <= level {
+				return err
+			}
+			n, err := b.deletePrefix(bucket, b.childPrefix(key))
+			deleted[i] = deleted[i] || n > 0
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteExpired delete keys which are still expired at now, keys found expired
+// by a read transaction may be set again before this is called.
+func (b *boltDB) deleteExpired(ctx context.Context, tx *bolt.Tx,
+	keys []string, now time.Time) error {
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bucket := tx.Bucket(b.bucket(b.level(key)))
+		if bucket == nil {
+			continue
+		}
+		v := bucket.Get(b.mask(key))
+		if v == nil {
+			continue
+		}
+		expired, err := b.expired(v, now)
+		if err != nil {
+			return err
+		}
+		if !expired {
+			continue
+		}
+		if err := bucket.Delete(b.mask(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePrefix delete keys with prefix in bucket, and returns number of
+// deleted keys.
+func (*boltDB) deletePrefix(bucket *bolt.Bucket, prefix []byte,
+) (int, error) {
+	var keys [][]byte
+	c := bucket.Cursor()
+	k, _ := c.Seek(prefix)
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+func (b *boltDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return b.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (b *boltDB) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	if limit == 0 {
+		limit = b.option.DefaultLimit
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var keys []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket(b.level(parent) + 1))
+		if bucket == nil {
+			return nil
+		}
+		prefix := b.childPrefix(parent)
+		lower, _ := internal.ChildBounds(b.option, parent,
+			&kvdb.Getter{Start: start})
+		lowerKey := b.mask(lower)
+		c := bucket.Cursor()
+		k, v := c.Seek(lowerKey)
+		if bytes.Equal(k, lowerKey) {
+			k, v = c.Next()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			expired, err := b.expired(v, now)
+			if err != nil {
+				return err
+			} else if expired {
+				continue
+			}
+			keys = append(keys, b.unmask(k))
+			if limit > 0 && len(keys) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ls.BareKey {
+		keys = internal.BareKeys(b.option, keys)
+	}
+	return keys, nil
+}
+
+func (b *boltDB) Exist(key string) (bool, error) {
+	return b.ExistContext(context.Background(), key)
+}
+
+func (b *boltDB) ExistContext(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var has bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		has, err = b.exist(tx, key, now)
+		return err
+	})
+	return has, err
+}
+
+func (b *boltDB) ExistMulti(keys []string) (map[string]bool, error) {
+	return b.ExistMultiContext(context.Background(), keys)
+}
+
+func (b *boltDB) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	now := time.Now()
+	defer b.hookReq(now)
+	v := make(map[string]bool, len(keys))
+	err := b.db.View(func(tx *bolt.Tx) error {
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			has, err := b.exist(tx, key, now)
+			if err != nil {
+				return err
+			}
+			v[key] = has
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (b *boltDB) exist(tx *bolt.Tx, key string, now time.Time) (bool, error) {
+	bucket := tx.Bucket(b.bucket(b.level(key)))
+	if bucket == nil {
+		return false, nil
+	}
+	data := bucket.Get(b.mask(key))
+	if data == nil {
+		return false, nil
+	}
+	expired, err := b.expired(data, now)
+	return !expired, err
+}
+
+func (b *boltDB) ExpireAt(key string) (time.Time, bool, error) {
+	return b.ExpireAtContext(context.Background(), key)
+}
+
+func (b *boltDB) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var (
+		at    time.Time
+		exist bool
+	)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket(b.level(key)))
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get(b.mask(key))
+		if data == nil {
+			return nil
+		}
+		var err error
+		if at, err = b.expireAt(data); err != nil {
+			return err
+		}
+		exist = at.IsZero() || at.After(now)
+		return nil
+	})
+	if err != nil || !exist {
+		return time.Time{}, false, err
+	}
+	return at, true, nil
+}
+
+func (b *boltDB) Touch(key string, ttl time.Duration) (bool, error) {
+	return b.TouchContext(context.Background(), key, ttl)
+}
+
+func (b *boltDB) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	return b.modify(key, now, func(n *boltNode) *boltNode {
+		if n != nil {
+			n.ExpireAt = now.Add(ttl)
+		}
+		return n
+	})
+}
+
+func (b *boltDB) Persist(key string) (bool, error) {
+	return b.PersistContext(context.Background(), key)
+}
+
+func (b *boltDB) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	return b.modify(key, now, func(n *boltNode) *boltNode {
+		if n != nil {
+			n.ExpireAt = time.Time{}
+		}
+		return n
+	})
+}
+
+func (b *boltDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return b.CountContext(context.Background(), key, opts...)
+}
+
+func (b *boltDB) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	defer b.hookReq(now)
+	var count int
+	level := b.level(key)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			lv, err := strconv.Atoi(string(name[len("level:"):]))
+			if err != nil || lv <= level || (!ct.Descendants && lv > level+1) {
+				return err
+			}
+			prefix := b.childPrefix(key)
+			c := bucket.Cursor()
+			k, v := c.Seek(prefix)
+			for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				expired, err := b.expired(v, now)
+				if err != nil {
+					return err
+				} else if !expired {
+					count++
+				}
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+func (b *boltDB) Cleanup() error {
+	return b.CleanupContext(context.Background())
+}
+
+func (b *boltDB) CleanupContext(ctx context.Context) error {
+	now := time.Now()
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			var expiredKeys [][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				node, err := b.decode(v)
+				if err != nil {
+					return err
+				}
+				if !node.ExpireAt.IsZero() && !node.ExpireAt.After(now) {
+					expiredKeys = append(expiredKeys, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expiredKeys {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (b *boltDB) Watch(key string, recursive bool,
+) (<-chan kvdb.Event, error) {
+	return b.WatchContext(context.Background(), key, recursive)
+}
+
+func (b *boltDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	return b.hub.Watch(ctx, key, recursive)
+}
+
+func (b *boltDB) Close() error {
+	close(b.close)
+	b.hub.Close()
+	return b.db.Close()
+}
+
+func (b *boltDB) hookReq(start time.Time) {
+	if b.option.AutoClean {
+		b.loadRec.HookReq(int64(time.Since(start)))
+	}
+}
+
+func (*boltDB) encode(node *boltNode) ([]byte, error) {
+	return msgpack.Marshal(node)
+}
+
+// version returns version of node, 0 for nil node.
+func (n *boltNode) version() int64 {
+	if n == nil {
+		return 0
+	}
+	return n.Version
+}
+
+func (*boltDB) decode(data []byte) (*boltNode, error) {
+	var node boltNode
+	err := msgpack.Unmarshal(data, &node)
+	return &node, err
+}
+
+// expireAt decode only expire time of data, which skips value.
+func (*boltDB) expireAt(data []byte) (time.Time, error) {
+	var node struct {
+		ExpireAt time.Time `msgpack:"expire_at,omitempty"`
+	}
+	err := msgpack.Unmarshal(data, &node)
+	return node.ExpireAt, err
+}
+
+func (b *boltDB) expired(data []byte, now time.Time) (bool, error) {
+	at, err := b.expireAt(data)
+	return !at.IsZero() && !at.After(now), err
+}
+
+// level returns level of key in key tree, start from 1.
+func (b *boltDB) level(key string) int {
+	return strings.Count(key, b.option.KeyPathSep) + 1
+}
+
+// bucket returns name of bucket which stores keys of level.
+func (*boltDB) bucket(level int) []byte {
+	return []byte("level:" + strconv.Itoa(level))
+}
+
+// mask returns key stored in bucket, since BoltDB does not accept blank key.
+func (*boltDB) mask(key string) []byte {
+	return []byte("node:" + key)
+}
+
+func (*boltDB) unmask(key []byte) string {
+	return string(key[len("node:"):])
+}
+
+// childPrefix returns common prefix of stored keys of children.
+func (b *boltDB) childPrefix(key string) []byte {
+	return b.mask(key + b.option.KeyPathSep)
+}
+
+// nextBytes returns the smallest key greater than all keys with prefix.
+func nextBytes(prefix []byte) []byte {
+	next := append([]byte{}, prefix...)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] < 0xff {
+			next[i]++
+			return next[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package bolt
+
+import (
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCleanup(t *testing.T) {
+	db, err := NewDB("bolt.db")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	bdb, ok := db.(*boltDB)
+	if !ok {
+		t.Error("failed covert KVDB to BoltDB instance")
+		t.Fail()
+	}
+
+	keys := []string{"inner.c", "inner.c.child1"}
+	// check raw data since Exist ignores expired key
+	rawHas := func(key string) (bool, error) {
+		var has bool
+		err := bdb.db.View(func(tx *bolt.Tx) error {
+			if bucket := tx.Bucket(bdb.bucket(bdb.level(key))); bucket != nil {
+				has = bucket.Get(bdb.mask(key)) != nil
+			}
+			return nil
+		})
+		return has, err
+	}
+
+	now := time.Now()
+	for i, key := range keys {
+		if i == 1 {
+			now = time.Now().Add(time.Minute)
+		}
+		v, err := bdb.encode(&boltNode{Value: "test", ExpireAt: now})
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		err = bdb.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(
+				bdb.bucket(bdb.level(key)),
+			)
+			if err != nil {
+				return err
+			}
+			return bucket.Put(bdb.mask(key), v)
+		})
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+
+		has, err := rawHas(key)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if !has {
+			t.Errorf("key not exist")
+			t.Fail()
+		}
+	}
+
+	err = bdb.Cleanup()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	for i, key := range keys {
+		has, err := rawHas(key)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if has && i == 0 {
+			t.Errorf("key %s exist", key)
+			t.Fail()
+		} else if !has && i == 1 {
+			t.Errorf("key %s not exist", key)
+			t.Fail()
+		}
+	}
+}
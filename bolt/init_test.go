@@ -0,0 +1,13 @@
+package bolt_test
+
+import (
+	"os"
+)
+
+const url = "bolt.db"
+
+func init() {
+	if err := os.RemoveAll(url); err != nil {
+		panic(err)
+	}
+}
@@ -3,11 +3,17 @@ module github.com/elvinchan/kvdb
 go 1.13
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.5
 	github.com/elvinchan/util-collects v0.0.0-20210329102533-f6c51a70c742
+	github.com/go-redis/redis/v8 v8.11.0
+	github.com/golang/protobuf v1.4.3
 	github.com/syndtr/goleveldb v1.0.0
 	github.com/vmihailenco/msgpack/v5 v5.3.4
+	go.etcd.io/bbolt v1.3.6
 	go.mongodb.org/mongo-driver v1.6.0
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
+	google.golang.org/grpc v1.34.0
+	google.golang.org/protobuf v1.25.0
 	gorm.io/driver/mysql v1.1.0
 	gorm.io/driver/postgres v1.1.0
 	gorm.io/driver/sqlite v1.1.4
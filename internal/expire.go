@@ -0,0 +1,16 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+// ExpireTime returns expire time of setter, relative TTL takes precedence over
+// absolute expire time. Zero time means never expire.
+func ExpireTime(st *kvdb.Setter, now time.Time) time.Time {
+	if st.TTL > 0 {
+		return now.Add(st.TTL)
+	}
+	return st.ExpireAt
+}
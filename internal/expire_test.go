@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+func TestExpireTime(t *testing.T) {
+	now := time.Now()
+	at := now.Add(time.Minute)
+	cases := []struct {
+		Setter kvdb.Setter
+		Expect time.Time
+	}{
+		{kvdb.Setter{}, time.Time{}},
+		{kvdb.Setter{ExpireAt: at}, at},
+		{kvdb.Setter{TTL: time.Hour}, now.Add(time.Hour)},
+		{kvdb.Setter{ExpireAt: at, TTL: time.Hour}, now.Add(time.Hour)},
+	}
+	for i, c := range cases {
+		rst := ExpireTime(&c.Setter, now)
+		if !rst.Equal(c.Expect) {
+			t.Errorf("expire time of case %d not right, expect %v, got %v",
+				i, c.Expect, rst)
+			t.Fail()
+		}
+	}
+}
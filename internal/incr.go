@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/elvinchan/kvdb"
+)
+
+// Incr parse value as a decimal integer and returns it increased by delta,
+// kvdb.ErrorNotInteger is returned if value is not an integer, and
+// kvdb.ErrorOverflow is returned if result overflows int64.
+func Incr(value string, delta int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, kvdb.ErrorNotInteger
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) ||
+		(delta < 0 && n < math.MinInt64-delta) {
+		return 0, kvdb.ErrorOverflow
+	}
+	return n + delta, nil
+}
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/elvinchan/kvdb"
+)
+
+func TestIncr(t *testing.T) {
+	cases := []struct {
+		Value  string
+		Delta  int64
+		Expect int64
+		Err    error
+	}{
+		{"0", 1, 1, nil},
+		{"10", -3, 7, nil},
+		{"-1", 0, -1, nil},
+		{"", 1, 0, kvdb.ErrorNotInteger},
+		{"1.5", 1, 0, kvdb.ErrorNotInteger},
+		{"a", 1, 0, kvdb.ErrorNotInteger},
+		{strconv.FormatInt(math.MaxInt64-1, 10), 1, math.MaxInt64, nil},
+		{strconv.FormatInt(math.MaxInt64, 10), 1, 0, kvdb.ErrorOverflow},
+		{"1", math.MaxInt64, 0, kvdb.ErrorOverflow},
+		{strconv.FormatInt(math.MinInt64+1, 10), -1, math.MinInt64, nil},
+		{strconv.FormatInt(math.MinInt64, 10), -1, 0, kvdb.ErrorOverflow},
+		{"-2", math.MinInt64, 0, kvdb.ErrorOverflow},
+	}
+	for i, c := range cases {
+		rst, err := Incr(c.Value, c.Delta)
+		if err != c.Err || rst != c.Expect {
+			t.Errorf("result of case %d not right, expect %d %v, got %d %v",
+				i, c.Expect, c.Err, rst, err)
+			t.Fail()
+		}
+	}
+}
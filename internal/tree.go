@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"strings"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+// InDepth returns if key is a descendant of parentKey within depth, depth <= 0
+// means unlimited.
+func InDepth(o *kvdb.Option, key, parentKey string, depth int) bool {
+	prefix := parentKey + o.KeyPathSep
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+	return depth <= 0 || strings.Count(key[len(prefix):], o.KeyPathSep) < depth
+}
+
+// BuildDescendants build nested nodes of key from flat key value pairs of it's
+// descendants, pairs without existing parent key are dropped.
+func BuildDescendants(o *kvdb.Option, key string, flat map[string]string,
+) map[string]kvdb.Node {
+	childKeys := make(map[string][]string)
+	for k := range flat {
+		if k == key {
+			continue
+		}
+		pk := o.ParentKey(k)
+		childKeys[pk] = append(childKeys[pk], k)
+	}
+	var build func(key string) map[string]kvdb.Node
+	build = func(key string) map[string]kvdb.Node {
+		v := make(map[string]kvdb.Node, len(childKeys[key]))
+		for _, k := range childKeys[key] {
+			node := kvdb.Node{
+				Value: flat[k],
+			}
+			if len(childKeys[k]) > 0 {
+				node.Descendants = build(k)
+			}
+			v[k] = node
+		}
+		return v
+	}
+	return build(key)
+}
+
+// FillChildren fill children of node by key value pairs ordered in the
+// direction of pagination, which should contain at most limit + 1 pairs to tell
+// if there are more children.
+func FillChildren(node *kvdb.Node, kvs []kvdb.KV, limit int) {
+	if limit > 0 && len(kvs) > limit {
+		kvs = kvs[:limit]
+		node.HasMore = true
+		node.Next = kvs[limit-1].Key
+	}
+	node.ChildList = kvs
+	node.Children = make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		node.Children[kv.Key] = kv.Value
+	}
+}
+
+// ChildBounds returns exclusive lower and upper bounds of children keys of key
+// for pagination of getter, upper is empty if there is no upper bound.
+// Start is the upper bound when paginate in reverse order.
+func ChildBounds(o *kvdb.Option, key string, gt *kvdb.Getter,
+) (lower, upper string) {
+	start, end := gt.Start, gt.End
+	if gt.Reverse {
+		start, end = end, start
+	}
+	lower = o.FullKey(o.BareKey(start), key)
+	if end != "" {
+		upper = o.FullKey(o.BareKey(end), key)
+	}
+	return lower, upper
+}
+
+// BareKeys replace keys by bare keys in place.
+func BareKeys(o *kvdb.Option, keys []string) []string {
+	for i := range keys {
+		keys[i] = o.BareKey(keys[i])
+	}
+	return keys
+}
+
+// Entries convert key value pairs to entries with the same expire time.
+func Entries(kvPairs []string, expireAt time.Time) ([]kvdb.Entry, error) {
+	if len(kvPairs)%2 != 0 {
+		return nil, kvdb.ErrorKeyValuePairs
+	}
+	entries := make([]kvdb.Entry, len(kvPairs)/2)
+	for i := range entries {
+		entries[i] = kvdb.Entry{
+			Key:      kvPairs[i*2],
+			Value:    kvPairs[i*2+1],
+			ExpireAt: expireAt,
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+func TestInDepth(t *testing.T) {
+	o := kvdb.InitOption()
+	cases := []struct {
+		Key, ParentKey string
+		Depth          int
+		Expect         bool
+	}{
+		{"a.b", "a", 1, true},
+		{"a.b.c", "a", 1, false},
+		{"a.b.c", "a", 2, true},
+		{"a.b.c.d", "a", 0, true},
+		{"a.b.c.d", "a", -1, true},
+		{"ab.c", "a", 0, false},
+		{"a", "a", 0, false},
+	}
+	for _, c := range cases {
+		rst := InDepth(o, c.Key, c.ParentKey, c.Depth)
+		if rst != c.Expect {
+			t.Errorf("InDepth(%s, %s, %d) not right, expect %v, got %v",
+				c.Key, c.ParentKey, c.Depth, c.Expect, rst)
+			t.Fail()
+		}
+	}
+}
+
+func TestBuildDescendants(t *testing.T) {
+	o := kvdb.InitOption()
+	v := BuildDescendants(o, "a", map[string]string{
+		"a.b1":      "1",
+		"a.b2":      "2",
+		"a.b1.c1":   "3",
+		"a.b1.c1.d": "4",
+		"a.b3.c2":   "5", // parent absent
+	})
+	if len(v) != 2 {
+		t.Errorf("length of descendants not right, expect %d, got %d", 2, len(v))
+		t.FailNow()
+	}
+	if v["a.b1"].Value != "1" || v["a.b2"].Value != "2" {
+		t.Errorf("value not right, got %v", v)
+		t.Fail()
+	}
+	if v["a.b2"].Descendants != nil {
+		t.Errorf("descendants not right, expect nil")
+		t.Fail()
+	}
+	c1, ok := v["a.b1"].Descendants["a.b1.c1"]
+	if !ok || c1.Value != "3" {
+		t.Errorf("value not right, expect %s, got %s", "3", c1.Value)
+		t.Fail()
+	}
+	if c1.Descendants["a.b1.c1.d"].Value != "4" {
+		t.Errorf("value not right, expect %s, got %s",
+			"4", c1.Descendants["a.b1.c1.d"].Value)
+		t.Fail()
+	}
+}
+
+func TestFillChildren(t *testing.T) {
+	kvs := []kvdb.KV{
+		{Key: "a.b1", Value: "1"},
+		{Key: "a.b2", Value: "2"},
+		{Key: "a.b3", Value: "3"},
+	}
+	cases := []struct {
+		Limit   int
+		Length  int
+		HasMore bool
+		Next    string
+	}{
+		{-1, 3, false, ""},
+		{2, 2, true, "a.b2"},
+		{3, 3, false, ""},
+		{4, 3, false, ""},
+	}
+	for _, c := range cases {
+		var node kvdb.Node
+		FillChildren(&node, append([]kvdb.KV(nil), kvs...), c.Limit)
+		if len(node.ChildList) != c.Length || len(node.Children) != c.Length {
+			t.Errorf("length of children not right, expect %d, got %d and %d",
+				c.Length, len(node.ChildList), len(node.Children))
+			t.Fail()
+		}
+		if node.HasMore != c.HasMore || node.Next != c.Next {
+			t.Errorf("pagination not right, expect %v %s, got %v %s",
+				c.HasMore, c.Next, node.HasMore, node.Next)
+			t.Fail()
+		}
+		for i, kv := range node.ChildList {
+			if kv != kvs[i] || node.Children[kv.Key] != kv.Value {
+				t.Errorf("child not right, expect %v, got %v", kvs[i], kv)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestChildBounds(t *testing.T) {
+	o := kvdb.InitOption()
+	cases := []struct {
+		Getter       kvdb.Getter
+		Lower, Upper string
+	}{
+		{kvdb.Getter{}, "a.", ""},
+		{kvdb.Getter{Start: "b1"}, "a.b1", ""},
+		{kvdb.Getter{Start: "a.b1", End: "b3"}, "a.b1", "a.b3"},
+		{kvdb.Getter{Reverse: true}, "a.", ""},
+		{kvdb.Getter{Start: "a.b3", Reverse: true}, "a.", "a.b3"},
+		{kvdb.Getter{Start: "b3", End: "a.b1", Reverse: true}, "a.b1", "a.b3"},
+	}
+	for i, c := range cases {
+		lower, upper := ChildBounds(o, "a", &c.Getter)
+		if lower != c.Lower || upper != c.Upper {
+			t.Errorf("bounds of case %d not right, expect (%s, %s), got (%s, %s)",
+				i, c.Lower, c.Upper, lower, upper)
+			t.Fail()
+		}
+	}
+}
+
+func TestBareKeys(t *testing.T) {
+	o := kvdb.InitOption()
+	keys := BareKeys(o, []string{"a.b1", "a.b2.c1", "d"})
+	expect := []string{"b1", "c1", "d"}
+	if !reflect.DeepEqual(keys, expect) {
+		t.Errorf("bare keys not right, expect %v, got %v", expect, keys)
+		t.Fail()
+	}
+}
+
+func TestEntries(t *testing.T) {
+	at := time.Now()
+	entries, err := Entries([]string{"a", "1", "b", "2"}, at)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	expect := []kvdb.Entry{
+		{Key: "a", Value: "1", ExpireAt: at},
+		{Key: "b", Value: "2", ExpireAt: at},
+	}
+	if !reflect.DeepEqual(entries, expect) {
+		t.Errorf("entries not right, expect %v, got %v", expect, entries)
+		t.Fail()
+	}
+	if _, err = Entries([]string{"a"}, at); err != kvdb.ErrorKeyValuePairs {
+		t.Errorf("error not right, expect %v, got %v",
+			kvdb.ErrorKeyValuePairs, err)
+		t.Fail()
+	}
+}
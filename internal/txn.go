@@ -0,0 +1,72 @@
+package internal
+
+import "github.com/elvinchan/kvdb"
+
+// CheckTxn returns kvdb.ErrorInvalidTxn if type of any condition or operation
+// of txn is unknown.
+func CheckTxn(txn *kvdb.Txn) error {
+	for _, c := range txn.Conds {
+		switch c.Type {
+		case kvdb.CondExist, kvdb.CondNotExist, kvdb.CondValue:
+		default:
+			return kvdb.ErrorInvalidTxn
+		}
+	}
+	for _, op := range txn.Ops {
+		switch op.Type {
+		case kvdb.OpSet, kvdb.OpDelete:
+		default:
+			return kvdb.ErrorInvalidTxn
+		}
+	}
+	return nil
+}
+
+// CondsHold returns if all conditions hold, get returns value of key and if
+// it's a live key.
+func CondsHold(conds []kvdb.Cond,
+	get func(key string) (string, bool, error)) (bool, error) {
+	for _, c := range conds {
+		value, exist, err := get(c.Key)
+		if err != nil {
+			return false, err
+		}
+		switch c.Type {
+		case kvdb.CondExist:
+			if !exist {
+				return false, nil
+			}
+		case kvdb.CondNotExist:
+			if exist {
+				return false, nil
+			}
+		case kvdb.CondValue:
+			if !exist || value != c.Value {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// PendingChildren returns keys set by operations before ops[i] which are
+// children or descendants deleted by ops[i], for DB which resolves children to
+// delete from data before the transaction.
+func PendingChildren(o *kvdb.Option, ops []kvdb.Op, i int) []string {
+	op := ops[i]
+	if op.Type != kvdb.OpDelete ||
+		(!op.Deleter.Children && !op.Deleter.Descendants) {
+		return nil
+	}
+	depth := 1
+	if op.Deleter.Descendants {
+		depth = 0
+	}
+	var keys []string
+	for _, p := range ops[:i] {
+		if p.Type == kvdb.OpSet && InDepth(o, p.Key, op.Key, depth) {
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
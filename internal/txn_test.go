@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elvinchan/kvdb"
+)
+
+func TestCheckTxn(t *testing.T) {
+	cases := []struct {
+		Txn    *kvdb.Txn
+		Expect error
+	}{
+		{kvdb.NewTxn(), nil},
+		{kvdb.NewTxn().If(kvdb.IfExist("a")).Set("a", "1").Delete("b"), nil},
+		{&kvdb.Txn{Conds: []kvdb.Cond{{Key: "a"}}}, kvdb.ErrorInvalidTxn},
+		{&kvdb.Txn{Ops: []kvdb.Op{{Key: "a"}}}, kvdb.ErrorInvalidTxn},
+	}
+	for i, c := range cases {
+		if err := CheckTxn(c.Txn); err != c.Expect {
+			t.Errorf("result of case %d not right, expect %v, got %v",
+				i, c.Expect, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestCondsHold(t *testing.T) {
+	store := map[string]string{"a": "1"}
+	get := func(key string) (string, bool, error) {
+		v, ok := store[key]
+		return v, ok, nil
+	}
+	cases := []struct {
+		Conds  []kvdb.Cond
+		Expect bool
+	}{
+		{nil, true},
+		{[]kvdb.Cond{kvdb.IfExist("a")}, true},
+		{[]kvdb.Cond{kvdb.IfExist("b")}, false},
+		{[]kvdb.Cond{kvdb.IfNotExist("b")}, true},
+		{[]kvdb.Cond{kvdb.IfNotExist("a")}, false},
+		{[]kvdb.Cond{kvdb.IfValue("a", "1"), kvdb.IfNotExist("b")}, true},
+		{[]kvdb.Cond{kvdb.IfValue("a", "1"), kvdb.IfValue("a", "2")}, false},
+		{[]kvdb.Cond{kvdb.IfValue("b", "")}, false},
+	}
+	for i, c := range cases {
+		rst, err := CondsHold(c.Conds, get)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if rst != c.Expect {
+			t.Errorf("result of case %d not right, expect %v, got %v",
+				i, c.Expect, rst)
+			t.Fail()
+		}
+	}
+}
+
+func TestPendingChildren(t *testing.T) {
+	o := kvdb.InitOption()
+	ops := kvdb.NewTxn().
+		Set("a.b1", "1").
+		Set("a.b1.c1", "2").
+		Delete("a.b2").
+		Set("ab", "3").
+		Delete("a", kvdb.DeleteChildren()).
+		Delete("a", kvdb.DeleteDescendants()).
+		Ops
+	cases := []struct {
+		Index  int
+		Expect []string
+	}{
+		{0, nil},
+		{2, nil},
+		{4, []string{"a.b1"}},
+		{5, []string{"a.b1", "a.b1.c1"}},
+	}
+	for _, c := range cases {
+		rst := PendingChildren(o, ops, c.Index)
+		if !reflect.DeepEqual(rst, c.Expect) {
+			t.Errorf("result of op %d not right, expect %v, got %v",
+				c.Index, c.Expect, rst)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+// maxWatchEvents is the most events queued for a watcher, which is closed
+// with EventOverflow if receiver falls further behind.
+const maxWatchEvents = 1000
+
+// Hub dispatches events of writes to watchers in process, and reports expire
+// of key by timer, which is only scheduled if key is watched when it's set.
+// Events should be reported while write lock of DB is held, so that they are
+// in the same order as writes, DB without write lock in process should hold
+// `Lock()` instead.
+type Hub struct {
+	option   *kvdb.Option
+	watchers map[*watcher]struct{}
+	timers   map[string]*time.Timer
+	// timerKeys are sorted keys of timers, so that timers of children or
+	// descendants of deleted key are found without scanning all timers.
+	timerKeys []string
+	closed    bool
+	mu        sync.Mutex
+	// order is held by writes while anything is watched, see `Lock()`.
+	order sync.RWMutex
+}
+
+type watcher struct {
+	key       string
+	recursive bool
+	// overflow is set with lock of hub held once EventOverflow is queued.
+	overflow bool
+	events   []kvdb.Event
+	signal   chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+func NewHub(o *kvdb.Option) *Hub {
+	return &Hub{
+		option:   o,
+		watchers: make(map[*watcher]struct{}),
+		timers:   make(map[string]*time.Timer),
+	}
+}
+
+// Watch returns channel of events of key, or key and all descendants if
+// recursive, which is closed when ctx is done or hub is closed. Events are
+// queued so writes never block on slow receiver, if maxWatchEvents are
+// queued, EventOverflow is reported instead of later events and channel is
+// closed after it.
+func (h *Hub) Watch(ctx context.Context, key string, recursive bool,
+) (<-chan kvdb.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		key:       key,
+		recursive: recursive,
+		signal:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	ch := make(chan kvdb.Event)
+	// wait for writes started without order, so that events of later writes
+	// are in order
+	h.order.Lock()
+	h.mu.Lock()
+	closed := h.closed
+	if !closed {
+		h.watchers[w] = struct{}{}
+	}
+	h.mu.Unlock()
+	h.order.Unlock()
+	if closed {
+		close(ch)
+		return ch, nil
+	}
+	go func() {
+		defer close(ch)
+		defer h.unwatch(w)
+		for {
+			w.mu.Lock()
+			events := w.events
+			w.events = nil
+			w.mu.Unlock()
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				case <-w.done:
+					return
+				}
+				if e.Type == kvdb.EventOverflow {
+					return
+				}
+			}
+			select {
+			case <-w.signal:
+			case <-ctx.Done():
+				return
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (h *Hub) unwatch(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+}
+
+// Lock serializes writes and reports of them while anything is watched, and
+// returns function to unlock, which should be called after events of write
+// are reported. It's used by DB without write lock in process, writes are
+// not serialized if nothing is watched.
+func (h *Hub) Lock() (unlock func()) {
+	h.order.RLock()
+	h.mu.Lock()
+	watched := len(h.watchers) > 0
+	h.mu.Unlock()
+	if !watched {
+		return h.order.RUnlock
+	}
+	h.order.RUnlock()
+	h.order.Lock()
+	return h.order.Unlock
+}
+
+// Set report value of key is set, and schedule expire of key at expireAt,
+// zero expireAt means never expire.
+func (h *Hub) Set(key, value string, expireAt time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notify(kvdb.Event{Type: kvdb.EventSet, Key: key, Value: value})
+	h.schedule(key, expireAt)
+}
+
+// Update report value of key is set while expire time of key is kept.
+func (h *Hub) Update(key, value string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notify(kvdb.Event{Type: kvdb.EventSet, Key: key, Value: value})
+}
+
+// SetEntries report entries are set.
+func (h *Hub) SetEntries(entries []kvdb.Entry) {
+	for _, e := range entries {
+		h.Set(e.Key, e.Value, e.ExpireAt)
+	}
+}
+
+// Commit report operations of committed txn in order, deleted reports if
+// anything is deleted by each operation, delete operations which deleted
+// nothing are not reported.
+func (h *Hub) Commit(txn *kvdb.Txn, deleted []bool, now time.Time) {
+	for i := range txn.Ops {
+		op := &txn.Ops[i]
+		switch op.Type {
+		case kvdb.OpSet:
+			h.Set(op.Key, op.Value, ExpireTime(&op.Setter, now))
+		case kvdb.OpDelete:
+			if deleted[i] {
+				h.Delete(op.Key, &op.Deleter)
+			}
+		}
+	}
+}
+
+// Expire reschedule expire of key without event, which is used when expire
+// time of key is changed without writing value.
+func (h *Hub) Expire(key string, expireAt time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.schedule(key, expireAt)
+}
+
+// Delete report key is deleted with options, and cancel expire of deleted
+// keys. It should only be called if key or any of it's children or
+// descendants specified by dt is deleted.
+func (h *Hub) Delete(key string, dt *kvdb.Deleter) {
+	e := kvdb.Event{Type: kvdb.EventDelete, Key: key}
+	if dt != nil {
+		e.Children, e.Descendants = dt.Children, dt.Descendants
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notify(e)
+	h.unschedule(key)
+	if !e.Children && !e.Descendants {
+		return
+	}
+	// keys of descendants are adjacent in sorted keys
+	lower, upper := 0, len(h.timerKeys)
+	if key != "" {
+		prefix := key + h.option.KeyPathSep
+		lower = sort.SearchStrings(h.timerKeys, prefix)
+		upper = lower + sort.Search(len(h.timerKeys)-lower, func(i int) bool {
+			return !strings.HasPrefix(h.timerKeys[lower+i], prefix)
+		})
+	}
+	var keys []string
+	for _, k := range h.timerKeys[lower:upper] {
+		if k != key && (e.Descendants || h.option.ParentKey(k) == key) {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		h.unschedule(k)
+	}
+}
+
+// Close close channels of all watchers and stop all timers.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for w := range h.watchers {
+		close(w.done)
+	}
+	h.watchers = nil
+	for k, t := range h.timers {
+		t.Stop()
+		delete(h.timers, k)
+	}
+	h.timerKeys = nil
+}
+
+// schedule should be called with lock held.
+func (h *Hub) schedule(key string, expireAt time.Time) {
+	h.unschedule(key)
+	if h.closed || expireAt.IsZero() ||
+		!h.watched(kvdb.Event{Type: kvdb.EventExpire, Key: key}) {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(expireAt), func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// timer may be replaced before it acquires lock
+		if h.timers[key] != t {
+			return
+		}
+		h.unschedule(key)
+		h.notify(kvdb.Event{Type: kvdb.EventExpire, Key: key})
+	})
+	h.timers[key] = t
+	i := sort.SearchStrings(h.timerKeys, key)
+	h.timerKeys = append(h.timerKeys, "")
+	copy(h.timerKeys[i+1:], h.timerKeys[i:])
+	h.timerKeys[i] = key
+}
+
+// unschedule stop timer of key if any, should be called with lock held.
+func (h *Hub) unschedule(key string) {
+	t, ok := h.timers[key]
+	if !ok {
+		return
+	}
+	t.Stop()
+	delete(h.timers, key)
+	i := sort.SearchStrings(h.timerKeys, key)
+	h.timerKeys = append(h.timerKeys[:i], h.timerKeys[i+1:]...)
+}
+
+// notify should be called with lock held. Watcher which has maxWatchEvents
+// queued gets EventOverflow instead, and no more events are queued for it.
+func (h *Hub) notify(e kvdb.Event) {
+	for w := range h.watchers {
+		if w.overflow || !h.match(w, e) {
+			continue
+		}
+		w.mu.Lock()
+		if len(w.events) < maxWatchEvents {
+			w.events = append(w.events, e)
+		} else {
+			w.events = append(w.events,
+				kvdb.Event{Type: kvdb.EventOverflow, Key: w.key})
+			w.overflow = true
+		}
+		w.mu.Unlock()
+		select {
+		case w.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watched should be called with lock held.
+func (h *Hub) watched(e kvdb.Event) bool {
+	for w := range h.watchers {
+		if !w.overflow && h.match(w, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) match(w *watcher, e kvdb.Event) bool {
+	if e.Key == w.key || (w.recursive && h.within(e.Key, w.key)) {
+		return true
+	}
+	if e.Type != kvdb.EventDelete {
+		return false
+	}
+	// deleted along with ancestor
+	return (e.Descendants && h.within(w.key, e.Key)) ||
+		(e.Children && h.option.ParentKey(w.key) == e.Key)
+}
+
+// within returns if key is descendant of parent, every key is descendant of
+// empty parent.
+func (h *Hub) within(key, parent string) bool {
+	if parent == "" {
+		return key != ""
+	}
+	return strings.HasPrefix(key, parent+h.option.KeyPathSep)
+}
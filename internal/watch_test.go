@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+func TestHubMatch(t *testing.T) {
+	h := NewHub(kvdb.InitOption())
+	cases := []struct {
+		Key       string
+		Recursive bool
+		Event     kvdb.Event
+		Expect    bool
+	}{
+		{"a", false, kvdb.Event{Type: kvdb.EventSet, Key: "a"}, true},
+		{"a", false, kvdb.Event{Type: kvdb.EventSet, Key: "a.b"}, false},
+		{"a", true, kvdb.Event{Type: kvdb.EventSet, Key: "a.b.c"}, true},
+		{"a", true, kvdb.Event{Type: kvdb.EventSet, Key: "ab"}, false},
+		{"", true, kvdb.Event{Type: kvdb.EventExpire, Key: "a"}, true},
+		{"a.b", false, kvdb.Event{Type: kvdb.EventDelete, Key: "a"}, false},
+		{"a.b", false, kvdb.Event{
+			Type: kvdb.EventDelete, Key: "a", Children: true,
+		}, true},
+		{"a.b.c", true, kvdb.Event{
+			Type: kvdb.EventDelete, Key: "a", Children: true,
+		}, false},
+		{"a.b.c", false, kvdb.Event{
+			Type: kvdb.EventDelete, Key: "a", Descendants: true,
+		}, true},
+		{"a.b", false, kvdb.Event{
+			Type: kvdb.EventSet, Key: "a", Descendants: true,
+		}, false},
+	}
+	for i, c := range cases {
+		w := &watcher{key: c.Key, recursive: c.Recursive}
+		if rst := h.match(w, c.Event); rst != c.Expect {
+			t.Errorf("result of case %d not right, expect %v, got %v",
+				i, c.Expect, rst)
+			t.Fail()
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub(kvdb.InitOption())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := h.Watch(ctx, "a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expireAt := time.Now().Add(time.Millisecond * 50)
+	h.Set("a.b", "1", expireAt)
+	h.Set("b", "1", time.Time{})
+	h.Update("a", "2")
+	h.Set("a.c", "1", expireAt)
+	h.Delete("a.c", nil)
+	expect := []kvdb.Event{
+		{Type: kvdb.EventSet, Key: "a.b", Value: "1"},
+		{Type: kvdb.EventSet, Key: "a", Value: "2"},
+		{Type: kvdb.EventSet, Key: "a.c", Value: "1"},
+		{Type: kvdb.EventDelete, Key: "a.c"},
+		{Type: kvdb.EventExpire, Key: "a.b"},
+	}
+	for i := range expect {
+		select {
+		case e := <-ch:
+			if !reflect.DeepEqual(e, expect[i]) {
+				t.Errorf("event %d not right, expect %v, got %v",
+					i, expect[i], e)
+				t.Fail()
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not received", i)
+		}
+	}
+	// expire of deleted key is canceled
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected event %v", e)
+		t.Fail()
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed after context canceled")
+		t.Fail()
+	}
+
+	ch, err = h.Watch(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed after hub closed")
+		t.Fail()
+	}
+	ch, err = h.Watch(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed for closed hub")
+		t.Fail()
+	}
+}
+
+func TestHubOverflow(t *testing.T) {
+	h := NewHub(kvdb.InitOption())
+	defer h.Close()
+	ch, err := h.Watch(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// events are queued while receiver is not reading
+	for i := 0; i < maxWatchEvents*2; i++ {
+		h.Update("a", strconv.Itoa(i))
+	}
+	var n int
+	for e := range ch {
+		if e.Type == kvdb.EventOverflow {
+			if e.Key != "a" {
+				t.Errorf("key not right, expect %s, got %s", "a", e.Key)
+				t.Fail()
+			}
+			break
+		}
+		if e.Value != strconv.Itoa(n) {
+			t.Errorf("event %d not right, got %v", n, e)
+			t.FailNow()
+		}
+		n++
+	}
+	if n > maxWatchEvents*2 || n < maxWatchEvents {
+		t.Errorf("count of events not right, got %d", n)
+		t.Fail()
+	}
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed after overflow")
+		t.Fail()
+	}
+}
+
+func TestHubDelete(t *testing.T) {
+	h := NewHub(kvdb.InitOption())
+	defer h.Close()
+	_, err := h.Watch(context.Background(), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expireAt := time.Now().Add(time.Hour)
+	for _, k := range []string{"a", "a.b", "a.b.c", "a.d", "ab", "b"} {
+		h.Set(k, "1", expireAt)
+	}
+	cases := []struct {
+		Key     string
+		Deleter *kvdb.Deleter
+		Expect  []string
+	}{
+		{"x", nil, []string{"a", "a.b", "a.b.c", "a.d", "ab", "b"}},
+		{"a", &kvdb.Deleter{Children: true}, []string{"a.b.c", "ab", "b"}},
+		{"a", &kvdb.Deleter{Descendants: true}, []string{"ab", "b"}},
+		{"", &kvdb.Deleter{Children: true}, nil},
+	}
+	for i, c := range cases {
+		h.Delete(c.Key, c.Deleter)
+		h.mu.Lock()
+		keys := append([]string(nil), h.timerKeys...)
+		n := len(h.timers)
+		h.mu.Unlock()
+		if !reflect.DeepEqual(keys, c.Expect) || n != len(c.Expect) {
+			t.Errorf("timers of case %d not right, expect %v, got %v, %d",
+				i, c.Expect, keys, n)
+			t.Fail()
+		}
+	}
+}
+
+func TestHubLock(t *testing.T) {
+	h := NewHub(kvdb.InitOption())
+	defer h.Close()
+	// writes are not serialized if nothing is watched
+	unlock := h.Lock()
+	h.Lock()()
+	unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := h.Watch(ctx, "a", false); err != nil {
+		t.Fatal(err)
+	}
+	unlock = h.Lock()
+	locked := make(chan struct{})
+	go func() {
+		h.Lock()()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Error("writes not serialized while watched")
+		t.Fail()
+	case <-time.After(time.Millisecond * 50):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("lock not acquired after unlock")
+		t.Fail()
+	}
+}
@@ -1,20 +1,69 @@
 package kvdb
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
 var (
 	ErrorKeyValuePairs = errors.New("invalid key value pairs")
+	// ErrorNotInteger is returned by `Incr()` if value of key is not a
+	// decimal integer.
+	ErrorNotInteger = errors.New("value is not an integer")
+	// ErrorOverflow is returned by `Incr()` if result overflows int64, value
+	// of key is not changed.
+	ErrorOverflow = errors.New("integer overflow")
 )
 
+// ConflictError is returned by `Set()` with `SetIfVersion()` if version of key
+// is not the expected one.
+type ConflictError struct {
+	Key     string `json:"key"`
+	Version int64  `json:"version"`
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("version conflict of key %s, expect version %d",
+		e.Key, e.Version)
+}
+
 type Node struct {
-	Value    string            `json:"value"`
+	Value string `json:"value"`
+	// Version starts from 1 when key is created and increases by 1 on every
+	// write of value, it may restart after key is deleted or expired. Only
+	// available for the node itself, not for children or descendants.
+	Version  int64             `json:"version,omitempty"`
 	Children map[string]string `json:"children,omitempty"`
+	// ChildList is the same children as Children but ordered by key, in
+	// descending order when paginate in reverse.
+	ChildList []KV `json:"childList,omitempty"`
+	// HasMore is true if there are more children after this page.
+	HasMore bool `json:"hasMore,omitempty"`
+	// Next is the start key for the next page of children, only available
+	// when HasMore is true.
+	Next string `json:"next,omitempty"`
+	// Descendants is nested nodes of children, which is only retrieved with
+	// `GetDescendants()`.
+	Descendants map[string]Node `json:"descendants,omitempty"`
 	// ExpireAt time.Time         `json:"-"` // unix seconds
 }
 
+// KV is a key value pair.
+type KV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Entry is a key value pair with it's own expire time for `SetEntries()`, zero
+// expire time means never expire.
+type Entry struct {
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	ExpireAt time.Time `json:"expireAt"`
+}
+
 // GetChildren specify to get children and set children pagination for `Get()`
 // or `GetMulti()`.
 // Start is the start key of children, could be full key or bare key, if using
@@ -28,6 +77,44 @@ func GetChildren(start string, limit int) GetOption {
 	}
 }
 
+// GetChildrenBefore specify to get children before key `before` in reverse
+// order for `Get()` or `GetMulti()`, which is useful to page backwards through
+// children with `Next` of result as `before` of the next page.
+// Before may be a bare key or a full key, empty means from the last child.
+// Limit is the same as `GetChildren()`.
+func GetChildrenBefore(before string, limit int) GetOption {
+	return func(g *Getter) {
+		g.Children = true
+		g.Start = before
+		g.Limit = limit
+		g.Reverse = true
+	}
+}
+
+// GetChildrenEnd specify the bound of children pagination, which should be
+// used with `GetChildren()` or `GetChildrenBefore()`.
+// Children are retrieved until key `end` (exclusive), which is an upper bound
+// of `GetChildren()` and a lower bound of `GetChildrenBefore()`.
+// End may be a bare key or a full key, empty means no bound.
+func GetChildrenEnd(end string) GetOption {
+	return func(g *Getter) {
+		g.End = end
+	}
+}
+
+// GetDescendants specify to get descendants as nested nodes for `Get()` or
+// `GetMulti()`.
+// Depth is the maximum levels of descendants to retrieve, for example, 1 means
+// only children, 2 means children and grandchildren, and 0 or negative means
+// unlimited. Descendants without existing parent key are ignored, as they are
+// unreachable when walking the key tree level by level.
+func GetDescendants(depth int) GetOption {
+	return func(g *Getter) {
+		g.Descendants = true
+		g.Depth = depth
+	}
+}
+
 // SetExpire set expire time of key(s) for `Set()` or `SetMulti()`.
 // Expired key value data is not deleted immediately after expire, the actual
 // delete timing depends on the logic of auto clean or manually call `Clean()`.
@@ -37,6 +124,24 @@ func SetExpire(at time.Time) SetOption {
 	}
 }
 
+// SetTTL set time to live of key(s) for `Set()` or `SetMulti()`, which is
+// relative to the time of writing and takes precedence over `SetExpire()`.
+func SetTTL(d time.Duration) SetOption {
+	return func(s *Setter) {
+		s.TTL = d
+	}
+}
+
+// SetIfVersion specify `Set()` writes only if current version of key is
+// version, 0 means key not exists or expired, otherwise `*ConflictError` is
+// returned. It's ignored by other methods.
+func SetIfVersion(version int64) SetOption {
+	return func(s *Setter) {
+		s.IfVersion = true
+		s.Version = version
+	}
+}
+
 // DeleteChildren specify to delete children for `Delete()` or `DeleteMulti()`.
 func DeleteChildren() DeleteOption {
 	return func(d *Deleter) {
@@ -44,31 +149,129 @@ func DeleteChildren() DeleteOption {
 	}
 }
 
+// DeleteDescendants specify to delete all descendants at any level for
+// `Delete()` or `DeleteMulti()`, the whole subtree is deleted atomically if
+// the DB supports.
+func DeleteDescendants() DeleteOption {
+	return func(d *Deleter) {
+		d.Descendants = true
+	}
+}
+
+// CountDescendants specify to count all descendants at any level instead of
+// only children for `Count()`, descendants without existing parent key are also
+// counted.
+func CountDescendants() CountOption {
+	return func(c *Counter) {
+		c.Descendants = true
+	}
+}
+
+// ListBareKey specify to list bare keys instead of full keys for `ListKeys()`.
+func ListBareKey() ListOption {
+	return func(l *Lister) {
+		l.BareKey = true
+	}
+}
+
 type KVDB interface {
 	// Get get node of key, which include value and optional children key value
 	// pairs with pagination.
 	Get(key string, opts ...GetOption) (*Node, error)
 
+	// GetContext is the same as Get but with a context which controls
+	// cancellation and deadline of the operation.
+	GetContext(ctx context.Context, key string, opts ...GetOption) (*Node, error)
+
 	// GetMulti get node map of keys, which include value and optional children
 	// key value pairs with pagination of every key.
 	GetMulti(keys []string, opts ...GetOption) (map[string]Node, error)
 
+	// GetMultiContext is the same as GetMulti but with a context.
+	GetMultiContext(ctx context.Context, keys []string, opts ...GetOption,
+	) (map[string]Node, error)
+
+	// GetBytes get value of key as bytes, which is binary safe over service.
+	// It returns nil if key not exists or expired.
+	GetBytes(key string) ([]byte, error)
+
+	// GetBytesContext is the same as GetBytes but with a context.
+	GetBytesContext(ctx context.Context, key string) ([]byte, error)
+
 	// Set set value for key with options, which you can specify expire time of
 	// key.
 	Set(key, value string, opts ...SetOption) error
 
+	// SetContext is the same as Set but with a context.
+	SetContext(ctx context.Context, key, value string, opts ...SetOption) error
+
 	// SetMulti set key value pairs with options, which you can specify expire
 	// time of keys.
 	// For example, SetMulti([]string{"a", 1, "b", 2}) means set value 1 for key
 	// a and set value 2 for key b.
 	SetMulti(kvPairs []string, opts ...SetOption) error
 
+	// SetMultiContext is the same as SetMulti but with a context.
+	SetMultiContext(ctx context.Context, kvPairs []string, opts ...SetOption) error
+
+	// SetBytes set arbitrary bytes as value for key, options are the same as
+	// Set. Value is stored as binary where the DB distinguishes it from text,
+	// and it's the same as the string value got by Get.
+	SetBytes(key string, value []byte, opts ...SetOption) error
+
+	// SetBytesContext is the same as SetBytes but with a context.
+	SetBytesContext(ctx context.Context, key string, value []byte,
+		opts ...SetOption) error
+
+	// SetNX set value for key only if key is not exist or expired, and returns
+	// if value is set. Options are the same as Set.
+	SetNX(key, value string, opts ...SetOption) (bool, error)
+
+	// SetNXContext is the same as SetNX but with a context.
+	SetNXContext(ctx context.Context, key, value string, opts ...SetOption,
+	) (bool, error)
+
+	// CompareAndSwap set value of key to new only if current value of live key
+	// is old, and returns if value is swapped. Options are the same as Set, so
+	// expire time of key is replaced too.
+	CompareAndSwap(key, old, new string, opts ...SetOption) (bool, error)
+
+	// CompareAndSwapContext is the same as CompareAndSwap but with a context.
+	CompareAndSwapContext(ctx context.Context, key, old, new string,
+		opts ...SetOption) (bool, error)
+
+	// Incr increase integer value of key by delta atomically, and returns the
+	// new value. Key not exists or expired is treated as 0 and never expires,
+	// otherwise expire time of key is kept.
+	Incr(key string, delta int64) (int64, error)
+
+	// IncrContext is the same as Incr but with a context.
+	IncrContext(ctx context.Context, key string, delta int64) (int64, error)
+
+	// Commit commit operations of txn atomically if all preconditions hold,
+	// and returns if txn is committed. Nothing is written if any precondition
+	// not holds.
+	Commit(txn *Txn) (bool, error)
+
+	// CommitContext is the same as Commit but with a context.
+	CommitContext(ctx context.Context, txn *Txn) (bool, error)
+
+	// SetEntries set entries in batch, every entry carries it's own expire
+	// time, which is written atomically if the DB supports.
+	SetEntries(entries []Entry) error
+
+	// SetEntriesContext is the same as SetEntries but with a context.
+	SetEntriesContext(ctx context.Context, entries []Entry) error
+
 	// Delete delete key with options, which you can specify also delete
 	// children of this key.
 	// Delete would not effect on any other keys, for example, if you delete the
 	// key without any option, you can still use it's child keys or parent key.
 	Delete(key string, opts ...DeleteOption) error
 
+	// DeleteContext is the same as Delete but with a context.
+	DeleteContext(ctx context.Context, key string, opts ...DeleteOption) error
+
 	// DeleteMulti delete keys with options, which you can specify also delete
 	// children of these keys.
 	// DeleteMulti would not effect on any other keys, for example, if you
@@ -76,12 +279,83 @@ type KVDB interface {
 	// parent key.
 	DeleteMulti(keys []string, opts ...DeleteOption) error
 
-	// Exist check if key is exist.
+	// DeleteMultiContext is the same as DeleteMulti but with a context.
+	DeleteMultiContext(ctx context.Context, keys []string,
+		opts ...DeleteOption) error
+
+	// ListKeys list keys of live children of parent ordered by key with
+	// pagination, without loading values. Start and limit are the same as
+	// `GetChildren()`, which you can specify to list bare keys by options.
+	ListKeys(parent, start string, limit int, opts ...ListOption,
+	) ([]string, error)
+
+	// ListKeysContext is the same as ListKeys but with a context.
+	ListKeysContext(ctx context.Context, parent, start string, limit int,
+		opts ...ListOption) ([]string, error)
+
+	// Exist check if key is exist, expired key is treated as not exist.
 	Exist(key string) (bool, error)
 
+	// ExistContext is the same as Exist but with a context.
+	ExistContext(ctx context.Context, key string) (bool, error)
+
+	// ExistMulti check if keys are exist, which returns result of every key.
+	ExistMulti(keys []string) (map[string]bool, error)
+
+	// ExistMultiContext is the same as ExistMulti but with a context.
+	ExistMultiContext(ctx context.Context, keys []string,
+	) (map[string]bool, error)
+
+	// ExpireAt returns expire time of key, zero time means never expire, and
+	// exist is false if key is not exist or expired.
+	ExpireAt(key string) (at time.Time, exist bool, err error)
+
+	// ExpireAtContext is the same as ExpireAt but with a context.
+	ExpireAtContext(ctx context.Context, key string,
+	) (at time.Time, exist bool, err error)
+
+	// Touch set time to live of key without rewriting value, and returns if
+	// key is exist. Expired key is not touched.
+	Touch(key string, ttl time.Duration) (bool, error)
+
+	// TouchContext is the same as Touch but with a context.
+	TouchContext(ctx context.Context, key string, ttl time.Duration,
+	) (bool, error)
+
+	// Persist remove expire time of key so it never expires, and returns if key
+	// is exist. Expired key is not persisted.
+	Persist(key string) (bool, error)
+
+	// PersistContext is the same as Persist but with a context.
+	PersistContext(ctx context.Context, key string) (bool, error)
+
+	// Count count live children of key with options, which you can specify to
+	// count all descendants instead. Expired keys are not counted, and the key
+	// itself is not required to exist.
+	Count(key string, opts ...CountOption) (int, error)
+
+	// CountContext is the same as Count but with a context.
+	CountContext(ctx context.Context, key string, opts ...CountOption,
+	) (int, error)
+
+	// Watch watch changes of key, or key and all descendants if recursive,
+	// and returns channel of events, which is closed when DB is closed or
+	// after EventOverflow if receiver falls too far behind.
+	// Only writes through this DB instance are reported, and expire is only
+	// reported for key set or touched while it's watched.
+	Watch(key string, recursive bool) (<-chan Event, error)
+
+	// WatchContext is the same as Watch but the channel is also closed when
+	// ctx is done.
+	WatchContext(ctx context.Context, key string, recursive bool,
+	) (<-chan Event, error)
+
 	// Cleanup delete all expired keys from DB.
 	Cleanup() error
 
+	// CleanupContext is the same as Cleanup but with a context.
+	CleanupContext(ctx context.Context) error
+
 	// Close close DB. should only execute once and cannot use after close.
 	Close() error
 }
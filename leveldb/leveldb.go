@@ -2,15 +2,19 @@ package leveldb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/elvinchan/kvdb"
 	"github.com/elvinchan/kvdb/internal"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/vmihailenco/msgpack/v5"
 )
@@ -19,7 +23,11 @@ type levelDB struct {
 	db      *leveldb.DB
 	option  *kvdb.Option
 	loadRec *internal.LoadRec
+	hub     *internal.Hub
 	close   chan struct{}
+	// mu serializes writes, so that version is read and written atomically
+	// without a transaction, which flushes memdb on every commit.
+	mu sync.Mutex
 }
 
 func NewDB(path string, opts ...kvdb.DBOption) (kvdb.KVDB, error) {
@@ -35,6 +43,7 @@ func NewDB(path string, opts ...kvdb.DBOption) (kvdb.KVDB, error) {
 		db:      db,
 		option:  o,
 		loadRec: internal.DefaultLoadRec(),
+		hub:     internal.NewHub(o),
 		close:   make(chan struct{}),
 	}
 	if o.AutoClean {
@@ -50,10 +59,16 @@ func NewDB(path string, opts ...kvdb.DBOption) (kvdb.KVDB, error) {
 type levelDBNode struct {
 	Value    string    `msgpack:"value"`
 	ExpireAt time.Time `msgpack:"expire_at,omitempty"`
+	Version  int64     `msgpack:"version,omitempty"`
 }
 
 func (l *levelDB) Get(key string, opts ...kvdb.GetOption,
 ) (*kvdb.Node, error) {
+	return l.GetContext(context.Background(), key, opts...)
+}
+
+func (l *levelDB) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -62,19 +77,24 @@ func (l *levelDB) Get(key string, opts ...kvdb.GetOption,
 		gt.Limit = l.option.DefaultLimit
 	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
-	node, deleteKeys, err := l.get(key, now, &gt)
+	defer l.hookReq(now)
+	node, deleteKeys, err := l.get(ctx, key, now, &gt)
 	if err != nil {
 		return nil, err
 	}
 	if len(deleteKeys) > 0 {
-		err = l.deleteMulti(deleteKeys, nil)
+		err = l.deleteExpired(ctx, deleteKeys, now)
 	}
 	return node, err
 }
 
 func (l *levelDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 ) (map[string]kvdb.Node, error) {
+	return l.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (l *levelDB) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -86,13 +106,13 @@ func (l *levelDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 		return nil, nil
 	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
+	defer l.hookReq(now)
 	var (
 		v          = make(map[string]kvdb.Node, len(keys))
 		deleteKeys []string
 	)
 	for i := range keys {
-		node, dks, err := l.get(keys[i], now, &gt)
+		node, dks, err := l.get(ctx, keys[i], now, &gt)
 		if err != nil {
 			return nil, err
 		}
@@ -103,13 +123,29 @@ func (l *levelDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 	}
 	var err error
 	if len(deleteKeys) > 0 {
-		err = l.deleteMulti(deleteKeys, nil)
+		err = l.deleteExpired(ctx, deleteKeys, now)
 	}
 	return v, err
 }
 
-func (l *levelDB) get(key string, now time.Time, gt *kvdb.Getter,
-) (*kvdb.Node, []string, error) {
+func (l *levelDB) GetBytes(key string) ([]byte, error) {
+	return l.GetBytesContext(context.Background(), key)
+}
+
+func (l *levelDB) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	node, err := l.GetContext(ctx, key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+func (l *levelDB) get(ctx context.Context, key string, now time.Time,
+	gt *kvdb.Getter) (*kvdb.Node, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	v, err := l.db.Get(l.mask(key), nil)
 	if err != nil {
 		if errors.Is(err, leveldb.ErrNotFound) {
@@ -118,7 +154,7 @@ func (l *levelDB) get(key string, now time.Time, gt *kvdb.Getter,
 		return nil, nil, err
 	}
 	var deleteKeys []string
-	retrive := func(key string, data []byte) (*string, error) {
+	retrive := func(key string, data []byte) (*levelDBNode, error) {
 		n, err := l.decode(data)
 		if err != nil {
 			return nil, err
@@ -129,128 +165,577 @@ func (l *levelDB) get(key string, now time.Time, gt *kvdb.Getter,
 			}
 			return nil, nil
 		}
-		return &n.Value, nil
+		return n, nil
 	}
-	vp, err := retrive(key, v)
+	n, err := retrive(key, v)
 	if err != nil {
 		return nil, nil, err
-	} else if vp == nil {
+	} else if n == nil {
 		return nil, nil, nil
 	}
 	node := kvdb.Node{
-		Value: *vp,
+		Value:   n.Value,
+		Version: n.Version,
 	}
 
 	isBareStartKey := l.option.IsBareKey(gt.Start)
 	parentStartKey := l.option.ParentKey(gt.Start)
 	if gt.Children && (isBareStartKey || parentStartKey == key) {
-		node.Children = make(map[string]string, gt.Limit)
-		iter := l.db.NewIterator(
-			l.childRange(key, l.option.BareKey(gt.Start)),
-			nil,
-		)
+		lower, upper := internal.ChildBounds(l.option, key, gt)
+		iter := l.db.NewIterator(l.childRange(key, lower, upper), nil)
 		defer iter.Release()
-		var i int
-		for iter.Next() {
+		move, ok := iter.Next, iter.First()
+		if gt.Reverse {
+			move, ok = iter.Prev, iter.Last()
+		}
+		var kvs []kvdb.KV
+		for ; ok; ok = move() {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
 			k := l.unmask(iter.Key())
-			vp, err := retrive(k, iter.Value())
+			n, err := retrive(k, iter.Value())
 			if err != nil {
 				return nil, nil, err
-			} else if vp == nil {
+			} else if n == nil {
 				continue
 			}
-			node.Children[k] = *vp
-			i++
-			if gt.Limit > 0 && i >= gt.Limit {
+			kvs = append(kvs, kvdb.KV{Key: k, Value: n.Value})
+			// one more child to tell if has more
+			if gt.Limit > 0 && len(kvs) > gt.Limit {
+				break
+			}
+		}
+		internal.FillChildren(&node, kvs, gt.Limit)
+	}
+	if gt.Descendants {
+		// scan level by level, stop when no key exists at current level since
+		// deeper keys are unreachable
+		flat := make(map[string]string)
+		level := strings.Count(key, l.option.KeyPathSep) + 1
+		for depth := 1; gt.Depth <= 0 || depth <= gt.Depth; depth++ {
+			found, err := l.scanLevel(ctx, l.db, key, level+depth,
+				func(k string, data []byte) error {
+					n, err := retrive(k, data)
+					if err == nil && n != nil {
+						flat[k] = n.Value
+					}
+					return err
+				})
+			if err != nil {
+				return nil, nil, err
+			} else if !found {
 				break
 			}
 		}
+		node.Descendants = internal.BuildDescendants(l.option, key, flat)
 	}
 	return &node, deleteKeys, nil
 }
 
-func nextBytes(key []byte) []byte {
-	for i := len(key) - 1; i >= 0; i-- {
-		if key[i] < 0xff {
-			key[i] = key[i] + 1
-			break
+// scanLevel iterate keys of level under parent key read by r and returns if
+// any key found.
+func (l *levelDB) scanLevel(ctx context.Context, r reader, parentKey string,
+	level int, fn func(key string, data []byte) error) (bool, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("node:")
+	buffer.WriteString(strconv.Itoa(level))
+	buffer.WriteString(":")
+	buffer.WriteString(parentKey)
+	buffer.WriteString(l.option.KeyPathSep)
+	iter := r.NewIterator(util.BytesPrefix(buffer.Bytes()), nil)
+	defer iter.Release()
+	var found bool
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		found = true
+		if err := fn(l.unmask(iter.Key()), iter.Value()); err != nil {
+			return false, err
 		}
 	}
-	return key
+	return found, iter.Error()
 }
 
-// childRange generate LevelDB's Range for iterator
-func (l *levelDB) childRange(parentKey, startBareKey string) *util.Range {
-	startBare := []byte(startBareKey)
-	if startBareKey != "" {
-		startBare = nextBytes(startBare)
+// childRange generate LevelDB's Range for iterator of children of parentKey
+// between exclusive bounds lower and upper, empty upper means no upper bound.
+func (l *levelDB) childRange(parentKey, lower, upper string) *util.Range {
+	rg := util.BytesPrefix(l.mask(l.option.FullKey("", parentKey)))
+	// smallest key greater than lower
+	if start := append(l.mask(lower), 0); bytes.Compare(start, rg.Start) > 0 {
+		rg.Start = start
 	}
-	parent := []byte(parentKey)
-	start := l.maskBytes(parent, startBare)
-	limit := l.maskBytes(nextBytes(parent), []byte{})
-	return &util.Range{Start: start, Limit: limit}
+	if upper != "" {
+		rg.Limit = l.mask(upper)
+	}
+	return rg
 }
 
 func (l *levelDB) Set(key, value string, opts ...kvdb.SetOption) error {
+	return l.SetContext(context.Background(), key, value, opts...)
+}
+
+func (l *levelDB) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
-	v, err := l.encode(value, st.ExpireAt)
+	defer l.hookReq(now)
+	var conflict bool
+	_, err := l.modify(key, now, func(n *levelDBNode) *levelDBNode {
+		if st.IfVersion && n.version() != st.Version {
+			conflict = true
+			return nil
+		}
+		return &levelDBNode{
+			Value:    value,
+			ExpireAt: internal.ExpireTime(&st, now),
+			Version:  n.version() + 1,
+		}
+	})
+	if err == nil && conflict {
+		return &kvdb.ConflictError{Key: key, Version: st.Version}
+	}
+	return err
+}
+
+func (l *levelDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return l.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (l *levelDB) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	entries, err := internal.Entries(kvPairs,
+		internal.ExpireTime(&st, time.Now()))
 	if err != nil {
 		return err
 	}
-	return l.db.Put(l.mask(key), v, nil)
+	return l.SetEntriesContext(ctx, entries)
 }
 
-func (l *levelDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+func (l *levelDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return l.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (l *levelDB) SetBytesContext(ctx context.Context, key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return l.SetContext(ctx, key, string(value), opts...)
+}
+
+func (l *levelDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return l.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (l *levelDB) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
 	}
-	if len(kvPairs)%2 != 0 {
-		return kvdb.ErrorKeyValuePairs
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
+	defer l.hookReq(now)
+	return l.modify(key, now, func(n *levelDBNode) *levelDBNode {
+		if n != nil {
+			return nil
+		}
+		return &levelDBNode{
+			Value:    value,
+			ExpireAt: internal.ExpireTime(&st, now),
+			Version:  1,
+		}
+	})
+}
+
+func (l *levelDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return l.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (l *levelDB) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	return l.modify(key, now, func(n *levelDBNode) *levelDBNode {
+		if n == nil || n.Value != old {
+			return nil
+		}
+		return &levelDBNode{
+			Value:    new,
+			ExpireAt: internal.ExpireTime(&st, now),
+			Version:  n.Version + 1,
+		}
+	})
+}
+
+func (l *levelDB) Incr(key string, delta int64) (int64, error) {
+	return l.IncrContext(context.Background(), key, delta)
+}
+
+func (l *levelDB) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	var (
+		rst int64
+		err error
+	)
+	_, merr := l.modify(key, now, func(n *levelDBNode) *levelDBNode {
+		if n == nil {
+			n = &levelDBNode{Value: "0"}
+		}
+		if rst, err = internal.Incr(n.Value, delta); err != nil {
+			return nil
+		}
+		return &levelDBNode{
+			Value:    strconv.FormatInt(rst, 10),
+			ExpireAt: n.ExpireAt,
+			Version:  n.Version + 1,
+		}
+	})
+	if merr != nil {
+		return 0, merr
+	}
+	return rst, err
+}
+
+func (l *levelDB) Commit(txn *kvdb.Txn) (bool, error) {
+	return l.CommitContext(context.Background(), txn)
+}
+
+// CommitContext check preconditions and write operations in a transaction
+// which blocks other writes, every delete operation is written by a batch.
+// Children to delete are resolved from data before the transaction, along with
+// children set by previous operations.
+func (l *levelDB) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn == nil {
+		return true, nil
+	}
+	if err := internal.CheckTxn(txn); err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tr, err := l.db.OpenTransaction()
+	if err != nil {
+		return false, err
+	}
+	defer tr.Discard()
+	ok, err := internal.CondsHold(txn.Conds, func(key string,
+	) (string, bool, error) {
+		n, err := l.live(tr, key, now)
+		if err != nil || n == nil {
+			return "", false, err
+		}
+		return n.Value, true, nil
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	deleted := make([]bool, len(txn.Ops))
+	for i, op := range txn.Ops {
+		switch op.Type {
+		case kvdb.OpSet:
+			// read in the transaction to see previous operations
+			n, err := l.live(tr, op.Key, now)
+			if err != nil {
+				return false, err
+			}
+			v, err := l.encode(&levelDBNode{
+				Value:    op.Value,
+				ExpireAt: internal.ExpireTime(&op.Setter, now),
+				Version:  n.version() + 1,
+			})
+			if err != nil {
+				return false, err
+			}
+			if err = tr.Put(l.mask(op.Key), v, nil); err != nil {
+				return false, err
+			}
+		case kvdb.OpDelete:
+			has, err := tr.Has(l.mask(op.Key), nil)
+			if err != nil {
+				return false, err
+			}
+			batch := new(leveldb.Batch)
+			batch.Delete(l.mask(op.Key))
+			if op.Deleter.Children || op.Deleter.Descendants {
+				// children are read in the transaction under write lock, so
+				// that children set by previous operations are included and
+				// no child could be set by others meanwhile
+				err := l.deleteChildren(ctx, tr, batch, op.Key, &op.Deleter)
+				if err != nil {
+					return false, err
+				}
+			}
+			if err = tr.Write(batch, nil); err != nil {
+				return false, err
+			}
+			deleted[i] = has || batch.Len() > 1
+		}
+	}
+	if err = tr.Commit(); err != nil {
+		return false, err
+	}
+	l.hub.Commit(txn, deleted, now)
+	return true, nil
+}
+
+// modify read live node of key and write node returned by fn while holding
+// write lock, which blocks other writes during read-modify-write, and returns
+// if node is written.
+// Node passed to fn is nil if key is not exist or expired, and nothing is
+// written if fn returns nil. Written node is reported to watchers as set if
+// version is changed, otherwise only expire time is changed.
+func (l *levelDB) modify(key string, now time.Time,
+	fn func(n *levelDBNode) *levelDBNode) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.live(l.db, key, now)
+	if err != nil {
+		return false, err
+	}
+	version := n.version()
+	if n = fn(n); n == nil {
+		return false, nil
+	}
+	v, err := l.encode(n)
+	if err != nil {
+		return false, err
+	}
+	if err = l.db.Put(l.mask(key), v, nil); err != nil {
+		return false, err
+	}
+	if n.Version != version {
+		l.hub.Set(key, n.Value, n.ExpireAt)
+	} else {
+		l.hub.Expire(key, n.ExpireAt)
+	}
+	return true, nil
+}
+
+// reader is implemented by both leveldb.DB and leveldb.Transaction.
+type reader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// live returns live node of key read by r, nil if key is not exist or
+// expired.
+func (l *levelDB) live(r reader, key string, now time.Time,
+) (*levelDBNode, error) {
+	data, err := r.Get(l.mask(key), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	n, err := l.decode(data)
+	if err != nil || (!n.ExpireAt.IsZero() && !n.ExpireAt.After(now)) {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (l *levelDB) SetEntries(entries []kvdb.Entry) error {
+	return l.SetEntriesContext(context.Background(), entries)
+}
+
+func (l *levelDB) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// versions of duplicated keys of entries count previous entries
+	versions := make(map[string]int64, len(entries))
 	batch := new(leveldb.Batch)
-	for i := 0; i < len(kvPairs)/2; i++ {
-		v, err := l.encode(kvPairs[i*2+1], st.ExpireAt)
+	for _, e := range entries {
+		version, ok := versions[e.Key]
+		if !ok {
+			n, err := l.live(l.db, e.Key, now)
+			if err != nil {
+				return err
+			}
+			version = n.version()
+		}
+		version++
+		versions[e.Key] = version
+		v, err := l.encode(&levelDBNode{
+			Value:    e.Value,
+			ExpireAt: e.ExpireAt,
+			Version:  version,
+		})
 		if err != nil {
 			return err
 		}
-		batch.Put(l.mask(kvPairs[i*2]), v)
+		batch.Put(l.mask(e.Key), v)
 	}
-	return l.db.Write(batch, nil)
+	if err := l.db.Write(batch, nil); err != nil {
+		return err
+	}
+	l.hub.SetEntries(entries)
+	return nil
 }
 
 func (l *levelDB) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return l.DeleteContext(context.Background(), key, opts...)
+}
+
+func (l *levelDB) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
 	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
-	return l.delete(key, &dt)
+	defer l.hookReq(now)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	deleted, err := l.delete(ctx, key, &dt)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		l.hub.Delete(key, &dt)
+	}
+	return nil
 }
 
-func (l *levelDB) delete(key string, dt *kvdb.Deleter) error {
-	if dt != nil && dt.Children {
+// delete returns if key or any of it's children or descendants specified by
+// dt is deleted.
+func (l *levelDB) delete(ctx context.Context, key string, dt *kvdb.Deleter,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	has, err := l.db.Has(l.mask(key), nil)
+	if err != nil {
+		return false, err
+	}
+	if dt != nil && (dt.Children || dt.Descendants) {
 		batch := new(leveldb.Batch)
 		batch.Delete(l.mask(key))
-		iter := l.db.NewIterator(l.childRange(key, ""), nil)
+		if err := l.deleteChildren(ctx, l.db, batch, key, dt); err != nil {
+			return false, err
+		}
+		return has || batch.Len() > 1, l.db.Write(batch, nil)
+	}
+	if !has {
+		return false, nil
+	}
+	return true, l.db.Delete(l.mask(key), nil)
+}
+
+// deleteChildren put children or all descendants of key read by r to batch
+// for delete.
+func (l *levelDB) deleteChildren(ctx context.Context, r reader,
+	batch *leveldb.Batch, key string, dt *kvdb.Deleter) error {
+	return l.walkChildren(ctx, r, key, dt.Descendants, func(k string,
+		_ []byte) error {
+		batch.Delete(l.mask(k))
+		return nil
+	})
+}
+
+// walkChildren iterate children or all descendants of key read by r.
+func (l *levelDB) walkChildren(ctx context.Context, r reader, key string,
+	descendants bool, fn func(key string, data []byte) error) error {
+	if !descendants {
+		lower, upper := internal.ChildBounds(l.option, key, &kvdb.Getter{})
+		iter := r.NewIterator(l.childRange(key, lower, upper), nil)
+		defer iter.Release()
 		for iter.Next() {
-			batch.Delete(iter.Key())
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(l.unmask(iter.Key()), iter.Value()); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+	levels, err := l.levels(r)
+	if err != nil {
+		return err
+	}
+	level := strings.Count(key, l.option.KeyPathSep) + 1
+	for _, lv := range levels {
+		if lv <= level {
+			continue
+		}
+		if _, err := l.scanLevel(ctx, r, key, lv, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// levels returns all levels which have keys read by r, by seeking to the next
+// level prefix instead of iterating all keys.
+func (l *levelDB) levels(r reader) ([]int, error) {
+	prefix := []byte("node:")
+	iter := r.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	var levels []int
+	for ok := iter.First(); ok; {
+		k := iter.Key()[len(prefix):]
+		idx := bytes.IndexByte(k, ':')
+		if idx == -1 {
+			break
 		}
-		iter.Release()
-		return l.db.Write(batch, nil)
+		level, err := strconv.Atoi(string(k[:idx]))
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+		// ';' is the next byte of ':'
+		ok = iter.Seek([]byte("node:" + strconv.Itoa(level) + ";"))
 	}
-	return l.db.Delete(l.mask(key), nil)
+	return levels, iter.Error()
 }
 
 func (l *levelDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return l.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (l *levelDB) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
@@ -259,41 +744,289 @@ func (l *levelDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
 		return nil
 	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
+	defer l.hookReq(now)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var (
+		deleted []bool
+		err     error
+	)
 	if len(keys) == 1 {
-		return l.delete(keys[0], &dt)
+		deleted = make([]bool, 1)
+		deleted[0], err = l.delete(ctx, keys[0], &dt)
+	} else {
+		deleted, err = l.deleteMulti(ctx, keys, &dt)
+	}
+	if err != nil {
+		return err
 	}
-	return l.deleteMulti(keys, &dt)
+	for i, key := range keys {
+		if deleted[i] {
+			l.hub.Delete(key, &dt)
+		}
+	}
+	return nil
 }
 
-func (l *levelDB) deleteMulti(keys []string, dt *kvdb.Deleter) error {
+// deleteMulti returns if anything is deleted for each key, the same as
+// `delete()`.
+func (l *levelDB) deleteMulti(ctx context.Context, keys []string,
+	dt *kvdb.Deleter) ([]bool, error) {
 	batch := new(leveldb.Batch)
-	for _, key := range keys {
+	deleted := make([]bool, len(keys))
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		has, err := l.db.Has(l.mask(key), nil)
+		if err != nil {
+			return nil, err
+		}
+		n := batch.Len()
 		batch.Delete(l.mask(key))
-		if dt == nil || !dt.Children {
-			continue
+		if dt != nil && (dt.Children || dt.Descendants) {
+			if err := l.deleteChildren(ctx, l.db, batch, key, dt); err != nil {
+				return nil, err
+			}
 		}
-		iter := l.db.NewIterator(l.childRange(key, ""), nil)
-		for iter.Next() {
-			batch.Delete(iter.Key())
+		deleted[i] = has || batch.Len() > n+1
+	}
+	return deleted, l.db.Write(batch, nil)
+}
+
+// deleteExpired delete keys which are still expired at now, keys found expired
+// by read may be set again before write lock is held.
+func (l *levelDB) deleteExpired(ctx context.Context, keys []string,
+	now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := l.db.Get(l.mask(key), nil)
+		if err != nil {
+			if errors.Is(err, leveldb.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		expired, err := l.expired(data, now)
+		if err != nil {
+			return err
+		}
+		if expired {
+			batch.Delete(l.mask(key))
 		}
-		iter.Release()
 	}
 	return l.db.Write(batch, nil)
 }
 
+func (l *levelDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return l.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (l *levelDB) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	if limit == 0 {
+		limit = l.option.DefaultLimit
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	lower, upper := internal.ChildBounds(l.option, parent,
+		&kvdb.Getter{Start: start})
+	iter := l.db.NewIterator(l.childRange(parent, lower, upper), nil)
+	defer iter.Release()
+	var keys []string
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		expired, err := l.expired(iter.Value(), now)
+		if err != nil {
+			return nil, err
+		} else if expired {
+			continue
+		}
+		keys = append(keys, l.unmask(iter.Key()))
+		if limit > 0 && len(keys) >= limit {
+			break
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if ls.BareKey {
+		keys = internal.BareKeys(l.option, keys)
+	}
+	return keys, nil
+}
+
 func (l *levelDB) Exist(key string) (bool, error) {
+	return l.ExistContext(context.Background(), key)
+}
+
+func (l *levelDB) ExistContext(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	now := time.Now()
-	defer l.hookReq(time.Since(now))
-	return l.db.Has(l.mask(key), nil)
+	defer l.hookReq(now)
+	return l.exist(key, now)
+}
+
+func (l *levelDB) ExistMulti(keys []string) (map[string]bool, error) {
+	return l.ExistMultiContext(context.Background(), keys)
+}
+
+func (l *levelDB) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	now := time.Now()
+	defer l.hookReq(now)
+	v := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		has, err := l.exist(key, now)
+		if err != nil {
+			return nil, err
+		}
+		v[key] = has
+	}
+	return v, nil
+}
+
+func (l *levelDB) exist(key string, now time.Time) (bool, error) {
+	data, err := l.db.Get(l.mask(key), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	expired, err := l.expired(data, now)
+	return !expired, err
+}
+
+func (l *levelDB) ExpireAt(key string) (time.Time, bool, error) {
+	return l.ExpireAtContext(context.Background(), key)
+}
+
+func (l *levelDB) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	data, err := l.db.Get(l.mask(key), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	at, err := l.expireAt(data)
+	if err != nil {
+		return time.Time{}, false, err
+	} else if !at.IsZero() && !at.After(now) {
+		return time.Time{}, false, nil
+	}
+	return at, true, nil
+}
+
+func (l *levelDB) Touch(key string, ttl time.Duration) (bool, error) {
+	return l.TouchContext(context.Background(), key, ttl)
+}
+
+func (l *levelDB) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	return l.modify(key, now, func(n *levelDBNode) *levelDBNode {
+		if n != nil {
+			n.ExpireAt = now.Add(ttl)
+		}
+		return n
+	})
+}
+
+func (l *levelDB) Persist(key string) (bool, error) {
+	return l.PersistContext(context.Background(), key)
+}
+
+func (l *levelDB) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	return l.modify(key, now, func(n *levelDBNode) *levelDBNode {
+		if n != nil {
+			n.ExpireAt = time.Time{}
+		}
+		return n
+	})
+}
+
+func (l *levelDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return l.CountContext(context.Background(), key, opts...)
+}
+
+func (l *levelDB) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	defer l.hookReq(now)
+	var count int
+	err := l.walkChildren(ctx, l.db, key, ct.Descendants, func(_ string,
+		data []byte) error {
+		expired, err := l.expired(data, now)
+		if err == nil && !expired {
+			count++
+		}
+		return err
+	})
+	return count, err
 }
 
 func (l *levelDB) Cleanup() error {
+	return l.CleanupContext(context.Background())
+}
+
+func (l *levelDB) CleanupContext(ctx context.Context) error {
 	batch := new(leveldb.Batch)
 	now := time.Now()
+	// keys must not be set again between iteration and write of batch
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	iter := l.db.NewIterator(nil, nil)
 	defer iter.Release()
 	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		node, err := l.decode(iter.Value())
 		if err != nil {
 			return err
@@ -306,31 +1039,60 @@ func (l *levelDB) Cleanup() error {
 	return l.db.Write(batch, nil)
 }
 
+func (l *levelDB) Watch(key string, recursive bool,
+) (<-chan kvdb.Event, error) {
+	return l.WatchContext(context.Background(), key, recursive)
+}
+
+func (l *levelDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	return l.hub.Watch(ctx, key, recursive)
+}
+
 func (l *levelDB) Close() error {
 	close(l.close)
+	l.hub.Close()
 	return l.db.Close()
 }
 
-func (l *levelDB) hookReq(score time.Duration) {
+func (l *levelDB) hookReq(start time.Time) {
 	if l.option.AutoClean {
-		l.loadRec.HookReq(int64(score))
+		l.loadRec.HookReq(int64(time.Since(start)))
 	}
 }
 
-func (levelDB) encode(value string, expireAt time.Time) ([]byte, error) {
-	node := levelDBNode{
-		Value:    value,
-		ExpireAt: expireAt,
+func (*levelDB) encode(node *levelDBNode) ([]byte, error) {
+	return msgpack.Marshal(node)
+}
+
+// version returns version of node, 0 for nil node.
+func (n *levelDBNode) version() int64 {
+	if n == nil {
+		return 0
 	}
-	return msgpack.Marshal(&node)
+	return n.Version
 }
 
-func (levelDB) decode(data []byte) (*levelDBNode, error) {
+func (*levelDB) decode(data []byte) (*levelDBNode, error) {
 	var node levelDBNode
 	err := msgpack.Unmarshal(data, &node)
 	return &node, err
 }
 
+// expireAt decode only expire time of data, which skips value.
+func (*levelDB) expireAt(data []byte) (time.Time, error) {
+	var node struct {
+		ExpireAt time.Time `msgpack:"expire_at,omitempty"`
+	}
+	err := msgpack.Unmarshal(data, &node)
+	return node.ExpireAt, err
+}
+
+func (l *levelDB) expired(data []byte, now time.Time) (bool, error) {
+	at, err := l.expireAt(data)
+	return !at.IsZero() && !at.After(now), err
+}
+
 func (l *levelDB) mask(key string) []byte {
 	var buffer bytes.Buffer
 	buffer.WriteString("node:")
@@ -340,23 +1102,7 @@ func (l *levelDB) mask(key string) []byte {
 	return buffer.Bytes()
 }
 
-func (l *levelDB) maskBytes(keyParts ...[]byte) []byte {
-	var level int
-	for _, kp := range keyParts {
-		level += bytes.Count(kp, []byte(l.option.KeyPathSep)) + 1
-	}
-	var buffer bytes.Buffer
-	buffer.WriteString("node:")
-	buffer.WriteString(strconv.Itoa(level))
-	buffer.WriteString(":")
-	for _, kp := range keyParts {
-		buffer.Write(kp)
-		buffer.WriteString(l.option.KeyPathSep)
-	}
-	return buffer.Bytes()[:buffer.Len()-1]
-}
-
-func (levelDB) unmask(key []byte) string {
+func (*levelDB) unmask(key []byte) string {
 	idx := bytes.LastIndex(key, []byte(":"))
 	if idx == -1 {
 		return string(key)
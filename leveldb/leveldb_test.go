@@ -31,7 +31,7 @@ func TestCleanup(t *testing.T) {
 		if i == 1 {
 			now = time.Now().Add(time.Minute)
 		}
-		v, err := ldb.encode("test", now)
+		v, err := ldb.encode(&levelDBNode{Value: "test", ExpireAt: now})
 		if err != nil {
 			t.Error(err)
 			t.Fail()
@@ -0,0 +1,729 @@
+package memory
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/internal"
+)
+
+type memoryDB struct {
+	nodes    map[string]*memoryNode
+	children map[string]map[string]struct{} // parent key -> child keys
+	option   *kvdb.Option
+	loadRec  *internal.LoadRec
+	hub      *internal.Hub
+	close    chan struct{}
+	mu       sync.RWMutex
+}
+
+type memoryNode struct {
+	value    string
+	expireAt time.Time
+	version  int64
+}
+
+func (n *memoryNode) expired(now time.Time) bool {
+	return !n.expireAt.IsZero() && !n.expireAt.After(now)
+}
+
+// NewDB create a KVDB instance which keeps all data in process memory, data
+// would be lost after close.
+func NewDB(opts ...kvdb.DBOption) (kvdb.KVDB, error) {
+	o := kvdb.InitOption()
+	for _, opt := range opts {
+		opt(o)
+	}
+	v := memoryDB{
+		nodes:    make(map[string]*memoryNode),
+		children: make(map[string]map[string]struct{}),
+		option:   o,
+		loadRec:  internal.DefaultLoadRec(),
+		hub:      internal.NewHub(o),
+		close:    make(chan struct{}),
+	}
+	if o.AutoClean {
+		go v.loadRec.StartClean(func() {
+			if err := v.Cleanup(); err != nil {
+				log.Println("cleanup error when auto clean", err)
+			}
+		}, v.close)
+	}
+	return &v, nil
+}
+
+func (m *memoryDB) Get(key string, opts ...kvdb.GetOption,
+) (*kvdb.Node, error) {
+	return m.GetContext(context.Background(), key, opts...)
+}
+
+func (m *memoryDB) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	if gt.Children && gt.Limit == 0 {
+		gt.Limit = m.option.DefaultLimit
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.get(key, now, &gt), nil
+}
+
+func (m *memoryDB) GetMulti(keys []string, opts ...kvdb.GetOption,
+) (map[string]kvdb.Node, error) {
+	return m.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (m *memoryDB) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	if gt.Children && gt.Limit == 0 {
+		gt.Limit = m.option.DefaultLimit
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v := make(map[string]kvdb.Node, len(keys))
+	for _, key := range keys {
+		if node := m.get(key, now, &gt); node != nil {
+			v[key] = *node
+		}
+	}
+	return v, nil
+}
+
+func (m *memoryDB) GetBytes(key string) ([]byte, error) {
+	return m.GetBytesContext(context.Background(), key)
+}
+
+func (m *memoryDB) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	node, err := m.GetContext(ctx, key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+// get should be called with read lock held.
+func (m *memoryDB) get(key string, now time.Time, gt *kvdb.Getter,
+) *kvdb.Node {
+	n, ok := m.nodes[key]
+	if !ok || n.expired(now) {
+		return nil
+	}
+	node := kvdb.Node{
+		Value:   n.value,
+		Version: n.version,
+	}
+	isBareStartKey := m.option.IsBareKey(gt.Start)
+	parentStartKey := m.option.ParentKey(gt.Start)
+	if gt.Children && (isBareStartKey || parentStartKey == key) {
+		lower, upper := internal.ChildBounds(m.option, key, gt)
+		keys := m.childKeys(key)
+		if gt.Reverse {
+			sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		}
+		var kvs []kvdb.KV
+		for _, k := range keys {
+			if k <= lower || (upper != "" && k >= upper) {
+				continue
+			}
+			child := m.nodes[k]
+			if child.expired(now) {
+				continue
+			}
+			kvs = append(kvs, kvdb.KV{Key: k, Value: child.value})
+			// one more child to tell if has more
+			if gt.Limit > 0 && len(kvs) > gt.Limit {
+				break
+			}
+		}
+		internal.FillChildren(&node, kvs, gt.Limit)
+	}
+	if gt.Descendants {
+		node.Descendants = m.descendants(key, now, gt.Depth)
+	}
+	return &node
+}
+
+// descendants walk children index recursively until depth, should be called
+// with read lock held.
+func (m *memoryDB) descendants(key string, now time.Time, depth int,
+) map[string]kvdb.Node {
+	v := make(map[string]kvdb.Node, len(m.children[key]))
+	for k := range m.children[key] {
+		child := m.nodes[k]
+		// blank key is parent of top level keys, which are not it's
+		// descendants
+		if child.expired(now) || !internal.InDepth(m.option, k, key, 1) {
+			continue
+		}
+		node := kvdb.Node{
+			Value: child.value,
+		}
+		if depth != 1 {
+			if d := m.descendants(k, now, depth-1); len(d) > 0 {
+				node.Descendants = d
+			}
+		}
+		v[k] = node
+	}
+	return v
+}
+
+// childKeys returns sorted keys of direct children, should be called with read
+// lock held.
+func (m *memoryDB) childKeys(key string) []string {
+	keys := make([]string, 0, len(m.children[key]))
+	for k := range m.children[key] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryDB) Set(key, value string, opts ...kvdb.SetOption) error {
+	return m.SetContext(context.Background(), key, value, opts...)
+}
+
+func (m *memoryDB) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st.IfVersion && m.version(key, now) != st.Version {
+		return &kvdb.ConflictError{Key: key, Version: st.Version}
+	}
+	m.set(key, value, internal.ExpireTime(&st, now), now)
+	return nil
+}
+
+func (m *memoryDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return m.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (m *memoryDB) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	entries, err := internal.Entries(kvPairs,
+		internal.ExpireTime(&st, time.Now()))
+	if err != nil {
+		return err
+	}
+	return m.SetEntriesContext(ctx, entries)
+}
+
+func (m *memoryDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return m.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (m *memoryDB) SetBytesContext(ctx context.Context, key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return m.SetContext(ctx, key, string(value), opts...)
+}
+
+func (m *memoryDB) SetEntries(entries []kvdb.Entry) error {
+	return m.SetEntriesContext(context.Background(), entries)
+}
+
+func (m *memoryDB) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range entries {
+		m.set(e.Key, e.Value, e.ExpireAt, now)
+	}
+	return nil
+}
+
+func (m *memoryDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return m.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (m *memoryDB) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, ok := m.nodes[key]; ok && !n.expired(now) {
+		return false, nil
+	}
+	m.set(key, value, internal.ExpireTime(&st, now), now)
+	return true, nil
+}
+
+func (m *memoryDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return m.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (m *memoryDB) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[key]
+	if !ok || n.expired(now) || n.value != old {
+		return false, nil
+	}
+	m.set(key, new, internal.ExpireTime(&st, now), now)
+	return true, nil
+}
+
+func (m *memoryDB) Incr(key string, delta int64) (int64, error) {
+	return m.IncrContext(context.Background(), key, delta)
+}
+
+func (m *memoryDB) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, expireAt := "0", time.Time{}
+	if n, ok := m.nodes[key]; ok && !n.expired(now) {
+		value, expireAt = n.value, n.expireAt
+	}
+	rst, err := internal.Incr(value, delta)
+	if err != nil {
+		return 0, err
+	}
+	m.set(key, strconv.FormatInt(rst, 10), expireAt, now)
+	return rst, nil
+}
+
+func (m *memoryDB) Commit(txn *kvdb.Txn) (bool, error) {
+	return m.CommitContext(context.Background(), txn)
+}
+
+func (m *memoryDB) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn == nil {
+		return true, nil
+	}
+	if err := internal.CheckTxn(txn); err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok, _ := internal.CondsHold(txn.Conds, func(key string,
+	) (string, bool, error) {
+		n, ok := m.nodes[key]
+		if !ok || n.expired(now) {
+			return "", false, nil
+		}
+		return n.value, true, nil
+	})
+	if !ok {
+		return false, nil
+	}
+	for _, op := range txn.Ops {
+		switch op.Type {
+		case kvdb.OpSet:
+			m.set(op.Key, op.Value, internal.ExpireTime(&op.Setter, now),
+				now)
+		case kvdb.OpDelete:
+			m.deleteNode(op.Key, &op.Deleter)
+		}
+	}
+	return true, nil
+}
+
+// set write node with version increased from live node, should be called with
+// write lock held.
+func (m *memoryDB) set(key, value string, expireAt, now time.Time) {
+	if _, ok := m.nodes[key]; !ok {
+		parentKey := m.option.ParentKey(key)
+		if m.children[parentKey] == nil {
+			m.children[parentKey] = make(map[string]struct{})
+		}
+		m.children[parentKey][key] = struct{}{}
+	}
+	m.nodes[key] = &memoryNode{
+		value:    value,
+		expireAt: expireAt,
+		version:  m.version(key, now) + 1,
+	}
+	m.hub.Set(key, value, expireAt)
+}
+
+// version returns version of live node of key, 0 if key is not exist or
+// expired, should be called with lock held.
+func (m *memoryDB) version(key string, now time.Time) int64 {
+	n, ok := m.nodes[key]
+	if !ok || n.expired(now) {
+		return 0
+	}
+	return n.version
+}
+
+func (m *memoryDB) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return m.DeleteContext(context.Background(), key, opts...)
+}
+
+func (m *memoryDB) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	return m.DeleteMultiContext(ctx, []string{key}, opts...)
+}
+
+func (m *memoryDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return m.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (m *memoryDB) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
+	var dt kvdb.Deleter
+	for _, opt := range opts {
+		opt(&dt)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		m.deleteNode(key, &dt)
+	}
+	return nil
+}
+
+// deleteNode delete key with it's children or descendants specified by dt,
+// and report it if anything is deleted, should be called with write lock held.
+func (m *memoryDB) deleteNode(key string, dt *kvdb.Deleter) {
+	var deleted bool
+	if dt.Descendants {
+		deleted = m.deleteDescendants(key)
+	} else if dt.Children {
+		for k := range m.children[key] {
+			deleted = m.delete(k) || deleted
+		}
+	}
+	if m.delete(key) || deleted {
+		m.hub.Delete(key, dt)
+	}
+}
+
+// deleteDescendants scan children index of key and it's descendants, so
+// descendants without existing parent key are also deleted, and returns if
+// any descendant is deleted, should be called with write lock held.
+func (m *memoryDB) deleteDescendants(key string) bool {
+	var deleted bool
+	for pk, cks := range m.children {
+		if pk != key && !internal.InDepth(m.option, pk, key, 0) {
+			continue
+		}
+		for k := range cks {
+			// blank key is parent of top level keys, which are not it's
+			// descendants
+			if internal.InDepth(m.option, k, key, 0) {
+				deleted = m.delete(k) || deleted
+			}
+		}
+	}
+	return deleted
+}
+
+// delete returns if key exists, should be called with write lock held.
+func (m *memoryDB) delete(key string) bool {
+	if _, ok := m.nodes[key]; !ok {
+		return false
+	}
+	delete(m.nodes, key)
+	parentKey := m.option.ParentKey(key)
+	delete(m.children[parentKey], key)
+	if len(m.children[parentKey]) == 0 {
+		delete(m.children, parentKey)
+	}
+	return true
+}
+
+func (m *memoryDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return m.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (m *memoryDB) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	if limit == 0 {
+		limit = m.option.DefaultLimit
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	lower, _ := internal.ChildBounds(m.option, parent,
+		&kvdb.Getter{Start: start})
+	var keys []string
+	for _, k := range m.childKeys(parent) {
+		if k <= lower || m.nodes[k].expired(now) {
+			continue
+		}
+		keys = append(keys, k)
+		if limit > 0 && len(keys) >= limit {
+			break
+		}
+	}
+	if ls.BareKey {
+		keys = internal.BareKeys(m.option, keys)
+	}
+	return keys, nil
+}
+
+func (m *memoryDB) Exist(key string) (bool, error) {
+	return m.ExistContext(context.Background(), key)
+}
+
+func (m *memoryDB) ExistContext(ctx context.Context, key string,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[key]
+	return ok && !n.expired(now), nil
+}
+
+func (m *memoryDB) ExistMulti(keys []string) (map[string]bool, error) {
+	return m.ExistMultiContext(context.Background(), keys)
+}
+
+func (m *memoryDB) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		n, ok := m.nodes[key]
+		v[key] = ok && !n.expired(now)
+	}
+	return v, nil
+}
+
+func (m *memoryDB) ExpireAt(key string) (time.Time, bool, error) {
+	return m.ExpireAtContext(context.Background(), key)
+}
+
+func (m *memoryDB) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[key]
+	if !ok || n.expired(now) {
+		return time.Time{}, false, nil
+	}
+	return n.expireAt, true, nil
+}
+
+func (m *memoryDB) Touch(key string, ttl time.Duration) (bool, error) {
+	return m.TouchContext(context.Background(), key, ttl)
+}
+
+func (m *memoryDB) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	return m.expire(key, now.Add(ttl), now), nil
+}
+
+func (m *memoryDB) Persist(key string) (bool, error) {
+	return m.PersistContext(context.Background(), key)
+}
+
+func (m *memoryDB) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	return m.expire(key, time.Time{}, now), nil
+}
+
+// expire update expire time of live key.
+func (m *memoryDB) expire(key string, at, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[key]
+	if !ok || n.expired(now) {
+		return false
+	}
+	n.expireAt = at
+	m.hub.Expire(key, at)
+	return true
+}
+
+func (m *memoryDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return m.CountContext(context.Background(), key, opts...)
+}
+
+func (m *memoryDB) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var count int
+	if !ct.Descendants {
+		for k := range m.children[key] {
+			// blank key is parent of itself
+			if k != key && !m.nodes[k].expired(now) {
+				count++
+			}
+		}
+		return count, nil
+	}
+	for pk, cks := range m.children {
+		if pk != key && !internal.InDepth(m.option, pk, key, 0) {
+			continue
+		}
+		for k := range cks {
+			if internal.InDepth(m.option, k, key, 0) && !m.nodes[k].expired(now) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryDB) Cleanup() error {
+	return m.CleanupContext(context.Background())
+}
+
+func (m *memoryDB) CleanupContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, n := range m.nodes {
+		if n.expired(now) {
+			m.delete(k)
+		}
+	}
+	return nil
+}
+
+func (m *memoryDB) Watch(key string, recursive bool,
+) (<-chan kvdb.Event, error) {
+	return m.WatchContext(context.Background(), key, recursive)
+}
+
+func (m *memoryDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	return m.hub.Watch(ctx, key, recursive)
+}
+
+func (m *memoryDB) Close() error {
+	close(m.close)
+	m.hub.Close()
+	return nil
+}
+
+func (m *memoryDB) hookReq(start time.Time) {
+	if m.option.AutoClean {
+		m.loadRec.HookReq(int64(time.Since(start)))
+	}
+}
@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanup(t *testing.T) {
+	db, err := NewDB()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	mdb, ok := db.(*memoryDB)
+	if !ok {
+		t.Error("failed covert KVDB to MemoryDB instance")
+		t.Fail()
+	}
+
+	keys := []string{"inner.c", "inner.c.child1"}
+
+	now := time.Now()
+	for i, key := range keys {
+		if i == 1 {
+			now = time.Now().Add(time.Minute)
+		}
+		mdb.set(key, "test", now, time.Now())
+		if _, ok := mdb.nodes[key]; !ok {
+			t.Errorf("key not exist")
+			t.Fail()
+		}
+	}
+
+	err = mdb.Cleanup()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	for i, key := range keys {
+		_, has := mdb.nodes[key]
+		if has && i == 0 {
+			t.Errorf("key %s exist", key)
+			t.Fail()
+		} else if !has && i == 1 {
+			t.Errorf("key %s not exist", key)
+			t.Fail()
+		}
+	}
+	if _, ok := mdb.children["inner"]; ok {
+		t.Errorf("children index of %s exist", "inner")
+		t.Fail()
+	}
+	if _, ok := mdb.children["inner.c"]["inner.c.child1"]; !ok {
+		t.Errorf("children index of %s not exist", "inner.c")
+		t.Fail()
+	}
+}
@@ -2,10 +2,16 @@ package mongodb
 
 import (
 	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/elvinchan/kvdb"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -92,3 +98,278 @@ func TestCleanup(t *testing.T) {
 		}
 	}
 }
+
+func TestSetUpdate(t *testing.T) {
+	db, err := NewDB("mongodb://localhost:27017", "kvdb", "kv")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	mdb := db.(*mongoDB)
+
+	key := "setupdate.a"
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	cases := []struct {
+		// Expire expires document before set
+		Expire   bool
+		Entries  bool
+		Value    interface{}
+		ExpireAt time.Time
+		Version  int64
+	}{
+		{false, false, "1", time.Time{}, 1},
+		{false, false, "$v", expireAt, 2},
+		{false, true, "3", time.Time{}, 3},
+		{true, false, "4", expireAt, 1},
+		{true, true, "5", time.Time{}, 1},
+		{false, false, primitive.Binary{Data: []byte{0, 1}}, time.Time{}, 2},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if c.Expire {
+				_, err := mdb.collection.UpdateByID(context.TODO(), key,
+					bson.D{{Key: "$set", Value: bson.D{
+						{Key: "exp", Value: time.Now().Add(-time.Second)},
+					}}})
+				if err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+			}
+			if c.Entries {
+				err = mdb.SetEntries([]kvdb.Entry{{
+					Key: key, Value: c.Value.(string), ExpireAt: c.ExpireAt,
+				}})
+			} else {
+				err = mdb.set(context.TODO(), key, c.Value,
+					kvdb.SetExpire(c.ExpireAt))
+			}
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+
+			var result bson.M
+			err = mdb.collection.FindOne(context.TODO(), bson.D{{
+				Key: "_id", Value: key,
+			}}).Decode(&result)
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+			if !reflect.DeepEqual(result["v"], c.Value) {
+				t.Errorf("value not right, expect %v, got %v", c.Value,
+					result["v"])
+				t.Fail()
+			}
+			if result["pid"] != "setupdate" {
+				t.Errorf("parent key not right, expect %s, got %v",
+					"setupdate", result["pid"])
+				t.Fail()
+			}
+			if v := version(result); v != c.Version {
+				t.Errorf("version not right, expect %v, got %v", c.Version, v)
+				t.Fail()
+			}
+			exp := c.ExpireAt
+			if exp.IsZero() {
+				exp = maxDatetime
+			}
+			dt, _ := result["exp"].(primitive.DateTime)
+			if !dt.Time().Equal(exp) {
+				t.Errorf("expire time not right, expect %v, got %v", exp,
+					dt.Time())
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestIncrPipeline(t *testing.T) {
+	db, err := NewDB("mongodb://localhost:27017", "kvdb", "kv")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	mdb := db.(*mongoDB)
+
+	key := "incrpipeline.a"
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	cases := []struct {
+		// Init is document of key before Incr, nil means not exists
+		Init     bson.D
+		Delta    int64
+		Expect   int64
+		Err      error
+		Value    interface{}
+		ExpireAt time.Time
+		Version  int64
+	}{
+		{nil, 3, 3, nil, "3", maxDatetime, 1},
+		{bson.D{
+			{Key: "v", Value: "-7"}, {Key: "exp", Value: expireAt},
+			{Key: "ver", Value: int64(4)},
+		}, 10, 3, nil, "3", expireAt, 5},
+		{bson.D{
+			{Key: "v", Value: "9"},
+			{Key: "exp", Value: time.Now().Add(-time.Second)},
+			{Key: "ver", Value: int64(4)},
+		}, -2, -2, nil, "-2", maxDatetime, 1},
+		{bson.D{
+			{Key: "v", Value: "a"}, {Key: "exp", Value: expireAt},
+			{Key: "ver", Value: int64(2)},
+		}, 1, 0, kvdb.ErrorNotInteger, "a", expireAt, 2},
+		{bson.D{
+			{Key: "v", Value: "1.5"}, {Key: "exp", Value: expireAt},
+			{Key: "ver", Value: int64(2)},
+		}, 1, 0, kvdb.ErrorNotInteger, "1.5", expireAt, 2},
+		{bson.D{
+			{Key: "v", Value: "+5"}, {Key: "exp", Value: expireAt},
+			{Key: "ver", Value: int64(2)},
+		}, 1, 0, kvdb.ErrorNotInteger, "+5", expireAt, 2},
+		{bson.D{
+			{Key: "v", Value: "9223372036854775806"},
+			{Key: "exp", Value: expireAt}, {Key: "ver", Value: int64(2)},
+		}, 2, 0, kvdb.ErrorOverflow, "9223372036854775806", expireAt, 2},
+		{bson.D{
+			{Key: "v", Value: "9223372036854775806"},
+			{Key: "exp", Value: expireAt}, {Key: "ver", Value: int64(2)},
+		}, 1, math.MaxInt64, nil, "9223372036854775807", expireAt, 3},
+		{bson.D{
+			{Key: "v", Value: "-9223372036854775807"},
+			{Key: "exp", Value: expireAt}, {Key: "ver", Value: int64(2)},
+		}, -2, 0, kvdb.ErrorOverflow, "-9223372036854775807", expireAt, 2},
+		{bson.D{
+			{Key: "v", Value: primitive.Binary{Data: []byte("1")}},
+			{Key: "exp", Value: expireAt}, {Key: "ver", Value: int64(2)},
+		}, 1, 0, kvdb.ErrorNotInteger,
+			primitive.Binary{Data: []byte("1")}, expireAt, 2},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := mdb.collection.DeleteOne(context.TODO(), bson.D{{
+				Key: "_id", Value: key,
+			}})
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if c.Init != nil {
+				doc := append(bson.D{
+					{Key: "_id", Value: key}, {Key: "pid", Value: "incrpipeline"},
+				}, c.Init...)
+				if _, err := mdb.collection.InsertOne(context.TODO(),
+					doc); err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+			}
+
+			rst, err := mdb.Incr(key, c.Delta)
+			if !errors.Is(err, c.Err) {
+				t.Errorf("error not right, expect %v, got %v", c.Err, err)
+				t.Fail()
+			}
+			if rst != c.Expect {
+				t.Errorf("result not right, expect %v, got %v", c.Expect, rst)
+				t.Fail()
+			}
+
+			var result bson.M
+			err = mdb.collection.FindOne(context.TODO(), bson.D{{
+				Key: "_id", Value: key,
+			}}).Decode(&result)
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+			if !reflect.DeepEqual(result["v"], c.Value) {
+				t.Errorf("value not right, expect %v, got %v", c.Value,
+					result["v"])
+				t.Fail()
+			}
+			if result["pid"] != "incrpipeline" {
+				t.Errorf("parent key not right, expect %s, got %v",
+					"incrpipeline", result["pid"])
+				t.Fail()
+			}
+			if v := version(result); v != c.Version {
+				t.Errorf("version not right, expect %v, got %v", c.Version, v)
+				t.Fail()
+			}
+			dt, _ := result["exp"].(primitive.DateTime)
+			if !dt.Time().Equal(c.ExpireAt) {
+				t.Errorf("expire time not right, expect %v, got %v",
+					c.ExpireAt, dt.Time())
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestGetDescendantsBatch(t *testing.T) {
+	db, err := NewDB("mongodb://localhost:27017", "kvdb", "kv")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	// children of a level are more than one batch of parent keys
+	key := "getdescendantsbatch"
+	cnt := descendantBatch*2 + 1
+	entries := []kvdb.Entry{{Key: key, Value: "0"}}
+	for i := 0; i < cnt; i++ {
+		child := key + "." + strconv.Itoa(i)
+		entries = append(entries, kvdb.Entry{Key: child, Value: "1"},
+			kvdb.Entry{Key: child + ".c", Value: "2"},
+			kvdb.Entry{Key: child + ".c.c", Value: "3"})
+	}
+	for i := 0; i < len(entries); i += 100 {
+		end := i + 100
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := db.SetEntries(entries[i:end]); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+	}
+
+	rst, err := db.Get(key, kvdb.GetDescendants(2))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if rst == nil || len(rst.Descendants) != cnt {
+		t.Errorf("length of descendants not right, expect %v, got %v",
+			cnt, rst)
+		t.FailNow()
+	}
+	for k, node := range rst.Descendants {
+		c, ok := node.Descendants[k+".c"]
+		if len(node.Descendants) != 1 || !ok || c.Value != "2" ||
+			len(c.Descendants) != 0 {
+			t.Errorf("descendants of %s not right, got %v", k,
+				node.Descendants)
+			t.Fail()
+		}
+	}
+}
@@ -1,12 +1,20 @@
+// Package mongodb is KVDB powered by MongoDB. MongoDB 4.2 or later is
+// required, since versions and counters are written by update pipelines of
+// `setUpdate()` and `IncrContext()`.
 package mongodb
 
 import (
 	"context"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/elvinchan/kvdb"
 	"github.com/elvinchan/kvdb/internal"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -14,9 +22,17 @@ import (
 
 var maxDatetime, _ = time.Parse("2006-01-02 15:04:05", "9999-12-31 23:59:59")
 
+// descendantBatch is max count of parent keys in one query of descendants.
+const descendantBatch = 500
+
+// maxIncrRetries is max times to retry Incr if document is written
+// concurrently by others.
+const maxIncrRetries = 50
+
 type mongoDB struct {
 	option     *kvdb.Option
 	loadRec    *internal.LoadRec
+	hub        *internal.Hub
 	collection *mongo.Collection
 }
 
@@ -37,6 +53,7 @@ func NewDB(uri, database, collection string,
 	v := mongoDB{
 		option:     o,
 		loadRec:    internal.DefaultLoadRec(),
+		hub:        internal.NewHub(o),
 		collection: client.Database(database).Collection(collection),
 	}
 	_, err = v.collection.Indexes().CreateMany(
@@ -53,6 +70,11 @@ func NewDB(uri, database, collection string,
 
 func (m *mongoDB) Get(key string, opts ...kvdb.GetOption,
 ) (*kvdb.Node, error) {
+	return m.GetContext(context.Background(), key, opts...)
+}
+
+func (m *mongoDB) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -61,10 +83,10 @@ func (m *mongoDB) Get(key string, opts ...kvdb.GetOption,
 		gt.Limit = m.option.DefaultLimit
 	}
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
+	defer m.hookReq(now)
 	var result bson.M
 	err := m.collection.FindOne(
-		context.TODO(), bson.D{
+		ctx, bson.D{
 			{Key: "_id", Value: key},
 			{Key: "exp", Value: bson.D{
 				{Key: "$gt", Value: now},
@@ -78,9 +100,15 @@ func (m *mongoDB) Get(key string, opts ...kvdb.GetOption,
 		return nil, err
 	}
 	var v kvdb.Node
-	v.Value = result["v"].(string)
+	v.Value = value(result)
+	v.Version = version(result)
 	if gt.Children {
-		if err = m.getChildren(key, &v, now, &gt); err != nil {
+		if err = m.getChildren(ctx, key, &v, now, &gt); err != nil {
+			return nil, err
+		}
+	}
+	if gt.Descendants {
+		if err = m.getDescendants(ctx, key, &v, now, &gt); err != nil {
 			return nil, err
 		}
 	}
@@ -89,6 +117,11 @@ func (m *mongoDB) Get(key string, opts ...kvdb.GetOption,
 
 func (m *mongoDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 ) (map[string]kvdb.Node, error) {
+	return m.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (m *mongoDB) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -100,9 +133,9 @@ func (m *mongoDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 		return nil, nil
 	}
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
+	defer m.hookReq(now)
 	cur, err := m.collection.Find(
-		context.TODO(), bson.D{
+		ctx, bson.D{
 			{Key: "_id", Value: bson.D{
 				{Key: "$in", Value: keys},
 			}},
@@ -116,7 +149,7 @@ func (m *mongoDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 	}
 
 	var results []bson.M
-	if err := cur.All(context.TODO(), &results); err != nil {
+	if err := cur.All(ctx, &results); err != nil {
 		return nil, err
 	}
 	isBareStartKey := m.option.IsBareKey(gt.Start)
@@ -124,11 +157,17 @@ func (m *mongoDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 	v := make(map[string]kvdb.Node, len(results))
 	for _, result := range results {
 		node := kvdb.Node{
-			Value: result["v"].(string),
+			Value:   value(result),
+			Version: version(result),
 		}
 		k := result["_id"].(string)
 		if gt.Children && (isBareStartKey || parentStartKey == k) {
-			if err := m.getChildren(k, &node, now, &gt); err != nil {
+			if err := m.getChildren(ctx, k, &node, now, &gt); err != nil {
+				return nil, err
+			}
+		}
+		if gt.Descendants {
+			if err := m.getDescendants(ctx, k, &node, now, &gt); err != nil {
 				return nil, err
 			}
 		}
@@ -137,116 +176,656 @@ func (m *mongoDB) GetMulti(keys []string, opts ...kvdb.GetOption,
 	return v, nil
 }
 
-func (m *mongoDB) getChildren(
+func (m *mongoDB) GetBytes(key string) ([]byte, error) {
+	return m.GetBytesContext(context.Background(), key)
+}
+
+func (m *mongoDB) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	node, err := m.GetContext(ctx, key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+func (m *mongoDB) getChildren(ctx context.Context,
 	k string, v *kvdb.Node, now time.Time, gt *kvdb.Getter) error {
-	var opt *options.FindOptions
+	lower, upper := internal.ChildBounds(m.option, k, gt)
+	idFilter := bson.D{{Key: "$gt", Value: lower}}
+	if upper != "" {
+		idFilter = append(idFilter, bson.E{Key: "$lt", Value: upper})
+	}
+	order := 1
+	if gt.Reverse {
+		order = -1
+	}
+	// one more child to tell if has more
+	opt := options.Find().SetSort(bson.D{{Key: "_id", Value: order}})
 	if gt.Limit > 0 {
-		opt = options.Find().SetLimit(int64(gt.Limit))
+		opt.SetLimit(int64(gt.Limit + 1))
 	}
 	cur, err := m.collection.Find(
-		context.TODO(), bson.D{
+		ctx, bson.D{
 			{Key: "pid", Value: k},
 			{Key: "exp", Value: bson.D{
 				{Key: "$gt", Value: now},
 			}},
-			{Key: "_id", Value: bson.D{
-				{Key: "$gt", Value: m.option.FullKey(
-					m.option.BareKey(gt.Start), k,
-				)},
-			}},
+			{Key: "_id", Value: idFilter},
 		}, opt,
 	)
 	if err != nil {
 		return err
 	}
 	var childs []bson.M
-	if err := cur.All(context.TODO(), &childs); err != nil {
+	if err := cur.All(ctx, &childs); err != nil {
 		return err
 	}
-	v.Children = make(map[string]string, len(childs))
-	for _, child := range childs {
-		v.Children[child["_id"].(string)] = child["v"].(string)
+	kvs := make([]kvdb.KV, len(childs))
+	for i, child := range childs {
+		kvs[i] = kvdb.KV{
+			Key:   child["_id"].(string),
+			Value: value(child),
+		}
 	}
+	internal.FillChildren(v, kvs, gt.Limit)
 	return nil
 }
 
+// getDescendants query all descendants by anchored regex of key prefix which
+// could use index of _id if depth is unlimited, otherwise query level by level
+// by pid, so that levels deeper than depth are never loaded. Parent keys of a
+// level are queried in batches of descendantBatch, to keep within limit of
+// size of BSON document.
+func (m *mongoDB) getDescendants(ctx context.Context,
+	k string, v *kvdb.Node, now time.Time, gt *kvdb.Getter) error {
+	flat := make(map[string]string)
+	if gt.Depth <= 0 {
+		results, err := m.findAlive(ctx, m.descendantFilter(k), now)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			flat[result["_id"].(string)] = value(result)
+		}
+		v.Descendants = internal.BuildDescendants(m.option, k, flat)
+		return nil
+	}
+	parentKeys := []string{k}
+	for depth := 0; depth < gt.Depth && len(parentKeys) > 0; depth++ {
+		var childKeys []string
+		for len(parentKeys) > 0 {
+			n := len(parentKeys)
+			if n > descendantBatch {
+				n = descendantBatch
+			}
+			results, err := m.findAlive(ctx, bson.E{
+				Key: "pid", Value: bson.D{{Key: "$in", Value: parentKeys[:n]}},
+			}, now)
+			if err != nil {
+				return err
+			}
+			for _, result := range results {
+				key := result["_id"].(string)
+				flat[key] = value(result)
+				childKeys = append(childKeys, key)
+			}
+			parentKeys = parentKeys[n:]
+		}
+		parentKeys = childKeys
+	}
+	v.Descendants = internal.BuildDescendants(m.option, k, flat)
+	return nil
+}
+
+// findAlive query documents which match filter and are not expired.
+func (m *mongoDB) findAlive(ctx context.Context, filter bson.E,
+	now time.Time) ([]bson.M, error) {
+	cur, err := m.collection.Find(
+		ctx, bson.D{
+			filter,
+			{Key: "exp", Value: bson.D{
+				{Key: "$gt", Value: now},
+			}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	var results []bson.M
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (m *mongoDB) Set(key, value string, opts ...kvdb.SetOption) error {
+	return m.SetContext(context.Background(), key, value, opts...)
+}
+
+func (m *mongoDB) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	return m.set(ctx, key, value, opts...)
+}
+
+// set set value which is string or binary for key.
+func (m *mongoDB) set(ctx context.Context, key string, value interface{},
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
 	}
-	if st.ExpireAt.IsZero() {
-		st.ExpireAt = maxDatetime
-	}
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
-	_, err := m.collection.UpdateByID(context.TODO(),
+	defer m.hookReq(now)
+	unlock := m.hub.Lock()
+	defer unlock()
+	expireAt := internal.ExpireTime(&st, now)
+	if expireAt.IsZero() {
+		expireAt = maxDatetime
+	}
+	if st.IfVersion {
+		return m.setIfVersion(ctx, key, value, expireAt, st.Version, now)
+	}
+	_, err := m.collection.UpdateByID(ctx,
 		key,
-		bson.D{
+		m.setUpdate(key, value, expireAt, now),
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	m.notifySet(key, value, expireAt)
+	return nil
+}
+
+// setIfVersion set value by a conditional update of live document with
+// version, or insert only if document not exists or expired for version 0.
+func (m *mongoDB) setIfVersion(ctx context.Context, key string,
+	value interface{}, expireAt time.Time, version int64, now time.Time) error {
+	var ok bool
+	if version == 0 {
+		var err error
+		ok, err = m.insert(ctx, key, value, expireAt, now)
+		if err != nil {
+			return err
+		}
+	} else {
+		rst, err := m.collection.UpdateOne(ctx, bson.D{
+			{Key: "_id", Value: key},
+			{Key: "ver", Value: version},
+			{Key: "exp", Value: bson.D{
+				{Key: "$gt", Value: now},
+			}},
+		}, bson.D{
 			{Key: "$set", Value: bson.D{
 				{Key: "v", Value: value},
-				{Key: "pid", Value: m.option.ParentKey(key)},
-				{Key: "exp", Value: st.ExpireAt},
+				{Key: "exp", Value: expireAt},
+			}},
+			{Key: "$inc", Value: bson.D{
+				{Key: "ver", Value: int64(1)},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		ok = rst.MatchedCount > 0
+	}
+	if !ok {
+		return &kvdb.ConflictError{Key: key, Version: version}
+	}
+	m.notifySet(key, value, expireAt)
+	return nil
+}
+
+// setUpdate returns update pipeline which set value and expire time, and
+// increases version of live document or restarts version of expired one.
+// Update pipeline requires MongoDB 4.2 or later.
+// Fields are evaluated against the document before update, and values are
+// wrapped by $literal since string starts with $ means field path.
+func (m *mongoDB) setUpdate(key string, value interface{}, expireAt,
+	now time.Time) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "v", Value: bson.D{{Key: "$literal", Value: value}}},
+		{Key: "pid", Value: bson.D{
+			{Key: "$literal", Value: m.option.ParentKey(key)},
+		}},
+		{Key: "exp", Value: expireAt},
+		{Key: "ver", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{"$exp", now}}},
+			bson.D{{Key: "$add", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$ver", int64(0)}}},
+				int64(1),
 			}}},
-		options.Update().SetUpsert(true),
-	)
-	return err
+			int64(1),
+		}}}},
+	}}}}
 }
 
 func (m *mongoDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return m.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (m *mongoDB) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
 	}
-	if st.ExpireAt.IsZero() {
-		st.ExpireAt = maxDatetime
+	entries, err := internal.Entries(kvPairs,
+		internal.ExpireTime(&st, time.Now()))
+	if err != nil {
+		return err
 	}
-	if len(kvPairs)%2 != 0 {
-		return kvdb.ErrorKeyValuePairs
+	return m.SetEntriesContext(ctx, entries)
+}
+
+func (m *mongoDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return m.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+// SetBytesContext store value as binary, since string of BSON should be valid
+// UTF-8.
+func (m *mongoDB) SetBytesContext(ctx context.Context, key string,
+	value []byte, opts ...kvdb.SetOption) error {
+	return m.set(ctx, key, primitive.Binary{Data: value}, opts...)
+}
+
+func (m *mongoDB) SetEntries(entries []kvdb.Entry) error {
+	return m.SetEntriesContext(context.Background(), entries)
+}
+
+func (m *mongoDB) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if len(entries) == 0 {
+		return nil
 	}
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
-	var oprs []mongo.WriteModel
-	for i := 0; i < len(kvPairs)/2; i++ {
+	defer m.hookReq(now)
+	unlock := m.hub.Lock()
+	defer unlock()
+	oprs := make([]mongo.WriteModel, len(entries))
+	for i, e := range entries {
+		if e.ExpireAt.IsZero() {
+			e.ExpireAt = maxDatetime
+		}
 		opr := mongo.NewUpdateOneModel()
 		opr.SetFilter(bson.D{
-			{Key: "_id", Value: kvPairs[i*2]},
+			{Key: "_id", Value: e.Key},
 		})
-		opr.SetUpdate(bson.D{{Key: "$set", Value: bson.D{
-			{Key: "v", Value: kvPairs[i*2+1]},
-			{Key: "pid", Value: m.option.ParentKey(kvPairs[i*2])},
-			{Key: "exp", Value: st.ExpireAt},
-		}}})
+		opr.SetUpdate(m.setUpdate(e.Key, e.Value, e.ExpireAt, now))
 		opr.SetUpsert(true)
-		oprs = append(oprs, opr)
+		oprs[i] = opr
 	}
-	_, err := m.collection.BulkWrite(context.TODO(), oprs)
-	return err
+	if _, err := m.collection.BulkWrite(ctx, oprs); err != nil {
+		return err
+	}
+	m.hub.SetEntries(entries)
+	return nil
 }
 
-func (m *mongoDB) Delete(key string, opts ...kvdb.DeleteOption) error {
-	var dt kvdb.Deleter
+func (m *mongoDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return m.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (m *mongoDB) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
 	for _, opt := range opts {
-		opt(&dt)
+		opt(&st)
 	}
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
-	filter := bson.D{
+	defer m.hookReq(now)
+	expireAt := internal.ExpireTime(&st, now)
+	if expireAt.IsZero() {
+		expireAt = maxDatetime
+	}
+	unlock := m.hub.Lock()
+	defer unlock()
+	ok, err := m.insert(ctx, key, value, expireAt, now)
+	if ok {
+		m.notifySet(key, value, expireAt)
+	}
+	return ok, err
+}
+
+// insert write document only if key not exists or expired, and returns if
+// document is written.
+func (m *mongoDB) insert(ctx context.Context, key string, value interface{},
+	expireAt, now time.Time) (bool, error) {
+	// upsert matches only expired document, so inserting a live key
+	// conflicts on _id
+	_, err := m.collection.UpdateOne(ctx, bson.D{
 		{Key: "_id", Value: key},
+		{Key: "exp", Value: bson.D{
+			{Key: "$lte", Value: now},
+		}},
+	}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "v", Value: value},
+		{Key: "pid", Value: m.option.ParentKey(key)},
+		{Key: "exp", Value: expireAt},
+		{Key: "ver", Value: int64(1)},
+	}}}, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
 	}
-	if dt.Children {
-		filter = bson.D{
-			{Key: "$or", Value: bson.A{
-				filter,
-				bson.D{{Key: "pid", Value: key}},
+	return true, nil
+}
+
+func (m *mongoDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return m.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (m *mongoDB) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	expireAt := internal.ExpireTime(&st, now)
+	if expireAt.IsZero() {
+		expireAt = maxDatetime
+	}
+	unlock := m.hub.Lock()
+	defer unlock()
+	rst, err := m.collection.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: key},
+		// value set by SetBytes is stored as binary
+		{Key: "v", Value: bson.D{{Key: "$in", Value: bson.A{
+			old, primitive.Binary{Data: []byte(old)},
+		}}}},
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "v", Value: new},
+			{Key: "exp", Value: expireAt},
+		}},
+		{Key: "$inc", Value: bson.D{
+			{Key: "ver", Value: int64(1)},
+		}},
+	})
+	if err != nil || rst.MatchedCount == 0 {
+		return false, err
+	}
+	m.notifySet(key, new, expireAt)
+	return true, nil
+}
+
+func (m *mongoDB) Incr(key string, delta int64) (int64, error) {
+	return m.IncrContext(context.Background(), key, delta)
+}
+
+// IncrContext increase value by an update pipeline, since value is stored as
+// string which could not be increased by $inc directly. Like `setUpdate()`, it
+// requires MongoDB 4.2 or later. Expired document is treated as 0, and live
+// document is only matched if value is an integer in canonical form and the
+// result doesn't overflow, otherwise upsert fails by duplicate _id and the
+// error is told by `incrError()`.
+func (m *mongoDB) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	start := time.Now()
+	defer m.hookReq(start)
+	unlock := m.hub.Lock()
+	defer unlock()
+	for i := 1; ; i++ {
+		now := time.Now()
+		var result bson.M
+		err := m.collection.FindOneAndUpdate(ctx, m.incrFilter(key, delta, now),
+			m.incrUpdate(key, delta, now), options.FindOneAndUpdate().
+				SetUpsert(true).
+				SetReturnDocument(options.After)).Decode(&result)
+		if err == nil {
+			v, _ := result["v"].(string)
+			m.hub.Update(key, v)
+			return strconv.ParseInt(v, 10, 64)
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+		// duplicate _id is also caused by concurrent upsert, or value is
+		// changed since update, which should be retried
+		if err := m.incrError(ctx, key, delta, now); err != nil {
+			return 0, err
+		}
+		if i == maxIncrRetries {
+			return 0, err
+		}
+	}
+}
+
+// incrFilter returns filter of document which is expired, or has a value
+// could be increased by delta.
+func (m *mongoDB) incrFilter(key string, delta int64, now time.Time) bson.D {
+	in := bson.A{bson.D{{Key: "$eq", Value: bson.A{
+		bson.D{{Key: "$toString", Value: "$$n"}}, "$v",
+	}}}}
+	if delta > 0 {
+		in = append(in, bson.D{{Key: "$lte", Value: bson.A{
+			"$$n", math.MaxInt64 - delta,
+		}}})
+	} else if delta < 0 {
+		in = append(in, bson.D{{Key: "$gte", Value: bson.A{
+			"$$n", math.MinInt64 - delta,
+		}}})
+	}
+	return bson.D{
+		{Key: "_id", Value: key},
+		{Key: "$expr", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "$lte", Value: bson.A{"$exp", now}}},
+			bson.D{{Key: "$let", Value: bson.D{
+				{Key: "vars", Value: bson.D{{Key: "n", Value: bson.D{
+					{Key: "$convert", Value: bson.D{
+						{Key: "input", Value: "$v"},
+						{Key: "to", Value: "long"},
+						{Key: "onError", Value: nil},
+						{Key: "onNull", Value: nil},
+					}},
+				}}}},
+				{Key: "in", Value: bson.D{{Key: "$and", Value: in}}},
+			}}},
+		}}}},
+	}
+}
+
+// incrUpdate returns update pipeline which increases value of document
+// matched by `incrFilter()`.
+func (m *mongoDB) incrUpdate(key string, delta int64,
+	now time.Time) mongo.Pipeline {
+	live := bson.D{{Key: "$gt", Value: bson.A{"$exp", now}}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "v", Value: bson.D{{Key: "$toString", Value: bson.D{
+			{Key: "$add", Value: bson.A{
+				bson.D{{Key: "$cond", Value: bson.A{
+					live,
+					bson.D{{Key: "$toLong", Value: "$v"}},
+					int64(0),
+				}}},
+				delta,
 			}},
+		}}}},
+		{Key: "pid", Value: bson.D{
+			{Key: "$literal", Value: m.option.ParentKey(key)},
+		}},
+		{Key: "exp", Value: bson.D{{Key: "$cond", Value: bson.A{
+			live, "$exp", maxDatetime,
+		}}}},
+		{Key: "ver", Value: bson.D{{Key: "$cond", Value: bson.A{
+			live,
+			bson.D{{Key: "$add", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$ver", int64(0)}}},
+				int64(1),
+			}}},
+			int64(1),
+		}}}},
+	}}}}
+}
+
+// incrError returns why live document of key is not matched by
+// `incrFilter()`, which is kvdb.ErrorNotInteger or kvdb.ErrorOverflow, nil
+// means document is changed since update.
+func (m *mongoDB) incrError(ctx context.Context, key string, delta int64,
+	now time.Time) error {
+	var result bson.M
+	err := m.collection.FindOne(ctx, bson.D{
+		{Key: "_id", Value: key},
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
 		}
+		return err
 	}
-	_, err := m.collection.DeleteMany(context.TODO(), filter)
-	return err
+	v, ok := result["v"].(string)
+	if !ok {
+		return kvdb.ErrorNotInteger
+	}
+	n, err := internal.Incr(v, delta)
+	if err != nil {
+		return err
+	}
+	// not in canonical form, such as +1 or 01
+	if strconv.FormatInt(n-delta, 10) != v {
+		return kvdb.ErrorNotInteger
+	}
+	return nil
+}
+
+func (m *mongoDB) Commit(txn *kvdb.Txn) (bool, error) {
+	return m.CommitContext(context.Background(), txn)
+}
+
+// CommitContext commit txn by a session transaction, which is only available
+// for replica set or sharded cluster, kvdb.ErrorTxnUnsupported is returned for
+// standalone server.
+func (m *mongoDB) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn == nil {
+		return true, nil
+	}
+	if err := internal.CheckTxn(txn); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	unlock := m.hub.Lock()
+	defer unlock()
+	sess, err := m.collection.Database().Client().StartSession()
+	if err != nil {
+		return false, err
+	}
+	defer sess.EndSession(ctx)
+	var ok bool
+	deleted := make([]bool, len(txn.Ops))
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext,
+	) (interface{}, error) {
+		var err error
+		ok, err = internal.CondsHold(txn.Conds, func(key string,
+		) (string, bool, error) {
+			var row bson.M
+			err := m.collection.FindOne(sc, bson.D{
+				{Key: "_id", Value: key},
+				{Key: "exp", Value: bson.D{
+					{Key: "$gt", Value: now},
+				}},
+			}).Decode(&row)
+			if err != nil {
+				if errors.Is(err, mongo.ErrNoDocuments) {
+					return "", false, nil
+				}
+				return "", false, err
+			}
+			return value(row), true, nil
+		})
+		if err != nil || !ok {
+			return nil, err
+		}
+		for i, op := range txn.Ops {
+			switch op.Type {
+			case kvdb.OpSet:
+				expireAt := internal.ExpireTime(&op.Setter, now)
+				if expireAt.IsZero() {
+					expireAt = maxDatetime
+				}
+				_, err = m.collection.UpdateOne(sc, bson.D{
+					{Key: "_id", Value: op.Key},
+				}, m.setUpdate(op.Key, op.Value, expireAt, now),
+					options.Update().SetUpsert(true))
+			case kvdb.OpDelete:
+				var rst *mongo.DeleteResult
+				rst, err = m.collection.DeleteMany(sc,
+					m.deleteFilter(op.Key, &op.Deleter))
+				if err == nil {
+					deleted[i] = rst.DeletedCount > 0
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		if txnUnsupported(err) {
+			return false, kvdb.ErrorTxnUnsupported
+		}
+		return false, err
+	}
+	if ok {
+		m.hub.Commit(txn, deleted, now)
+	}
+	return ok, nil
+}
+
+// txnUnsupported returns if err is caused by transaction on standalone server,
+// which fails with code IllegalOperation.
+func txnUnsupported(err error) bool {
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.Code == 20
+}
+
+func (m *mongoDB) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return m.DeleteContext(context.Background(), key, opts...)
+}
+
+func (m *mongoDB) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	var dt kvdb.Deleter
+	for _, opt := range opts {
+		opt(&dt)
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	unlock := m.hub.Lock()
+	defer unlock()
+	rst, err := m.collection.DeleteMany(ctx, m.deleteFilter(key, &dt))
+	if err != nil {
+		return err
+	}
+	if rst.DeletedCount > 0 {
+		m.hub.Delete(key, &dt)
+	}
+	return nil
 }
 
 func (m *mongoDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return m.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (m *mongoDB) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
@@ -255,39 +834,116 @@ func (m *mongoDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
 		return nil
 	}
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
-	var ids bson.A
+	defer m.hookReq(now)
+	unlock := m.hub.Lock()
+	defer unlock()
+	// keys are deleted one by one to know if anything is deleted for each
 	for _, key := range keys {
-		ids = append(ids, key)
+		rst, err := m.collection.DeleteMany(ctx, m.deleteFilter(key, &dt))
+		if err != nil {
+			return err
+		}
+		if rst.DeletedCount > 0 {
+			m.hub.Delete(key, &dt)
+		}
 	}
+	return nil
+}
+
+// deleteFilter returns filter of key with it's children or descendants
+// specified by dt.
+func (m *mongoDB) deleteFilter(key string, dt *kvdb.Deleter) bson.D {
 	filter := bson.D{
-		{Key: "_id", Value: bson.D{
-			{Key: "$in", Value: ids},
-		}},
+		{Key: "_id", Value: key},
 	}
 	if dt.Children {
 		filter = bson.D{
 			{Key: "$or", Value: bson.A{
 				filter,
-				bson.D{
-					{Key: "pid", Value: bson.D{
-						{Key: "$in", Value: ids},
-					}},
-				},
+				bson.D{{Key: "pid", Value: key}},
 			}},
 		}
 	}
-	_, err := m.collection.DeleteMany(context.TODO(), filter)
-	return err
+	if dt.Descendants {
+		filter = bson.D{
+			{Key: "$or", Value: bson.A{
+				filter,
+				bson.D{m.descendantFilter(key)},
+			}},
+		}
+	}
+	return filter
+}
+
+func (m *mongoDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return m.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (m *mongoDB) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	if limit == 0 {
+		limit = m.option.DefaultLimit
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	lower, _ := internal.ChildBounds(m.option, parent,
+		&kvdb.Getter{Start: start})
+	opt := options.Find().
+		SetProjection(bson.D{{Key: "_id", Value: 1}}).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	if limit > 0 {
+		opt.SetLimit(int64(limit))
+	}
+	cur, err := m.collection.Find(
+		ctx, bson.D{
+			{Key: "pid", Value: parent},
+			{Key: "exp", Value: bson.D{
+				{Key: "$gt", Value: now},
+			}},
+			{Key: "_id", Value: bson.D{
+				{Key: "$gt", Value: lower},
+			}},
+		}, opt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.M
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(docs))
+	for i, doc := range docs {
+		keys[i] = doc["_id"].(string)
+	}
+	if ls.BareKey {
+		keys = internal.BareKeys(m.option, keys)
+	}
+	return keys, nil
 }
 
 func (m *mongoDB) Exist(key string) (bool, error) {
+	return m.ExistContext(context.Background(), key)
+}
+
+func (m *mongoDB) ExistContext(ctx context.Context, key string) (bool, error) {
 	now := time.Now()
-	defer m.hookReq(time.Since(now))
+	defer m.hookReq(now)
 	var result bson.M
-	err := m.collection.FindOne(context.TODO(), bson.D{{
-		Key: "_id", Value: key,
-	}}).Decode(&result)
+	err := m.collection.FindOne(ctx, bson.D{
+		{Key: "_id", Value: key},
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}, options.FindOne().SetProjection(
+		bson.D{{Key: "_id", Value: 1}},
+	)).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return false, nil
@@ -297,8 +953,156 @@ func (m *mongoDB) Exist(key string) (bool, error) {
 	return true, nil
 }
 
+func (m *mongoDB) ExistMulti(keys []string) (map[string]bool, error) {
+	return m.ExistMultiContext(context.Background(), keys)
+}
+
+func (m *mongoDB) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	now := time.Now()
+	defer m.hookReq(now)
+	v := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return v, nil
+	}
+	cur, err := m.collection.Find(ctx, bson.D{
+		{Key: "_id", Value: bson.D{
+			{Key: "$in", Value: keys},
+		}},
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.M
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		v[key] = false
+	}
+	for _, doc := range docs {
+		v[doc["_id"].(string)] = true
+	}
+	return v, nil
+}
+
+func (m *mongoDB) ExpireAt(key string) (time.Time, bool, error) {
+	return m.ExpireAtContext(context.Background(), key)
+}
+
+func (m *mongoDB) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	now := time.Now()
+	defer m.hookReq(now)
+	var result struct {
+		ExpireAt time.Time `bson:"exp"`
+	}
+	err := m.collection.FindOne(ctx, bson.D{
+		{Key: "_id", Value: key},
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}, options.FindOne().SetProjection(
+		bson.D{{Key: "exp", Value: 1}},
+	)).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	if !result.ExpireAt.Before(maxDatetime) {
+		return time.Time{}, true, nil
+	}
+	return result.ExpireAt, true, nil
+}
+
+func (m *mongoDB) Touch(key string, ttl time.Duration) (bool, error) {
+	return m.TouchContext(context.Background(), key, ttl)
+}
+
+func (m *mongoDB) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	now := time.Now()
+	defer m.hookReq(now)
+	return m.expire(ctx, key, now.Add(ttl), now)
+}
+
+func (m *mongoDB) Persist(key string) (bool, error) {
+	return m.PersistContext(context.Background(), key)
+}
+
+func (m *mongoDB) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	now := time.Now()
+	defer m.hookReq(now)
+	return m.expire(ctx, key, maxDatetime, now)
+}
+
+// expire update expire time of live key by a conditional update.
+func (m *mongoDB) expire(ctx context.Context, key string, at, now time.Time,
+) (bool, error) {
+	unlock := m.hub.Lock()
+	defer unlock()
+	rst, err := m.collection.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: key},
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "exp", Value: at},
+	}}})
+	if err != nil || rst.MatchedCount == 0 {
+		return false, err
+	}
+	if at.Equal(maxDatetime) {
+		at = time.Time{}
+	}
+	m.hub.Expire(key, at)
+	return true, nil
+}
+
+func (m *mongoDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return m.CountContext(context.Background(), key, opts...)
+}
+
+func (m *mongoDB) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	now := time.Now()
+	defer m.hookReq(now)
+	filter := bson.D{
+		{Key: "exp", Value: bson.D{
+			{Key: "$gt", Value: now},
+		}},
+	}
+	if ct.Descendants {
+		filter = append(filter, m.descendantFilter(key))
+	} else {
+		// blank key is parent of itself
+		filter = append(filter,
+			bson.E{Key: "pid", Value: key},
+			bson.E{Key: "_id", Value: bson.D{
+				{Key: "$ne", Value: key},
+			}},
+		)
+	}
+	cnt, err := m.collection.CountDocuments(ctx, filter)
+	return int(cnt), err
+}
+
 func (m *mongoDB) Cleanup() error {
-	_, err := m.collection.DeleteMany(context.TODO(), bson.D{
+	return m.CleanupContext(context.Background())
+}
+
+func (m *mongoDB) CleanupContext(ctx context.Context) error {
+	_, err := m.collection.DeleteMany(ctx, bson.D{
 		{Key: "exp", Value: bson.D{
 			{Key: "$lte", Value: time.Now()},
 		}},
@@ -306,12 +1110,70 @@ func (m *mongoDB) Cleanup() error {
 	return err
 }
 
+func (m *mongoDB) Watch(key string, recursive bool) (<-chan kvdb.Event,
+	error) {
+	return m.WatchContext(context.Background(), key, recursive)
+}
+
+// WatchContext reports writes through this instance only, change streams are
+// not used since they're unavailable for standalone server.
+func (m *mongoDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	return m.hub.Watch(ctx, key, recursive)
+}
+
 func (m *mongoDB) Close() error {
+	m.hub.Close()
 	return m.collection.Database().Client().Disconnect(context.TODO())
 }
 
-func (m *mongoDB) hookReq(score time.Duration) {
+// notifySet report key is set to watchers, maxDatetime means never expire.
+func (m *mongoDB) notifySet(key string, value interface{},
+	expireAt time.Time) {
+	if expireAt.Equal(maxDatetime) {
+		expireAt = time.Time{}
+	}
+	m.hub.Set(key, stringValue(value), expireAt)
+}
+
+// descendantFilter returns filter element to match all descendants of key.
+func (m *mongoDB) descendantFilter(key string) bson.E {
+	return bson.E{Key: "_id", Value: bson.D{
+		{Key: "$regex", Value: "^" +
+			regexp.QuoteMeta(key+m.option.KeyPathSep)},
+	}}
+}
+
+// value returns value of document as string, which is stored as binary if
+// it's set by SetBytes.
+func value(result bson.M) string {
+	return stringValue(result["v"])
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case primitive.Binary:
+		return string(v.Data)
+	}
+	return ""
+}
+
+// version returns version of document, which is missing for document written
+// before versioning.
+func version(result bson.M) int64 {
+	switch v := result["ver"].(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	}
+	return 0
+}
+
+func (m *mongoDB) hookReq(start time.Time) {
 	if m.option.AutoClean {
-		m.loadRec.HookReq(int64(score))
+		m.loadRec.HookReq(int64(time.Since(start)))
 	}
 }
@@ -44,10 +44,66 @@ func TestGetSet(t *testing.T) {
 	tests.TestGetSet(t, newDB)
 }
 
+func TestSetEntries(t *testing.T) {
+	tests.TestSetEntries(t, newDB)
+}
+
 func TestDelete(t *testing.T) {
 	tests.TestDelete(t, newDB)
 }
 
+func TestDeleteDescendants(t *testing.T) {
+	tests.TestDeleteDescendants(t, newDB)
+}
+
 func TestExist(t *testing.T) {
 	tests.TestExist(t, newDB)
 }
+
+func TestListKeys(t *testing.T) {
+	tests.TestListKeys(t, newDB)
+}
+
+func TestTTL(t *testing.T) {
+	tests.TestTTL(t, newDB)
+}
+
+func TestSetNX(t *testing.T) {
+	tests.TestSetNX(t, newDB)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tests.TestCompareAndSwap(t, newDB)
+}
+
+func TestCommit(t *testing.T) {
+	tests.TestCommit(t, newDB)
+}
+
+func TestVersion(t *testing.T) {
+	tests.TestVersion(t, newDB)
+}
+
+func TestIncr(t *testing.T) {
+	tests.TestIncr(t, newDB)
+}
+
+func TestBytes(t *testing.T) {
+	tests.TestBytes(t, newDB)
+}
+
+func TestTyped(t *testing.T) {
+	tests.TestTyped(t, newDB)
+}
+
+func TestWatch(t *testing.T) {
+	tests.TestWatch(t, newDB)
+}
+
+func TestCount(t *testing.T) {
+	tests.TestCount(t, newDB)
+}
+
+func TestContext(t *testing.T) {
+	tests.TestContext(t, newDB)
+}
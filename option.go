@@ -57,21 +57,41 @@ func (db *Option) FullKey(bareKey, parentKey string) string {
 }
 
 type Getter struct {
-	Children bool   `json:"children"`
-	Start    string `json:"start"`
-	Limit    int    `json:"limit"`
+	Children    bool   `json:"children"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Limit       int    `json:"limit"`
+	Reverse     bool   `json:"reverse"`
+	Descendants bool   `json:"descendants"`
+	Depth       int    `json:"depth"`
 }
 
 type GetOption func(g *Getter)
 
 type Setter struct {
-	ExpireAt time.Time `json:"expireAt"`
+	ExpireAt  time.Time     `json:"expireAt"`
+	TTL       time.Duration `json:"ttl"`
+	IfVersion bool          `json:"ifVersion"`
+	Version   int64         `json:"version"`
 }
 
 type SetOption func(s *Setter)
 
 type Deleter struct {
-	Children bool `json:"children"`
+	Children    bool `json:"children"`
+	Descendants bool `json:"descendants"`
 }
 
 type DeleteOption func(d *Deleter)
+
+type Counter struct {
+	Descendants bool `json:"descendants"`
+}
+
+type CountOption func(c *Counter)
+
+type Lister struct {
+	BareKey bool `json:"bareKey"`
+}
+
+type ListOption func(l *Lister)
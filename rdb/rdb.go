@@ -1,9 +1,12 @@
 package rdb
 
 import (
+	"context"
 	"errors"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elvinchan/kvdb"
@@ -19,20 +22,26 @@ import (
 var (
 	maxDatetime, _  = time.Parse("2006-01-02 15:04:05", "9999-12-31 23:59:59")
 	UnsupportDriver = errors.New("unsupport driver")
+	likeEscaper     = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
 )
 
+// descendantBatch is max count of parent keys in one query of descendants.
+const descendantBatch = 500
+
 type rdb struct {
 	db      *gorm.DB
 	option  *kvdb.Option
 	loadRec *internal.LoadRec
+	hub     *internal.Hub
 	close   chan struct{}
 }
 
 type rdbNode struct {
-	Key       string    `gorm:"primaryKey"`
-	ParentKey string    `gorm:"index"`
-	Value     string    `gorm:"type:text"`
+	Key       string `gorm:"primaryKey"`
+	ParentKey string `gorm:"index"`
+	Value     []byte
 	ExpireAt  time.Time `gorm:"index"`
+	Version   int64     `gorm:"not null;default:0"`
 }
 
 type DriverType int
@@ -77,6 +86,18 @@ func NewDB(driver DriverType, dsn string, opts ...kvdb.DBOption) (kvdb.KVDB, err
 	if err != nil {
 		return nil, err
 	}
+	if driver == DriverSqlite3 {
+		// SQLite allows only one writer, concurrent transactions on different
+		// connections fail with database locked instead of waiting
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err = migrateValue(db, driver); err != nil {
+		return nil, err
+	}
 	if err = db.AutoMigrate(&rdbNode{}); err != nil {
 		return nil, err
 	}
@@ -84,6 +105,7 @@ func NewDB(driver DriverType, dsn string, opts ...kvdb.DBOption) (kvdb.KVDB, err
 		db:      db,
 		option:  o,
 		loadRec: internal.DefaultLoadRec(),
+		hub:     internal.NewHub(o),
 		close:   make(chan struct{}),
 	}
 	if o.AutoClean {
@@ -96,7 +118,48 @@ func NewDB(driver DriverType, dsn string, opts ...kvdb.DBOption) (kvdb.KVDB, err
 	return &v, nil
 }
 
+// migrateValue convert text column of value created by former versions to
+// binary column, which could not be done by auto migration alone. Postgres
+// could not cast text to bytea implicitly, and SQLite keeps storage class of
+// existing values as text, which never equal to blob.
+// MySQL is left to auto migration, which modifies column in place.
+func migrateValue(db *gorm.DB, driver DriverType) error {
+	if !db.Migrator().HasTable(&rdbNode{}) {
+		return nil
+	}
+	columnTypes, err := db.Migrator().ColumnTypes(&rdbNode{})
+	if err != nil {
+		return err
+	}
+	var text bool
+	for _, c := range columnTypes {
+		if c.Name() == "value" {
+			text = strings.EqualFold(c.DatabaseTypeName(), "text")
+		}
+	}
+	if !text {
+		return nil
+	}
+	switch driver {
+	case DriverPostgres:
+		return db.Exec("ALTER TABLE rdb_nodes ALTER COLUMN value " +
+			"TYPE bytea USING convert_to(value, 'UTF8')").Error
+	case DriverSqlite3:
+		if err = db.AutoMigrate(&rdbNode{}); err != nil {
+			return err
+		}
+		return db.Exec("UPDATE rdb_nodes SET value = CAST(value AS BLOB) " +
+			"WHERE typeof(value) = 'text'").Error
+	}
+	return nil
+}
+
 func (g *rdb) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	return g.GetContext(context.Background(), key, opts...)
+}
+
+func (g *rdb) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -105,9 +168,10 @@ func (g *rdb) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
 		gt.Limit = g.option.DefaultLimit
 	}
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
+	defer g.hookReq(now)
+	db := g.db.WithContext(ctx)
 	var row rdbNode
-	err := g.db.Where("expire_at > ?", now).Where("key = ?", key).
+	err := db.Where("expire_at > ?", now).Where("key = ?", key).
 		Take(&row).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -116,23 +180,18 @@ func (g *rdb) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
 		return nil, err
 	}
 	node := kvdb.Node{
-		Value: row.Value,
+		Value:   string(row.Value),
+		Version: row.Version,
 	}
 	if gt.Children {
-		var rows []rdbNode
-		err = g.db.Where("parent_key = ?", key).
-			Where("key > ?", g.option.FullKey(
-				g.option.BareKey(gt.Start), row.Key),
-			).
-			Where("expire_at > ?", now).
-			Limit(gt.Limit).
-			Find(&rows).Error
-		if err != nil {
+		if err = g.getChildren(db, key, &node, now, &gt); err != nil {
 			return nil, err
 		}
-		node.Children = make(map[string]string, len(rows))
-		for i := range rows {
-			node.Children[rows[i].Key] = rows[i].Value
+	}
+	if gt.Descendants {
+		node.Descendants, err = g.getDescendants(db, key, now, &gt)
+		if err != nil {
+			return nil, err
 		}
 	}
 	return &node, nil
@@ -140,6 +199,11 @@ func (g *rdb) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
 
 func (g *rdb) GetMulti(keys []string, opts ...kvdb.GetOption,
 ) (map[string]kvdb.Node, error) {
+	return g.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (g *rdb) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -151,9 +215,10 @@ func (g *rdb) GetMulti(keys []string, opts ...kvdb.GetOption,
 		return nil, nil
 	}
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
+	defer g.hookReq(now)
+	db := g.db.WithContext(ctx)
 	var rows []rdbNode
-	err := g.db.Where("expire_at > ?", now).
+	err := db.Where("expire_at > ?", now).
 		Where("key IN ?", keys).
 		Find(&rows).Error
 	if err != nil {
@@ -165,93 +230,534 @@ func (g *rdb) GetMulti(keys []string, opts ...kvdb.GetOption,
 	v := make(map[string]kvdb.Node, len(rows))
 	for _, row := range rows {
 		node := kvdb.Node{
-			Value: row.Value,
+			Value:   string(row.Value),
+			Version: row.Version,
 		}
 		if gt.Children && (isBareStartKey || parentStartKey == row.Key) {
-			var rows []rdbNode
-			err = g.db.Where("parent_key = ?", row.Key).
-				Where("key > ?", g.option.FullKey(
-					g.option.BareKey(gt.Start), row.Key),
-				).
+			if err = g.getChildren(db, row.Key, &node, now, &gt); err != nil {
+				return nil, err
+			}
+		}
+		if gt.Descendants {
+			node.Descendants, err = g.getDescendants(db, row.Key, now, &gt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		v[row.Key] = node
+	}
+	return v, nil
+}
+
+func (g *rdb) GetBytes(key string) ([]byte, error) {
+	return g.GetBytesContext(context.Background(), key)
+}
+
+func (g *rdb) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	node, err := g.GetContext(ctx, key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+// getChildren query children ordered by key in the direction of pagination,
+// one more row than limit is queried to tell if there are more children.
+func (g *rdb) getChildren(db *gorm.DB, key string, v *kvdb.Node,
+	now time.Time, gt *kvdb.Getter) error {
+	limit := gt.Limit
+	if limit > 0 {
+		limit++
+	}
+	lower, upper := internal.ChildBounds(g.option, key, gt)
+	query := db.Where("parent_key = ?", key).
+		Where("key > ?", lower).
+		Where("expire_at > ?", now)
+	if upper != "" {
+		query = query.Where("key < ?", upper)
+	}
+	order := "key"
+	if gt.Reverse {
+		order = "key DESC"
+	}
+	var rows []rdbNode
+	err := query.Order(order).Limit(limit).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	kvs := make([]kvdb.KV, len(rows))
+	for i := range rows {
+		kvs[i] = kvdb.KV{Key: rows[i].Key, Value: string(rows[i].Value)}
+	}
+	internal.FillChildren(v, kvs, gt.Limit)
+	return nil
+}
+
+// getDescendants query all descendants by prefix of key in one query if depth
+// is unlimited, otherwise query level by level by parent key, so that levels
+// deeper than depth are never loaded. Parent keys of a level are queried in
+// batches of descendantBatch, to keep within limit of placeholders.
+func (g *rdb) getDescendants(db *gorm.DB, key string, now time.Time,
+	gt *kvdb.Getter) (map[string]kvdb.Node, error) {
+	var rows []rdbNode
+	flat := make(map[string]string)
+	if gt.Depth <= 0 {
+		err := db.Where("key LIKE ? ESCAPE '!'", g.descendantPattern(key)).
+			Where("expire_at > ?", now).
+			Find(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			flat[rows[i].Key] = string(rows[i].Value)
+		}
+		return internal.BuildDescendants(g.option, key, flat), nil
+	}
+	parentKeys := []string{key}
+	for depth := 0; depth < gt.Depth && len(parentKeys) > 0; depth++ {
+		var childKeys []string
+		for len(parentKeys) > 0 {
+			n := len(parentKeys)
+			if n > descendantBatch {
+				n = descendantBatch
+			}
+			rows = rows[:0]
+			err := db.Where("parent_key IN ?", parentKeys[:n]).
 				Where("expire_at > ?", now).
-				Limit(gt.Limit).
 				Find(&rows).Error
 			if err != nil {
 				return nil, err
 			}
-			node.Children = make(map[string]string, len(rows))
 			for i := range rows {
-				node.Children[rows[i].Key] = rows[i].Value
+				flat[rows[i].Key] = string(rows[i].Value)
+				childKeys = append(childKeys, rows[i].Key)
 			}
+			parentKeys = parentKeys[n:]
 		}
-		v[row.Key] = node
+		parentKeys = childKeys
 	}
-	return v, nil
+	return internal.BuildDescendants(g.option, key, flat), nil
 }
 
 func (g *rdb) Set(key, value string, opts ...kvdb.SetOption) error {
+	return g.SetContext(context.Background(), key, value, opts...)
+}
+
+func (g *rdb) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
 	}
-	if st.ExpireAt.IsZero() {
-		st.ExpireAt = maxDatetime
-	}
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
+	defer g.hookReq(now)
+	unlock := g.hub.Lock()
+	defer unlock()
+	expireAt := internal.ExpireTime(&st, now)
+	if expireAt.IsZero() {
+		expireAt = maxDatetime
+	}
+	db := g.db.WithContext(ctx)
+	if st.IfVersion {
+		return g.setIfVersion(db, key, value, expireAt, st.Version, now)
+	}
 	row := rdbNode{
 		Key:       key,
 		ParentKey: g.option.ParentKey(key),
-		Value:     value,
-		ExpireAt:  st.ExpireAt,
+		Value:     []byte(value),
+		ExpireAt:  expireAt,
+		Version:   1,
+	}
+	if err := db.Clauses(g.upsert(now)).Create(&row).Error; err != nil {
+		return err
+	}
+	g.notifySet(key, value, expireAt)
+	return nil
+}
+
+// setIfVersion set value by a conditional update of live row with version, or
+// insert only if row not exists or expired for version 0.
+func (g *rdb) setIfVersion(db *gorm.DB, key, value string, expireAt time.Time,
+	version int64, now time.Time) error {
+	var ok bool
+	if version == 0 {
+		var err error
+		ok, err = g.insert(db, key, value, expireAt, now)
+		if err != nil {
+			return err
+		}
+	} else {
+		rst := db.Model(&rdbNode{}).
+			Where("key = ?", key).
+			Where("version = ?", version).
+			Where("expire_at > ?", now).
+			Updates(map[string]interface{}{
+				"value":     []byte(value),
+				"expire_at": expireAt,
+				"version":   gorm.Expr("version + 1"),
+			})
+		if rst.Error != nil {
+			return rst.Error
+		}
+		ok = rst.RowsAffected > 0
+	}
+	if !ok {
+		return &kvdb.ConflictError{Key: key, Version: version}
+	}
+	g.notifySet(key, value, expireAt)
+	return nil
+}
+
+// upsert returns conflict clause of insert, which increases version of live
+// row and restarts version of expired row.
+// Version is assigned first since MySQL uses updated value of column in later
+// assignments.
+func (g *rdb) upsert(now time.Time) clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: append(clause.Set{{
+			Column: clause.Column{Name: "version"},
+			Value: gorm.Expr("CASE WHEN rdb_nodes.expire_at > ? "+
+				"THEN rdb_nodes.version + 1 ELSE 1 END", now),
+		}}, clause.AssignmentColumns(
+			[]string{"parent_key", "value", "expire_at"},
+		)...),
 	}
-	return g.db.Clauses(clause.OnConflict{
-		UpdateAll: true,
-	}).Create(&row).Error
 }
 
 func (g *rdb) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return g.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (g *rdb) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
 	}
-	if st.ExpireAt.IsZero() {
-		st.ExpireAt = maxDatetime
+	entries, err := internal.Entries(kvPairs,
+		internal.ExpireTime(&st, time.Now()))
+	if err != nil {
+		return err
+	}
+	return g.SetEntriesContext(ctx, entries)
+}
+
+func (g *rdb) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return g.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (g *rdb) SetBytesContext(ctx context.Context, key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return g.SetContext(ctx, key, string(value), opts...)
+}
+
+func (g *rdb) SetEntries(entries []kvdb.Entry) error {
+	return g.SetEntriesContext(context.Background(), entries)
+}
+
+func (g *rdb) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	defer g.hookReq(now)
+	unlock := g.hub.Lock()
+	defer unlock()
+	db := g.db.WithContext(ctx)
+	// entries of the same key are merged with the last one winning, since
+	// upsert of postgres could not affect a row twice in one statement
+	rows := make([]rdbNode, 0, len(entries))
+	idx := make(map[string]int, len(entries))
+	for _, e := range entries {
+		if e.ExpireAt.IsZero() {
+			e.ExpireAt = maxDatetime
+		}
+		row := rdbNode{
+			Key:       e.Key,
+			ParentKey: g.option.ParentKey(e.Key),
+			Value:     []byte(e.Value),
+			ExpireAt:  e.ExpireAt,
+			Version:   1,
+		}
+		if i, ok := idx[e.Key]; ok {
+			rows[i] = row
+			continue
+		}
+		idx[e.Key] = len(rows)
+		rows = append(rows, row)
 	}
-	if len(kvPairs)%2 != 0 {
-		return kvdb.ErrorKeyValuePairs
+	if err := db.Clauses(g.upsert(now)).Create(&rows).Error; err != nil {
+		return err
+	}
+	g.hub.SetEntries(entries)
+	return nil
+}
+
+func (g *rdb) SetNX(key, value string, opts ...kvdb.SetOption) (bool, error) {
+	return g.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (g *rdb) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
 	}
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
-	var rows []rdbNode
-	for i := 0; i < len(kvPairs)/2; i++ {
-		rows = append(rows, rdbNode{
-			Key:       kvPairs[i*2],
-			ParentKey: g.option.ParentKey(kvPairs[i*2]),
-			Value:     kvPairs[i*2+1],
-			ExpireAt:  st.ExpireAt,
+	defer g.hookReq(now)
+	expireAt := internal.ExpireTime(&st, now)
+	if expireAt.IsZero() {
+		expireAt = maxDatetime
+	}
+	unlock := g.hub.Lock()
+	defer unlock()
+	ok, err := g.insert(g.db.WithContext(ctx), key, value, expireAt, now)
+	if ok {
+		g.notifySet(key, value, expireAt)
+	}
+	return ok, err
+}
+
+// insert insert row only if key not exists or expired in a transaction, and
+// returns if row is inserted.
+func (g *rdb) insert(db *gorm.DB, key, value string, expireAt, now time.Time,
+) (bool, error) {
+	var ok bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// expired row is treated as not exist, remove it so that insert
+		// could success
+		err := tx.Where("key = ?", key).
+			Where("expire_at <= ?", now).
+			Delete(&rdbNode{}).Error
+		if err != nil {
+			return err
+		}
+		rst := tx.Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&rdbNode{
+			Key:       key,
+			ParentKey: g.option.ParentKey(key),
+			Value:     []byte(value),
+			ExpireAt:  expireAt,
+			Version:   1,
 		})
+		ok = rst.RowsAffected == 1
+		return rst.Error
+	})
+	return ok && err == nil, err
+}
+
+func (g *rdb) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return g.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (g *rdb) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
 	}
-	return g.db.Clauses(clause.OnConflict{
-		UpdateAll: true,
-	}).Create(&rows).Error
+	now := time.Now()
+	defer g.hookReq(now)
+	expireAt := internal.ExpireTime(&st, now)
+	if expireAt.IsZero() {
+		expireAt = maxDatetime
+	}
+	unlock := g.hub.Lock()
+	defer unlock()
+	rst := g.db.WithContext(ctx).Model(&rdbNode{}).
+		Where("key = ?", key).
+		Where("value = ?", []byte(old)).
+		Where("expire_at > ?", now).
+		Updates(map[string]interface{}{
+			"value":     []byte(new),
+			"expire_at": expireAt,
+			"version":   gorm.Expr("version + 1"),
+		})
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	if rst.RowsAffected == 0 {
+		return false, nil
+	}
+	g.notifySet(key, new, expireAt)
+	return true, nil
+}
+
+func (g *rdb) Incr(key string, delta int64) (int64, error) {
+	return g.IncrContext(context.Background(), key, delta)
+}
+
+// IncrContext increase value of live row locked for update in a transaction,
+// since value is stored as blob and could not be increased by SQL portably.
+// Row is inserted if key not exists or expired, and it's retried in case of
+// the row is inserted concurrently.
+func (g *rdb) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	now := time.Now()
+	defer g.hookReq(now)
+	unlock := g.hub.Lock()
+	defer unlock()
+	var rst int64
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for {
+			var row rdbNode
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("key = ?", key).
+				Where("expire_at > ?", now).
+				Take(&row).Error
+			if err == nil {
+				if rst, err = internal.Incr(string(row.Value), delta); err != nil {
+					return err
+				}
+				return tx.Model(&rdbNode{}).
+					Where("key = ?", key).
+					Updates(map[string]interface{}{
+						"value":   []byte(strconv.FormatInt(rst, 10)),
+						"version": gorm.Expr("version + 1"),
+					}).Error
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			err = tx.Where("key = ?", key).
+				Where("expire_at <= ?", now).
+				Delete(&rdbNode{}).Error
+			if err != nil {
+				return err
+			}
+			ins := tx.Clauses(clause.OnConflict{
+				DoNothing: true,
+			}).Create(&rdbNode{
+				Key:       key,
+				ParentKey: g.option.ParentKey(key),
+				Value:     []byte(strconv.FormatInt(delta, 10)),
+				ExpireAt:  maxDatetime,
+				Version:   1,
+			})
+			if ins.Error != nil || ins.RowsAffected == 1 {
+				rst = delta
+				return ins.Error
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	g.hub.Update(key, strconv.FormatInt(rst, 10))
+	return rst, nil
+}
+
+func (g *rdb) Commit(txn *kvdb.Txn) (bool, error) {
+	return g.CommitContext(context.Background(), txn)
+}
+
+// CommitContext check preconditions and write operations in a transaction,
+// rows of preconditions are locked for update if the driver supports.
+func (g *rdb) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn == nil {
+		return true, nil
+	}
+	if err := internal.CheckTxn(txn); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer g.hookReq(now)
+	unlock := g.hub.Lock()
+	defer unlock()
+	var ok bool
+	deleted := make([]bool, len(txn.Ops))
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		ok, err = internal.CondsHold(txn.Conds, func(key string,
+		) (string, bool, error) {
+			var row rdbNode
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("key = ?", key).
+				Where("expire_at > ?", now).
+				Take(&row).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return "", false, nil
+				}
+				return "", false, err
+			}
+			return string(row.Value), true, nil
+		})
+		if err != nil || !ok {
+			return err
+		}
+		for i, op := range txn.Ops {
+			switch op.Type {
+			case kvdb.OpSet:
+				expireAt := internal.ExpireTime(&op.Setter, now)
+				if expireAt.IsZero() {
+					expireAt = maxDatetime
+				}
+				err = tx.Clauses(g.upsert(now)).Create(&rdbNode{
+					Key:       op.Key,
+					ParentKey: g.option.ParentKey(op.Key),
+					Value:     []byte(op.Value),
+					ExpireAt:  expireAt,
+					Version:   1,
+				}).Error
+			case kvdb.OpDelete:
+				var dels []bool
+				dels, err = g.deleteMulti(tx, []string{op.Key}, &op.Deleter)
+				if err == nil {
+					deleted[i] = dels[0]
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	g.hub.Commit(txn, deleted, now)
+	return true, nil
 }
 
 func (g *rdb) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return g.DeleteContext(context.Background(), key, opts...)
+}
+
+func (g *rdb) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
 	}
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
-	query := g.db.Where("key = ?", key)
-	if dt.Children {
-		query.Or("parent_key = ?", key)
+	defer g.hookReq(now)
+	unlock := g.hub.Lock()
+	defer unlock()
+	rst := g.deleteQuery(g.db.WithContext(ctx), key, &dt).Delete(&rdbNode{})
+	if rst.Error != nil {
+		return rst.Error
+	}
+	if rst.RowsAffected > 0 {
+		g.hub.Delete(key, &dt)
 	}
-	return query.Delete(&rdbNode{}).Error
+	return nil
 }
 
 func (g *rdb) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return g.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (g *rdb) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
@@ -260,33 +766,266 @@ func (g *rdb) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
 		return nil
 	}
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
-	query := g.db.Where("key IN ?", keys)
+	defer g.hookReq(now)
+	unlock := g.hub.Lock()
+	defer unlock()
+	var deleted []bool
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		deleted, err = g.deleteMulti(tx, keys, &dt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if deleted[i] {
+			g.hub.Delete(key, &dt)
+		}
+	}
+	return nil
+}
+
+// deleteMulti delete keys one by one, so that it returns if anything is
+// deleted for each key.
+func (g *rdb) deleteMulti(db *gorm.DB, keys []string, dt *kvdb.Deleter,
+) ([]bool, error) {
+	deleted := make([]bool, len(keys))
+	for i, key := range keys {
+		rst := g.deleteQuery(db, key, dt).Delete(&rdbNode{})
+		if rst.Error != nil {
+			return nil, rst.Error
+		}
+		deleted[i] = rst.RowsAffected > 0
+	}
+	return deleted, nil
+}
+
+// deleteQuery returns query of key with it's children or descendants
+// specified by dt.
+func (g *rdb) deleteQuery(db *gorm.DB, key string, dt *kvdb.Deleter,
+) *gorm.DB {
+	query := db.Where("key = ?", key)
 	if dt.Children {
-		query.Or("parent_key IN ?", keys)
+		query.Or("parent_key = ?", key)
+	}
+	if dt.Descendants {
+		query.Or("key LIKE ? ESCAPE '!'", g.descendantPattern(key))
 	}
-	return query.Delete(&rdbNode{}).Error
+	return query
+}
+
+func (g *rdb) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return g.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (g *rdb) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	if limit == 0 {
+		limit = g.option.DefaultLimit
+	}
+	now := time.Now()
+	defer g.hookReq(now)
+	lower, _ := internal.ChildBounds(g.option, parent,
+		&kvdb.Getter{Start: start})
+	var keys []string
+	err := g.db.WithContext(ctx).Model(&rdbNode{}).
+		Where("parent_key = ?", parent).
+		Where("key > ?", lower).
+		Where("expire_at > ?", now).
+		Order("key").
+		Limit(limit).
+		Pluck("key", &keys).Error
+	if err != nil {
+		return nil, err
+	}
+	if ls.BareKey {
+		keys = internal.BareKeys(g.option, keys)
+	}
+	return keys, nil
 }
 
 func (g *rdb) Exist(key string) (bool, error) {
+	return g.ExistContext(context.Background(), key)
+}
+
+func (g *rdb) ExistContext(ctx context.Context, key string) (bool, error) {
 	now := time.Now()
-	defer g.hookReq(time.Since(now))
+	defer g.hookReq(now)
+	db := g.db.WithContext(ctx)
 	var cnt int64
-	err := g.db.Model(&rdbNode{}).Where("key = ?", key).Count(&cnt).Error
+	err := db.Model(&rdbNode{}).
+		Where("key = ?", key).
+		Where("expire_at > ?", now).
+		Count(&cnt).Error
 	return cnt > 0, err
 }
 
+func (g *rdb) ExistMulti(keys []string) (map[string]bool, error) {
+	return g.ExistMultiContext(context.Background(), keys)
+}
+
+func (g *rdb) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	now := time.Now()
+	defer g.hookReq(now)
+	v := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return v, nil
+	}
+	var existKeys []string
+	err := g.db.WithContext(ctx).Model(&rdbNode{}).
+		Where("key IN ?", keys).
+		Where("expire_at > ?", now).
+		Pluck("key", &existKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		v[key] = false
+	}
+	for _, key := range existKeys {
+		v[key] = true
+	}
+	return v, nil
+}
+
+func (g *rdb) ExpireAt(key string) (time.Time, bool, error) {
+	return g.ExpireAtContext(context.Background(), key)
+}
+
+func (g *rdb) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	now := time.Now()
+	defer g.hookReq(now)
+	var row rdbNode
+	err := g.db.WithContext(ctx).Select("expire_at").
+		Where("expire_at > ?", now).Where("key = ?", key).
+		Take(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	if !row.ExpireAt.Before(maxDatetime) {
+		return time.Time{}, true, nil
+	}
+	return row.ExpireAt, true, nil
+}
+
+func (g *rdb) Touch(key string, ttl time.Duration) (bool, error) {
+	return g.TouchContext(context.Background(), key, ttl)
+}
+
+func (g *rdb) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	now := time.Now()
+	defer g.hookReq(now)
+	return g.expire(ctx, key, now.Add(ttl), now)
+}
+
+func (g *rdb) Persist(key string) (bool, error) {
+	return g.PersistContext(context.Background(), key)
+}
+
+func (g *rdb) PersistContext(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	defer g.hookReq(now)
+	return g.expire(ctx, key, maxDatetime, now)
+}
+
+// expire update expire time of live key by a conditional update.
+func (g *rdb) expire(ctx context.Context, key string, at, now time.Time,
+) (bool, error) {
+	unlock := g.hub.Lock()
+	defer unlock()
+	rst := g.db.WithContext(ctx).Model(&rdbNode{}).
+		Where("key = ?", key).
+		Where("expire_at > ?", now).
+		Update("expire_at", at)
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	if rst.RowsAffected == 0 {
+		return false, nil
+	}
+	if at.Equal(maxDatetime) {
+		at = time.Time{}
+	}
+	g.hub.Expire(key, at)
+	return true, nil
+}
+
+func (g *rdb) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return g.CountContext(context.Background(), key, opts...)
+}
+
+func (g *rdb) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	now := time.Now()
+	defer g.hookReq(now)
+	query := g.db.WithContext(ctx).Model(&rdbNode{}).
+		Where("expire_at > ?", now)
+	if ct.Descendants {
+		query = query.Where("key LIKE ? ESCAPE '!'", g.descendantPattern(key))
+	} else {
+		// blank key is parent of itself
+		query = query.Where("parent_key = ?", key).Where("key <> ?", key)
+	}
+	var cnt int64
+	err := query.Count(&cnt).Error
+	return int(cnt), err
+}
+
 func (g *rdb) Cleanup() error {
-	return g.db.Where("expire_at <= ?", time.Now()).Delete(&rdbNode{}).Error
+	return g.CleanupContext(context.Background())
+}
+
+func (g *rdb) CleanupContext(ctx context.Context) error {
+	return g.db.WithContext(ctx).Where("expire_at <= ?", time.Now()).Delete(&rdbNode{}).Error
+}
+
+func (g *rdb) Watch(key string, recursive bool) (<-chan kvdb.Event, error) {
+	return g.WatchContext(context.Background(), key, recursive)
+}
+
+func (g *rdb) WatchContext(ctx context.Context, key string, recursive bool,
+) (<-chan kvdb.Event, error) {
+	return g.hub.Watch(ctx, key, recursive)
 }
 
 func (g *rdb) Close() error {
 	close(g.close)
+	g.hub.Close()
 	return nil
 }
 
-func (g *rdb) hookReq(score time.Duration) {
+// notifySet report key is set to watchers, maxDatetime means never expire.
+func (g *rdb) notifySet(key, value string, expireAt time.Time) {
+	if expireAt.Equal(maxDatetime) {
+		expireAt = time.Time{}
+	}
+	g.hub.Set(key, value, expireAt)
+}
+
+// descendantPattern returns pattern of LIKE to match all descendants of key.
+func (g *rdb) descendantPattern(key string) string {
+	return likeEscaper.Replace(key+g.option.KeyPathSep) + "%"
+}
+
+func (g *rdb) hookReq(start time.Time) {
 	if g.option.AutoClean {
-		g.loadRec.HookReq(int64(score))
+		g.loadRec.HookReq(int64(time.Since(start)))
 	}
 }
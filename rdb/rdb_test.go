@@ -1,8 +1,14 @@
 package rdb
 
 import (
+	"os"
+	"strconv"
 	"testing"
 	"time"
+
+	"github.com/elvinchan/kvdb"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestMaxDatetime(t *testing.T) {
@@ -40,7 +46,7 @@ func TestCleanup(t *testing.T) {
 		if err := ormdb.db.Create(&rdbNode{
 			Key:       key,
 			ParentKey: ormdb.option.ParentKey(key),
-			Value:     "test",
+			Value:     []byte("test"),
 			ExpireAt:  now,
 		}).Error; err != nil {
 			t.Error(err)
@@ -76,3 +82,124 @@ func TestCleanup(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrateValue(t *testing.T) {
+	dsn := "migrate.db"
+	defer os.Remove(dsn)
+	// table of former versions stores value as text
+	type rdbNode struct {
+		Key       string    `gorm:"primaryKey"`
+		ParentKey string    `gorm:"index"`
+		Value     string    `gorm:"type:text"`
+		ExpireAt  time.Time `gorm:"index"`
+		Version   int64     `gorm:"not null;default:0"`
+	}
+	old, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = old.AutoMigrate(&rdbNode{}); err != nil {
+		t.Fatal(err)
+	}
+	err = old.Create(&rdbNode{
+		Key:      "a",
+		Value:    "1",
+		ExpireAt: maxDatetime,
+		Version:  1,
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := old.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDB(DriverSqlite3, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	ok, err := db.CompareAndSwap("a", "1", "2")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !ok {
+		t.Errorf("result of CompareAndSwap() not right, expect %v, got %v",
+			true, ok)
+		t.Fail()
+	}
+	rst, err := db.Get("a")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != "2" {
+		t.Errorf("result of Get() not right, expect %s, got %v", "2", rst)
+		t.Fail()
+	}
+}
+
+func TestGetDescendantsBatch(t *testing.T) {
+	db, err := NewDB(DriverSqlite3, "sqlite.db?cache=shared")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	// children of a level are more than one batch of parent keys
+	key := "batch"
+	cnt := descendantBatch*2 + 1
+	entries := []kvdb.Entry{{Key: key, Value: "0"}}
+	for i := 0; i < cnt; i++ {
+		child := key + "." + strconv.Itoa(i)
+		entries = append(entries, kvdb.Entry{Key: child, Value: "1"},
+			kvdb.Entry{Key: child + ".c", Value: "2"},
+			kvdb.Entry{Key: child + ".c.c", Value: "3"})
+	}
+	for i := 0; i < len(entries); i += 100 {
+		end := i + 100
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := db.SetEntries(entries[i:end]); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+	}
+
+	rst, err := db.Get(key, kvdb.GetDescendants(2))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if rst == nil || len(rst.Descendants) != cnt {
+		t.Errorf("length of descendants not right, expect %v, got %v",
+			cnt, rst)
+		t.FailNow()
+	}
+	for k, node := range rst.Descendants {
+		c, ok := node.Descendants[k+".c"]
+		if len(node.Descendants) != 1 || !ok || c.Value != "2" ||
+			len(c.Descendants) != 0 {
+			t.Errorf("descendants of %s not right, got %v", k,
+				node.Descendants)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package redis_test
+
+import (
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+var url string
+
+func init() {
+	mr, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	url = "redis://" + mr.Addr()
+	// miniredis does not decrease TTL automatically
+	go func() {
+		for range time.Tick(time.Millisecond * 10) {
+			mr.FastForward(time.Millisecond * 10)
+		}
+	}()
+}
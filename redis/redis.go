@@ -0,0 +1,1139 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/internal"
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	// maxRetries is max times to retry transaction of Incr or Commit if keys
+	// are written concurrently by others, with linear backoff of retryBackoff.
+	maxRetries   = 50
+	retryBackoff = time.Millisecond
+)
+
+type redisDB struct {
+	client  *redis.Client
+	option  *kvdb.Option
+	loadRec *internal.LoadRec
+	hub     *internal.Hub
+	close   chan struct{}
+}
+
+// NewDB create a KVDB instance with redis client, url should be like
+// redis://<user>:<password>@<host>:<port>/<db_number>.
+// Value of key is stored in a string with native expiry, and every parent key
+// keeps a sorted set of it's child keys for children pagination, and a sorted
+// set of it's child keys which have descendants for walking descendants.
+func NewDB(url string, opts ...kvdb.DBOption) (kvdb.KVDB, error) {
+	o := kvdb.InitOption()
+	for _, opt := range opts {
+		opt(o)
+	}
+	ro, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(ro)
+	if err = client.Ping(context.TODO()).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	v := redisDB{
+		client:  client,
+		option:  o,
+		loadRec: internal.DefaultLoadRec(),
+		hub:     internal.NewHub(o),
+		close:   make(chan struct{}),
+	}
+	if o.AutoClean {
+		go v.loadRec.StartClean(func() {
+			if err := v.Cleanup(); err != nil {
+				log.Println("cleanup error when auto clean", err)
+			}
+		}, v.close)
+	}
+	return &v, nil
+}
+
+func (r *redisDB) Get(key string, opts ...kvdb.GetOption,
+) (*kvdb.Node, error) {
+	return r.GetContext(context.Background(), key, opts...)
+}
+
+func (r *redisDB) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	if gt.Children && gt.Limit == 0 {
+		gt.Limit = r.option.DefaultLimit
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	values, err := r.client.MGet(ctx, r.nodeKey(key),
+		r.versionKey(key)).Result()
+	if err != nil {
+		return nil, err
+	} else if values[0] == nil {
+		return nil, nil
+	}
+	node := kvdb.Node{
+		Value:   values[0].(string),
+		Version: r.version(values[1]),
+	}
+	isBareStartKey := r.option.IsBareKey(gt.Start)
+	parentStartKey := r.option.ParentKey(gt.Start)
+	if gt.Children && (isBareStartKey || parentStartKey == key) {
+		if err = r.getChildren(ctx, key, &node, &gt); err != nil {
+			return nil, err
+		}
+	}
+	if gt.Descendants {
+		if err = r.getDescendants(ctx, key, &node, &gt); err != nil {
+			return nil, err
+		}
+	}
+	return &node, nil
+}
+
+func (r *redisDB) GetMulti(keys []string, opts ...kvdb.GetOption,
+) (map[string]kvdb.Node, error) {
+	return r.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (r *redisDB) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	if gt.Children && gt.Limit == 0 {
+		gt.Limit = r.option.DefaultLimit
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	values, err := r.client.MGet(ctx,
+		append(r.nodeKeys(keys), r.versionKeys(keys)...)...).Result()
+	if err != nil {
+		return nil, err
+	}
+	isBareStartKey := r.option.IsBareKey(gt.Start)
+	parentStartKey := r.option.ParentKey(gt.Start)
+	v := make(map[string]kvdb.Node, len(keys))
+	for i, value := range values[:len(keys)] {
+		if value == nil {
+			continue
+		}
+		node := kvdb.Node{
+			Value:   value.(string),
+			Version: r.version(values[len(keys)+i]),
+		}
+		if gt.Children && (isBareStartKey || parentStartKey == keys[i]) {
+			if err = r.getChildren(ctx, keys[i], &node, &gt); err != nil {
+				return nil, err
+			}
+		}
+		if gt.Descendants {
+			if err = r.getDescendants(ctx, keys[i], &node, &gt); err != nil {
+				return nil, err
+			}
+		}
+		v[keys[i]] = node
+	}
+	return v, nil
+}
+
+func (r *redisDB) GetBytes(key string) ([]byte, error) {
+	return r.GetBytesContext(context.Background(), key)
+}
+
+func (r *redisDB) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	node, err := r.GetContext(ctx, key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+// getChildren query child keys by ZRANGEBYLEX, since expired keys may remain
+// in the sorted set until cleanup, it may query multiple times to fill limit.
+func (r *redisDB) getChildren(ctx context.Context, key string, v *kvdb.Node,
+	gt *kvdb.Getter) error {
+	var kvs []kvdb.KV
+	// one more child to tell if has more
+	want := gt.Limit + 1
+	lower, upper := internal.ChildBounds(r.option, key, gt)
+	min, max := "("+lower, "+"
+	if upper != "" {
+		max = "(" + upper
+	}
+	for {
+		var count int64
+		if gt.Limit > 0 {
+			count = int64(want - len(kvs))
+		}
+		rg := &redis.ZRangeBy{
+			Min:   min,
+			Max:   max,
+			Count: count,
+		}
+		var keys []string
+		var err error
+		if gt.Reverse {
+			keys, err = r.client.ZRevRangeByLex(ctx, r.childrenKey(key), rg).Result()
+		} else {
+			keys, err = r.client.ZRangeByLex(ctx, r.childrenKey(key), rg).Result()
+		}
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			break
+		}
+		values, err := r.client.MGet(ctx, r.nodeKeys(keys)...).Result()
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			if value != nil {
+				kvs = append(kvs, kvdb.KV{Key: keys[i], Value: value.(string)})
+			}
+		}
+		if gt.Limit <= 0 || len(kvs) >= want || int64(len(keys)) < count {
+			break
+		}
+		if gt.Reverse {
+			max = "(" + keys[len(keys)-1]
+		} else {
+			min = "(" + keys[len(keys)-1]
+		}
+	}
+	internal.FillChildren(v, kvs, gt.Limit)
+	return nil
+}
+
+// getDescendants walk sorted sets of children level by level, with one
+// pipelined ZRANGE and one MGET for every level.
+func (r *redisDB) getDescendants(ctx context.Context, key string, v *kvdb.Node,
+	gt *kvdb.Getter) error {
+	flat := make(map[string]string)
+	parentKeys := []string{key}
+	for depth := 1; gt.Depth <= 0 || depth <= gt.Depth; depth++ {
+		cmds := make([]*redis.StringSliceCmd, len(parentKeys))
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i := range parentKeys {
+				cmds[i] = pipe.ZRange(ctx, r.childrenKey(parentKeys[i]), 0, -1)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		var keys []string
+		for _, cmd := range cmds {
+			for _, k := range cmd.Val() {
+				// blank key is parent of top level keys, which are not it's
+				// descendants
+				if internal.InDepth(r.option, k, key, depth) {
+					keys = append(keys, k)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			break
+		}
+		values, err := r.client.MGet(ctx, r.nodeKeys(keys)...).Result()
+		if err != nil {
+			return err
+		}
+		parentKeys = parentKeys[:0]
+		for i, value := range values {
+			if value != nil {
+				flat[keys[i]] = value.(string)
+				parentKeys = append(parentKeys, keys[i])
+			}
+		}
+	}
+	v.Descendants = internal.BuildDescendants(r.option, key, flat)
+	return nil
+}
+
+func (r *redisDB) Set(key, value string, opts ...kvdb.SetOption) error {
+	return r.SetContext(context.Background(), key, value, opts...)
+}
+
+func (r *redisDB) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	if !st.IfVersion {
+		return r.SetMultiContext(ctx, []string{key, value}, opts...)
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	expireAt := internal.ExpireTime(&st, now)
+	ok, err := r.modify(ctx, []string{key}, func(tx *redis.Tx) (bool, error) {
+		values, err := tx.MGet(ctx, r.nodeKey(key), r.versionKey(key)).Result()
+		if err != nil {
+			return false, err
+		}
+		var version int64
+		if values[0] != nil {
+			version = r.version(values[1])
+		}
+		if version != st.Version {
+			return false, nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.set(ctx, pipe, key, value, expireAt)
+			return nil
+		})
+		return err == nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &kvdb.ConflictError{Key: key, Version: st.Version}
+	}
+	r.hub.Set(key, value, expireAt)
+	return nil
+}
+
+func (r *redisDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return r.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (r *redisDB) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	entries, err := internal.Entries(kvPairs,
+		internal.ExpireTime(&st, time.Now()))
+	if err != nil {
+		return err
+	}
+	return r.SetEntriesContext(ctx, entries)
+}
+
+func (r *redisDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return r.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (r *redisDB) SetBytesContext(ctx context.Context, key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return r.SetContext(ctx, key, string(value), opts...)
+}
+
+func (r *redisDB) SetEntries(entries []kvdb.Entry) error {
+	return r.SetEntriesContext(context.Background(), entries)
+}
+
+func (r *redisDB) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range entries {
+			r.set(ctx, pipe, e.Key, e.Value, e.ExpireAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.hub.SetEntries(entries)
+	return nil
+}
+
+func (r *redisDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return r.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (r *redisDB) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	expireAt := internal.ExpireTime(&st, now)
+	ok, err := r.modify(ctx, []string{key}, func(tx *redis.Tx) (bool, error) {
+		n, err := tx.Exists(ctx, r.nodeKey(key)).Result()
+		if err != nil || n > 0 {
+			return false, err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.set(ctx, pipe, key, value, expireAt)
+			return nil
+		})
+		return err == nil, err
+	})
+	if ok {
+		r.hub.Set(key, value, expireAt)
+	}
+	return ok, err
+}
+
+func (r *redisDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return r.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (r *redisDB) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	expireAt := internal.ExpireTime(&st, now)
+	ok, err := r.modify(ctx, []string{key}, func(tx *redis.Tx) (bool, error) {
+		v, err := tx.Get(ctx, r.nodeKey(key)).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return false, nil
+			}
+			return false, err
+		}
+		if v != old {
+			return false, nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.set(ctx, pipe, key, new, expireAt)
+			return nil
+		})
+		return err == nil, err
+	})
+	if ok {
+		r.hub.Set(key, new, expireAt)
+	}
+	return ok, err
+}
+
+func (r *redisDB) Incr(key string, delta int64) (int64, error) {
+	return r.IncrContext(context.Background(), key, delta)
+}
+
+// IncrContext check value is an integer in canonical form which INCRBY
+// accepts, and the result doesn't overflow, with key watched before INCRBY, so
+// that INCRBY never fails after version is increased in MULTI. It's retried
+// with `backoff()` in case of concurrent write. Native expiry of key is kept
+// by INCRBY.
+func (r *redisDB) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	for i := 1; ; i++ {
+		var rst int64
+		ok, err := r.modify(ctx, []string{key}, func(tx *redis.Tx) (bool, error) {
+			v, err := tx.Get(ctx, r.nodeKey(key)).Result()
+			if err != nil {
+				if !errors.Is(err, redis.Nil) {
+					return false, err
+				}
+				v = "0"
+			}
+			if rst, err = internal.Incr(v, delta); err != nil {
+				return false, err
+			}
+			// INCRBY rejects integer not in canonical form, such as +1 or 01
+			if strconv.FormatInt(rst-delta, 10) != v {
+				return false, kvdb.ErrorNotInteger
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.IncrBy(ctx, r.nodeKey(key), delta)
+				pipe.Incr(ctx, r.versionKey(key))
+				r.link(ctx, pipe, key)
+				return nil
+			})
+			return err == nil, err
+		})
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			r.hub.Update(key, strconv.FormatInt(rst, 10))
+			return rst, nil
+		}
+		if err := backoff(ctx, i); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// backoff waits before the i-th retry of transaction failed by concurrent
+// write, redis.TxFailedErr is returned if it has been retried maxRetries
+// times.
+func backoff(ctx context.Context, i int) error {
+	if i >= maxRetries {
+		return redis.TxFailedErr
+	}
+	select {
+	case <-time.After(time.Duration(i) * retryBackoff):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// modify run fn with node keys of keys watched, and returns if fn writes.
+// Transaction failed by concurrent write of the keys is treated as not
+// written, the same as other backends which check and write atomically.
+func (r *redisDB) modify(ctx context.Context, keys []string,
+	fn func(tx *redis.Tx) (bool, error)) (bool, error) {
+	var ok bool
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		ok, err = fn(tx)
+		return err
+	}, r.nodeKeys(keys)...)
+	if errors.Is(err, redis.TxFailedErr) {
+		return false, nil
+	}
+	return ok && err == nil, err
+}
+
+func (r *redisDB) Commit(txn *kvdb.Txn) (bool, error) {
+	return r.CommitContext(context.Background(), txn)
+}
+
+// CommitContext check preconditions with their keys watched, and write all
+// operations in MULTI by `commit()`, which is retried with `backoff()` if any
+// watched key is written concurrently.
+func (r *redisDB) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn == nil {
+		return true, nil
+	}
+	if err := internal.CheckTxn(txn); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	condKeys := make([]string, len(txn.Conds))
+	for i, c := range txn.Conds {
+		condKeys[i] = c.Key
+	}
+	for i := 1; ; i++ {
+		dels := make([]*redis.IntCmd, len(txn.Ops))
+		pending := make([]bool, len(txn.Ops))
+		var ok bool
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			var err error
+			ok, err = r.commit(ctx, tx, txn, now, dels, pending)
+			return err
+		}, r.nodeKeys(condKeys)...)
+		if errors.Is(err, redis.TxFailedErr) {
+			if err := backoff(ctx, i); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if ok && err == nil {
+			// children set by previous operations are deleted along with key
+			deleted := make([]bool, len(txn.Ops))
+			for i := range txn.Ops {
+				deleted[i] = pending[i] || (dels[i] != nil && dels[i].Val() > 0)
+			}
+			r.hub.Commit(txn, deleted, now)
+		}
+		return ok && err == nil, err
+	}
+}
+
+// commit check preconditions of txn and write operations of txn in MULTI of
+// tx, and returns if written. Children to delete are resolved by tx with their
+// sorted sets watched, along with children set by previous operations, so
+// that MULTI fails if any child is set meanwhile.
+func (r *redisDB) commit(ctx context.Context, tx *redis.Tx, txn *kvdb.Txn,
+	now time.Time, dels []*redis.IntCmd, pending []bool) (bool, error) {
+	ok, err := internal.CondsHold(txn.Conds, func(key string,
+	) (string, bool, error) {
+		v, err := tx.Get(ctx, r.nodeKey(key)).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		return v, true, nil
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	nodeKeys := make([][]string, len(txn.Ops))
+	otherKeys := make([][]string, len(txn.Ops))
+	for i, op := range txn.Ops {
+		if op.Type != kvdb.OpDelete {
+			continue
+		}
+		nodeKeys[i], otherKeys[i], err = r.deleteKeys(ctx, tx, op.Key,
+			&op.Deleter)
+		if err != nil {
+			return false, err
+		}
+	}
+	_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, op := range txn.Ops {
+			switch op.Type {
+			case kvdb.OpSet:
+				r.set(ctx, pipe, op.Key, op.Value,
+					internal.ExpireTime(&op.Setter, now))
+			case kvdb.OpDelete:
+				dels[i] = pipe.Del(ctx, nodeKeys[i]...)
+				pipe.Del(ctx, otherKeys[i]...)
+				pipe.ZRem(ctx, r.childrenKey(r.option.ParentKey(op.Key)),
+					op.Key)
+				if op.Deleter.Descendants {
+					pipe.ZRem(ctx,
+						r.branchesKey(r.option.ParentKey(op.Key)), op.Key)
+				}
+				for _, k := range internal.PendingChildren(r.option,
+					txn.Ops, i) {
+					pending[i] = true
+					pipe.Del(ctx, r.nodeKey(k), r.versionKey(k))
+					pipe.ZRem(ctx, r.childrenKey(r.option.ParentKey(k)), k)
+				}
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
+
+func (r *redisDB) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return r.DeleteContext(context.Background(), key, opts...)
+}
+
+func (r *redisDB) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	return r.DeleteMultiContext(ctx, []string{key}, opts...)
+}
+
+func (r *redisDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return r.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (r *redisDB) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
+	var dt kvdb.Deleter
+	for _, opt := range opts {
+		opt(&dt)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	nodeKeys := make([][]string, len(keys))
+	otherKeys := make([][]string, len(keys))
+	for i, key := range keys {
+		var err error
+		nodeKeys[i], otherKeys[i], err = r.deleteKeys(ctx, nil, key, &dt)
+		if err != nil {
+			return err
+		}
+	}
+	// node keys are deleted apart for each key, so that it's known if
+	// anything is deleted
+	dels := make([]*redis.IntCmd, len(keys))
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			dels[i] = pipe.Del(ctx, nodeKeys[i]...)
+			pipe.Del(ctx, otherKeys[i]...)
+			pipe.ZRem(ctx, r.childrenKey(r.option.ParentKey(key)), key)
+			if dt.Descendants {
+				pipe.ZRem(ctx, r.branchesKey(r.option.ParentKey(key)), key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if dels[i].Val() > 0 {
+			r.hub.Delete(key, &dt)
+		}
+	}
+	return nil
+}
+
+// deleteKeys returns node keys and other redis keys to delete for key with
+// it's children or descendants specified by dt. Sorted sets are read by tx
+// after watched if tx is not nil.
+func (r *redisDB) deleteKeys(ctx context.Context, tx *redis.Tx, key string,
+	dt *kvdb.Deleter) ([]string, []string, error) {
+	nodeKeys := []string{r.nodeKey(key)}
+	otherKeys := []string{r.versionKey(key)}
+	if dt.Descendants {
+		dks, setKeys, err := r.descendantKeys(ctx, tx, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		nodeKeys = append(nodeKeys, r.nodeKeys(dks)...)
+		otherKeys = append(otherKeys, r.versionKeys(dks)...)
+		otherKeys = append(otherKeys, setKeys...)
+	} else if dt.Children {
+		var c redis.Cmdable = r.client
+		if tx != nil {
+			if err := tx.Watch(ctx, r.childrenKey(key)).Err(); err != nil {
+				return nil, nil, err
+			}
+			c = tx
+		}
+		cks, err := c.ZRange(ctx, r.childrenKey(key), 0, -1).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		nodeKeys = append(nodeKeys, r.nodeKeys(cks)...)
+		otherKeys = append(otherKeys, r.versionKeys(cks)...)
+		otherKeys = append(otherKeys, r.childrenKey(key))
+	}
+	return nodeKeys, otherKeys, nil
+}
+
+// descendantKeys returns keys of all descendants and keys of sorted sets which
+// contain them. It walks sorted sets of children and branches level by level,
+// so descendants without existing parent key are also included. Sorted sets
+// of each level are read by tx after watched if tx is not nil.
+func (r *redisDB) descendantKeys(ctx context.Context, tx *redis.Tx, key string,
+) ([]string, []string, error) {
+	var c redis.Cmdable = r.client
+	if tx != nil {
+		c = tx
+	}
+	var keys, setKeys []string
+	parentKeys := []string{key}
+	for len(parentKeys) > 0 {
+		levelSetKeys := make([]string, 0, len(parentKeys)*2)
+		for _, pk := range parentKeys {
+			levelSetKeys = append(levelSetKeys, r.childrenKey(pk),
+				r.branchesKey(pk))
+		}
+		if tx != nil {
+			if err := tx.Watch(ctx, levelSetKeys...).Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		setKeys = append(setKeys, levelSetKeys...)
+		cmds := make([]*redis.StringSliceCmd, len(levelSetKeys))
+		_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i := range levelSetKeys {
+				cmds[i] = pipe.ZRange(ctx, levelSetKeys[i], 0, -1)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		next := make(map[string]struct{})
+		for i := range parentKeys {
+			for _, k := range cmds[i*2].Val() {
+				// blank key is parent of top level keys, which are not it's
+				// descendants
+				if internal.InDepth(r.option, k, key, 0) {
+					keys = append(keys, k)
+					next[k] = struct{}{}
+				}
+			}
+			for _, k := range cmds[i*2+1].Val() {
+				if internal.InDepth(r.option, k, key, 0) {
+					next[k] = struct{}{}
+				}
+			}
+		}
+		parentKeys = parentKeys[:0]
+		for k := range next {
+			parentKeys = append(parentKeys, k)
+		}
+	}
+	return keys, setKeys, nil
+}
+
+func (r *redisDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return r.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+// ListKeysContext page through sorted set of children and check existence of
+// keys with pipelined EXISTS, until limit of live keys reached.
+func (r *redisDB) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	if limit == 0 {
+		limit = r.option.DefaultLimit
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	lower, _ := internal.ChildBounds(r.option, parent,
+		&kvdb.Getter{Start: start})
+	min := "(" + lower
+	var v []string
+	for {
+		var count int64
+		if limit > 0 {
+			count = int64(limit - len(v))
+		}
+		keys, err := r.client.ZRangeByLex(ctx, r.childrenKey(parent),
+			&redis.ZRangeBy{
+				Min:   min,
+				Max:   "+",
+				Count: count,
+			}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			break
+		}
+		cmds := make([]*redis.IntCmd, len(keys))
+		_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i := range keys {
+				cmds[i] = pipe.Exists(ctx, r.nodeKey(keys[i]))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			if cmd.Val() > 0 {
+				v = append(v, keys[i])
+			}
+		}
+		if limit <= 0 || len(v) >= limit || int64(len(keys)) < count {
+			break
+		}
+		min = "(" + keys[len(keys)-1]
+	}
+	if ls.BareKey {
+		v = internal.BareKeys(r.option, v)
+	}
+	return v, nil
+}
+
+func (r *redisDB) Exist(key string) (bool, error) {
+	return r.ExistContext(context.Background(), key)
+}
+
+func (r *redisDB) ExistContext(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	defer r.hookReq(now)
+	cnt, err := r.client.Exists(ctx, r.nodeKey(key)).Result()
+	return cnt > 0, err
+}
+
+func (r *redisDB) ExistMulti(keys []string) (map[string]bool, error) {
+	return r.ExistMultiContext(context.Background(), keys)
+}
+
+func (r *redisDB) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	now := time.Now()
+	defer r.hookReq(now)
+	v := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return v, nil
+	}
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range keys {
+			cmds[i] = pipe.Exists(ctx, r.nodeKey(keys[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		v[keys[i]] = cmd.Val() > 0
+	}
+	return v, nil
+}
+
+func (r *redisDB) ExpireAt(key string) (time.Time, bool, error) {
+	return r.ExpireAtContext(context.Background(), key)
+}
+
+// ExpireAtContext calculate expire time by PTTL, which is -2 if key is not
+// exist and -1 if key never expires.
+func (r *redisDB) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	now := time.Now()
+	defer r.hookReq(now)
+	ttl, err := r.client.PTTL(ctx, r.nodeKey(key)).Result()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	switch {
+	case ttl == -2:
+		return time.Time{}, false, nil
+	case ttl < 0:
+		return time.Time{}, true, nil
+	}
+	return now.Add(ttl), true, nil
+}
+
+func (r *redisDB) Touch(key string, ttl time.Duration) (bool, error) {
+	return r.TouchContext(context.Background(), key, ttl)
+}
+
+func (r *redisDB) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	var exists *redis.BoolCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.PExpireAt(ctx, r.nodeKey(key), now.Add(ttl))
+		pipe.PExpireAt(ctx, r.versionKey(key), now.Add(ttl))
+		return nil
+	})
+	if err != nil || !exists.Val() {
+		return false, err
+	}
+	r.hub.Expire(key, now.Add(ttl))
+	return true, nil
+}
+
+func (r *redisDB) Persist(key string) (bool, error) {
+	return r.PersistContext(context.Background(), key)
+}
+
+// PersistContext check existence in the same transaction, since PERSIST
+// returns false for key without expire time.
+func (r *redisDB) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	now := time.Now()
+	defer r.hookReq(now)
+	unlock := r.hub.Lock()
+	defer unlock()
+	var exists *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.Exists(ctx, r.nodeKey(key))
+		pipe.Persist(ctx, r.nodeKey(key))
+		pipe.Persist(ctx, r.versionKey(key))
+		return nil
+	})
+	if err != nil || exists.Val() == 0 {
+		return false, err
+	}
+	r.hub.Expire(key, time.Time{})
+	return true, nil
+}
+
+func (r *redisDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return r.CountContext(context.Background(), key, opts...)
+}
+
+// CountContext count members of sorted sets which value still exists, since
+// expired keys remain in sorted sets until cleanup.
+func (r *redisDB) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	now := time.Now()
+	defer r.hookReq(now)
+	var keys []string
+	var err error
+	if ct.Descendants {
+		keys, _, err = r.descendantKeys(ctx, nil, key)
+	} else {
+		// blank key is parent of itself
+		keys, err = r.client.ZRangeByLex(ctx, r.childrenKey(key),
+			&redis.ZRangeBy{
+				Min: "(" + key,
+				Max: "+",
+			}).Result()
+	}
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	cnt, err := r.client.Exists(ctx, r.nodeKeys(keys)...).Result()
+	return int(cnt), err
+}
+
+// Cleanup remove expired keys from sorted sets of children, since expired
+// values are deleted by redis itself.
+func (r *redisDB) Cleanup() error {
+	return r.CleanupContext(context.Background())
+}
+
+func (r *redisDB) CleanupContext(ctx context.Context) error {
+	iter := r.client.Scan(ctx, 0, r.childrenKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		setKey := iter.Val()
+		keys, err := r.client.ZRange(ctx, setKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		cmds := make([]*redis.IntCmd, len(keys))
+		_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i := range keys {
+				cmds[i] = pipe.Exists(ctx, r.nodeKey(keys[i]))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		var expiredKeys []interface{}
+		for i, cmd := range cmds {
+			if cmd.Val() == 0 {
+				expiredKeys = append(expiredKeys, keys[i])
+			}
+		}
+		if len(expiredKeys) > 0 {
+			err = r.client.ZRem(ctx, setKey, expiredKeys...).Err()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Err()
+}
+
+func (r *redisDB) Watch(key string, recursive bool) (<-chan kvdb.Event,
+	error) {
+	return r.WatchContext(context.Background(), key, recursive)
+}
+
+// WatchContext reports writes through this instance only, keyspace
+// notifications are not used since they're disabled by default.
+func (r *redisDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	return r.hub.Watch(ctx, key, recursive)
+}
+
+func (r *redisDB) Close() error {
+	close(r.close)
+	r.hub.Close()
+	return r.client.Close()
+}
+
+func (r *redisDB) hookReq(start time.Time) {
+	if r.option.AutoClean {
+		r.loadRec.HookReq(int64(time.Since(start)))
+	}
+}
+
+func (redisDB) nodeKey(key string) string {
+	return "node:" + key
+}
+
+func (r *redisDB) nodeKeys(keys []string) []string {
+	v := make([]string, len(keys))
+	for i := range keys {
+		v[i] = r.nodeKey(keys[i])
+	}
+	return v
+}
+
+// versionKey returns key of version of key, which expires at the same time as
+// node key, so version restarts after key expired.
+func (redisDB) versionKey(key string) string {
+	return "version:" + key
+}
+
+func (r *redisDB) versionKeys(keys []string) []string {
+	v := make([]string, len(keys))
+	for i := range keys {
+		v[i] = r.versionKey(keys[i])
+	}
+	return v
+}
+
+// version parse version from reply of GET, nil means key not exists.
+func (redisDB) version(v interface{}) int64 {
+	s, _ := v.(string)
+	version, _ := strconv.ParseInt(s, 10, 64)
+	return version
+}
+
+// set pipe commands to set value of key with expire time and increase version
+// of key, which should be used in transaction.
+func (r *redisDB) set(ctx context.Context, pipe redis.Pipeliner,
+	key, value string, expireAt time.Time) {
+	pipe.Set(ctx, r.nodeKey(key), value, 0)
+	pipe.Incr(ctx, r.versionKey(key))
+	if expireAt.IsZero() {
+		pipe.Persist(ctx, r.versionKey(key))
+	} else {
+		pipe.PExpireAt(ctx, r.nodeKey(key), expireAt)
+		pipe.PExpireAt(ctx, r.versionKey(key), expireAt)
+	}
+	r.link(ctx, pipe, key)
+}
+
+// link pipe commands to add key to sorted set of children of it's parent, and
+// add every ancestor of key to sorted set of branches of it's parent, so that
+// key could be reached from any ancestor even if keys between do not exist.
+func (r *redisDB) link(ctx context.Context, pipe redis.Pipeliner, key string) {
+	pk := r.option.ParentKey(key)
+	pipe.ZAdd(ctx, r.childrenKey(pk), &redis.Z{Member: key})
+	for k := pk; k != ""; k = r.option.ParentKey(k) {
+		pipe.ZAdd(ctx, r.branchesKey(r.option.ParentKey(k)),
+			&redis.Z{Member: k})
+	}
+}
+
+func (redisDB) childrenKey(key string) string {
+	return "children:" + key
+}
+
+// branchesKey returns key of sorted set of child keys of key which have
+// descendants, members are removed only when descendants of them are deleted.
+func (redisDB) branchesKey(key string) string {
+	return "branches:" + key
+}
@@ -0,0 +1,248 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/elvinchan/kvdb"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestCleanup(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer mr.Close()
+	db, err := NewDB("redis://" + mr.Addr())
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	rdb, ok := db.(*redisDB)
+	if !ok {
+		t.Error("failed covert KVDB to RedisDB instance")
+		t.Fail()
+	}
+
+	keys := []string{"inner.c", "inner.d"}
+	err = rdb.Set(keys[0], "test", func(s *kvdb.Setter) {
+		s.ExpireAt = time.Now().Add(time.Second)
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = rdb.Set(keys[1], "test")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	mr.FastForward(time.Second)
+
+	err = rdb.Cleanup()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	for i, key := range keys {
+		_, err := rdb.client.ZScore(context.TODO(),
+			rdb.childrenKey("inner"), key).Result()
+		if i == 0 && err != redis.Nil {
+			t.Errorf("err not right, expect %s, got %s", redis.Nil, err)
+			t.Fail()
+		} else if i == 1 && err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}
+}
+
+func TestDeleteDescendantsAfterCleanup(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer mr.Close()
+	db, err := NewDB("redis://" + mr.Addr())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	// parent expires and is removed from sorted set of children by cleanup,
+	// while it's child is still reachable by sorted set of branches
+	err = db.SetMulti([]string{"outer", "1", "outer.a", "2"},
+		kvdb.SetExpire(time.Now().Add(time.Second)))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set("outer.a.b", "3")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	mr.FastForward(time.Second)
+	if err = db.Cleanup(); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	n, err := db.Count("outer", kvdb.CountDescendants())
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if n != 1 {
+		t.Errorf("count not right, expect %v, got %v", 1, n)
+		t.Fail()
+	}
+	err = db.Delete("outer", kvdb.DeleteDescendants())
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	rst, err := db.Get("outer.a.b")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst != nil {
+		t.Errorf("result not right, expect nil")
+		t.Fail()
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys not right, expect empty, got %v", keys)
+		t.Fail()
+	}
+}
+
+func TestIncrNotCanonical(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer mr.Close()
+	db, err := NewDB("redis://" + mr.Addr())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	for i, v := range []string{"+5", "007", "-0"} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			key := "incr." + strconv.Itoa(i)
+			err := db.Set(key, v)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			_, err = db.Incr(key, 1)
+			if !errors.Is(err, kvdb.ErrorNotInteger) {
+				t.Errorf("err not right, expect %v, got %v",
+					kvdb.ErrorNotInteger, err)
+				t.Fail()
+			}
+			rst, err := db.Get(key)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			expect := &kvdb.Node{Value: v, Version: 1}
+			if !reflect.DeepEqual(rst, expect) {
+				t.Errorf("result not right, expect %v, got %v", expect, rst)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestCommitWatchChildren(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer mr.Close()
+	db, err := NewDB("redis://" + mr.Addr())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	rdb := db.(*redisDB)
+
+	ctx := context.TODO()
+	cases := []struct {
+		Deleter kvdb.Deleter
+		// Key is set by others after children are resolved
+		Key string
+	}{
+		{kvdb.Deleter{Children: true}, "p.b"},
+		{kvdb.Deleter{Descendants: true}, "p.b"},
+		{kvdb.Deleter{Descendants: true}, "p.a.b"},
+		{kvdb.Deleter{Descendants: true}, "p.x.y"},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			mr.FlushAll()
+			if err := db.SetMulti([]string{"p", "1", "p.a", "2"}); err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			err := rdb.client.Watch(ctx, func(tx *redis.Tx) error {
+				_, _, err := rdb.deleteKeys(ctx, tx, "p", &c.Deleter)
+				if err != nil {
+					return err
+				}
+				if err := db.Set(c.Key, "3"); err != nil {
+					return err
+				}
+				_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					pipe.Del(ctx, rdb.nodeKey("p"))
+					return nil
+				})
+				return err
+			})
+			if !errors.Is(err, redis.TxFailedErr) {
+				t.Errorf("err not right, expect %v, got %v",
+					redis.TxFailedErr, err)
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/redis"
+	"github.com/elvinchan/kvdb/tests"
+)
+
+func newDB() (kvdb.KVDB, error) {
+	return redis.NewDB(url,
+		kvdb.DefaultLimit(tests.DefaultLimit))
+}
+
+func TestNewDB(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		db, err := newDB()
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if db == nil {
+			t.Errorf("db is nil")
+			t.Fail()
+		}
+		err = db.Close()
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	})
+
+	t.Run("Abnormal", func(t *testing.T) {
+		_, err := redis.NewDB("")
+		if err == nil {
+			t.Error("err not right, expect not nil")
+			t.Fail()
+		}
+	})
+}
+
+func TestGetSet(t *testing.T) {
+	tests.TestGetSet(t, newDB)
+}
+
+func TestSetEntries(t *testing.T) {
+	tests.TestSetEntries(t, newDB)
+}
+
+func TestDelete(t *testing.T) {
+	tests.TestDelete(t, newDB)
+}
+
+func TestDeleteDescendants(t *testing.T) {
+	tests.TestDeleteDescendants(t, newDB)
+}
+
+func TestExist(t *testing.T) {
+	tests.TestExist(t, newDB)
+}
+
+func TestListKeys(t *testing.T) {
+	tests.TestListKeys(t, newDB)
+}
+
+func TestTTL(t *testing.T) {
+	tests.TestTTL(t, newDB)
+}
+
+func TestSetNX(t *testing.T) {
+	tests.TestSetNX(t, newDB)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tests.TestCompareAndSwap(t, newDB)
+}
+
+func TestCommit(t *testing.T) {
+	tests.TestCommit(t, newDB)
+}
+
+func TestVersion(t *testing.T) {
+	tests.TestVersion(t, newDB)
+}
+
+func TestIncr(t *testing.T) {
+	tests.TestIncr(t, newDB)
+}
+
+func TestBytes(t *testing.T) {
+	tests.TestBytes(t, newDB)
+}
+
+func TestTyped(t *testing.T) {
+	tests.TestTyped(t, newDB)
+}
+
+func TestWatch(t *testing.T) {
+	tests.TestWatch(t, newDB)
+}
+
+func TestCount(t *testing.T) {
+	tests.TestCount(t, newDB)
+}
+
+func TestContext(t *testing.T) {
+	tests.TestContext(t, newDB)
+}
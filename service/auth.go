@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrorAuthFailed is returned by `DialKVDBService()` if server rejects
+// credential of client.
+var ErrorAuthFailed = errors.New("kvdb: authentication failed")
+
+// ErrorPermissionDenied is returned if principal of client is not allowed to
+// call the method or access the keys by policy of server.
+var ErrorPermissionDenied = errors.New("kvdb: permission denied")
+
+// authTimeout is the longest time of authentication on connect.
+const authTimeout = time.Second * 10
+
+// AuthChallenge is sent by server on connect if authentication is required,
+// and client should answer it by AuthRequest before any call. Server replies
+// AuthResponse and then serves calls if it's accepted, or closes connection.
+type AuthChallenge struct {
+	Challenge []byte `json:"challenge"`
+}
+
+type AuthRequest struct {
+	Credential []byte `json:"credential"`
+}
+
+type AuthResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Credential answers challenge of server on connect.
+type Credential interface {
+	Answer(challenge []byte) ([]byte, error)
+}
+
+type tokenCredential string
+
+func (t tokenCredential) Answer(_ []byte) ([]byte, error) {
+	return []byte(t), nil
+}
+
+// Token returns credential which answers with token, it's better to be used
+// over TLS.
+func Token(token string) Credential {
+	return tokenCredential(token)
+}
+
+type hmacCredential struct {
+	id     string
+	secret []byte
+}
+
+func (h hmacCredential) Answer(challenge []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, h.secret)
+	_, _ = mac.Write(challenge)
+	return []byte(h.id + ":" + hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+// HMAC returns credential which answers with id and HMAC-SHA256 of challenge
+// signed by secret, in form of `id:hex`, so that secret is never sent.
+func HMAC(id string, secret []byte) Credential {
+	return hmacCredential{id: id, secret: secret}
+}
+
+// Auth authenticate to server with credential on connect, including
+// reconnect.
+func Auth(credential Credential) DialOption {
+	return func(o *dialOptions) {
+		o.credential = credential
+	}
+}
+
+// authenticate answer challenge of server on conn before any call.
+func authenticate(conn net.Conn, credential Credential) error {
+	if err := conn.SetDeadline(time.Now().Add(authTimeout)); err != nil {
+		return err
+	}
+	// messages are sent in turn, so decoder never reads ahead of response
+	dec := json.NewDecoder(conn)
+	var challenge AuthChallenge
+	if err := dec.Decode(&challenge); err != nil {
+		return err
+	}
+	answer, err := credential.Answer(challenge.Challenge)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(conn).Encode(AuthRequest{Credential: answer})
+	if err != nil {
+		return err
+	}
+	var resp AuthResponse
+	if err = dec.Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return ErrorAuthFailed
+	}
+	return conn.SetDeadline(time.Time{})
+}
@@ -0,0 +1,274 @@
+// Package gateway serves a KVDB over HTTP, so that clients other than Go could
+// use it. Key is the URL path with separator of key path replaced by slash,
+// for example, key `a.b` is served at `/a/b`, and `/` is the blank key.
+// Segment containing separator such as `/a.b` is rejected, so that a key is
+// served at only one path.
+//
+// GET returns node of key as JSON, with children by query `children=true`
+// along with `start`, `end`, `limit` and `reverse=true`, or descendants by
+// `descendants=true` along with `depth`. Value of JSON is a string which may
+// not keep binary value, `raw=true` returns value as body of
+// application/octet-stream instead. PUT sets body as value of key, with
+// time to live by `ttl` such as `30s`, and only if version matches by
+// `version`. DELETE deletes key, along with children by `children=true` or
+// descendants by `descendants=true`. HEAD returns if key exists.
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+// maxValueSize is the largest body of PUT.
+const maxValueSize = 1 << 20
+
+// Handler is an http.Handler which serves a KVDB.
+type Handler struct {
+	db  kvdb.KVDB
+	sep string
+}
+
+// Option configures Handler.
+type Option func(*Handler)
+
+// KeyPathSep specify separator of key path of db, which should be the same
+// as `kvdb.KeyPathSep()` of db. Default is separator of `kvdb.InitOption()`.
+func KeyPathSep(sep string) Option {
+	return func(h *Handler) {
+		h.sep = sep
+	}
+}
+
+// NewHandler create a Handler which serves db.
+func NewHandler(db kvdb.KVDB, opts ...Option) *Handler {
+	h := &Handler{
+		db:  db,
+		sep: kvdb.InitOption().KeyPathSep,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, err := h.key(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, key)
+	case http.MethodHead:
+		h.head(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodDelete:
+		h.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// key returns key of URL path, segments are unescaped one by one, so that
+// escaped slash is kept in key, while segment containing separator is invalid.
+func (h *Handler) key(u *url.URL) (string, error) {
+	p := strings.Trim(u.EscapedPath(), "/")
+	if p == "" {
+		return "", nil
+	}
+	segments := strings.Split(p, "/")
+	for i := range segments {
+		s, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(s, h.sep) {
+			return "", errors.New("segment contains separator of key path: " +
+				s)
+		}
+		segments[i] = s
+	}
+	return strings.Join(segments, h.sep), nil
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	var (
+		gt  kvdb.Getter
+		raw bool
+		err error
+	)
+	raw, err = boolParam(q, "raw")
+	if err == nil {
+		gt.Children, err = boolParam(q, "children")
+	}
+	if err == nil {
+		gt.Reverse, err = boolParam(q, "reverse")
+	}
+	if err == nil {
+		gt.Descendants, err = boolParam(q, "descendants")
+	}
+	if err == nil {
+		gt.Limit, err = intParam(q, "limit")
+	}
+	if err == nil {
+		gt.Depth, err = intParam(q, "depth")
+	}
+	if err == nil && raw && (gt.Children || gt.Descendants) {
+		err = errors.New("raw is not allowed with children or descendants")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if raw {
+		h.getRaw(w, r, key)
+		return
+	}
+	gt.Start, gt.End = q.Get("start"), q.Get("end")
+	node, err := h.db.GetContext(r.Context(), key, func(g *kvdb.Getter) {
+		*g = gt
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if node == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(node)
+}
+
+// getRaw writes value of key as body, so that binary value is kept as is.
+func (h *Handler) getRaw(w http.ResponseWriter, r *http.Request, key string) {
+	value, err := h.db.GetBytesContext(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if value == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	_, _ = w.Write(value)
+}
+
+func (h *Handler) head(w http.ResponseWriter, r *http.Request, key string) {
+	has, err := h.db.ExistContext(r.Context(), key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !has {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	var opts []kvdb.SetOption
+	if v := q.Get("ttl"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl: "+v, http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, kvdb.SetTTL(ttl))
+	}
+	if v := q.Get("version"); v != "" {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid version: "+v, http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, kvdb.SetIfVersion(version))
+	}
+	// read one more byte than limit, to tell exceeded body from other errors
+	value, err := ioutil.ReadAll(io.LimitReader(r.Body, maxValueSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(value) > maxValueSize {
+		http.Error(w, "value is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	err = h.db.SetBytesContext(r.Context(), key, value, opts...)
+	var conflict *kvdb.ConflictError
+	if errors.As(err, &conflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	var dt kvdb.Deleter
+	var err error
+	dt.Children, err = boolParam(q, "children")
+	if err == nil {
+		dt.Descendants, err = boolParam(q, "descendants")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.db.DeleteContext(r.Context(), key, func(d *kvdb.Deleter) {
+		*d = dt
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// boolParam returns value of query parameter name, missing means false.
+func boolParam(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("invalid " + name + ": " + v)
+	}
+	return b, nil
+}
+
+// intParam returns value of query parameter name, missing means 0.
+func intParam(q url.Values, name string) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New("invalid " + name + ": " + v)
+	}
+	return n, nil
+}
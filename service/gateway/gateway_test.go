@@ -0,0 +1,198 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/memory"
+	"github.com/elvinchan/kvdb/service/gateway"
+)
+
+func TestHandler(t *testing.T) {
+	db, err := memory.NewDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+	ts := httptest.NewServer(gateway.NewHandler(db))
+	defer ts.Close()
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		expect *kvdb.Node
+	}{
+		{http.MethodPut, "/gw/a", "1", http.StatusNoContent, nil},
+		{http.MethodPut, "/gw/a/b", "2", http.StatusNoContent, nil},
+		{http.MethodPut, "/gw/a/c?ttl=1h", "3", http.StatusNoContent, nil},
+		// escaped slash is kept in key
+		{http.MethodPut, "/gw/a%2Fd", "4", http.StatusNoContent, nil},
+		{http.MethodGet, "/gw/a", "", http.StatusOK,
+			&kvdb.Node{Value: "1", Version: 1}},
+		{http.MethodGet, "/gw/a?children=true&limit=1", "", http.StatusOK,
+			&kvdb.Node{
+				Value:     "1",
+				Version:   1,
+				Children:  map[string]string{"gw.a.b": "2"},
+				ChildList: []kvdb.KV{{Key: "gw.a.b", Value: "2"}},
+				HasMore:   true,
+				Next:      "gw.a.b",
+			}},
+		{http.MethodGet, "/gw/a%2Fd", "", http.StatusOK,
+			&kvdb.Node{Value: "4", Version: 1}},
+		{http.MethodGet, "/gw/none", "", http.StatusNotFound, nil},
+		{http.MethodGet, "/gw/a?limit=x", "", http.StatusBadRequest, nil},
+		{http.MethodGet, "/gw/none?raw=true", "", http.StatusNotFound, nil},
+		{http.MethodGet, "/gw/a?raw=true&children=true", "",
+			http.StatusBadRequest, nil},
+		{http.MethodHead, "/gw/a/b", "", http.StatusOK, nil},
+		{http.MethodHead, "/gw/none", "", http.StatusNotFound, nil},
+		{http.MethodPut, "/gw/a?version=1", "5", http.StatusNoContent, nil},
+		{http.MethodPut, "/gw/a?version=1", "6", http.StatusConflict, nil},
+		{http.MethodPut, "/gw/a?ttl=x", "6", http.StatusBadRequest, nil},
+		// segment containing separator would alias key `gw.a.b`
+		{http.MethodPut, "/gw/a.b", "6", http.StatusBadRequest, nil},
+		{http.MethodGet, "/gw/a.b", "", http.StatusBadRequest, nil},
+		{http.MethodPut, "/gw/large", strings.Repeat("x", 1<<20+1),
+			http.StatusRequestEntityTooLarge, nil},
+		{http.MethodPut, "/gw/large", strings.Repeat("x", 1<<20),
+			http.StatusNoContent, nil},
+		{http.MethodDelete, "/gw/a?children=true", "", http.StatusNoContent,
+			nil},
+		{http.MethodHead, "/gw/a", "", http.StatusNotFound, nil},
+		{http.MethodHead, "/gw/a/c", "", http.StatusNotFound, nil},
+		{http.MethodPost, "/gw/a", "", http.StatusMethodNotAllowed, nil},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			req, err := http.NewRequest(c.method, ts.URL+c.path,
+				strings.NewReader(c.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != c.status {
+				t.Errorf("status of %s %s not right, expect %d, got %d",
+					c.method, c.path, c.status, resp.StatusCode)
+				t.Fail()
+			}
+			if c.expect == nil {
+				return
+			}
+			var node kvdb.Node
+			if err = json.NewDecoder(resp.Body).Decode(&node); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&node, c.expect) {
+				t.Errorf("result of %s %s not right, expect %+v, got %+v",
+					c.method, c.path, c.expect, node)
+				t.Fail()
+			}
+		})
+	}
+
+	// value is binary safe by raw, and expires by ttl
+	bin := []byte{0, 0xff, 0xfe, 'a'}
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/gw/bin?ttl=100ms",
+		strings.NewReader(string(bin)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp, err = http.Get(ts.URL + "/gw/bin?raw=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status not right, expect %d, got %d",
+			http.StatusOK, resp.StatusCode)
+		t.Fail()
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("content type not right, expect %s, got %s",
+			"application/octet-stream", ct)
+		t.Fail()
+	}
+	if !reflect.DeepEqual(b, bin) {
+		t.Errorf("value not right, expect %v, got %v", bin, b)
+		t.Fail()
+	}
+	time.Sleep(time.Millisecond * 200)
+	resp, err = http.Head(ts.URL + "/gw/bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status not right, expect %d, got %d",
+			http.StatusNotFound, resp.StatusCode)
+		t.Fail()
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken body")
+}
+
+func TestHandlerReadError(t *testing.T) {
+	db, err := memory.NewDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+	// body which fails to read is a bad request rather than a large one
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/gw/a", errReader{})
+	gateway.NewHandler(db).ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status not right, expect %d, got %d",
+			http.StatusBadRequest, w.Code)
+		t.Fail()
+	}
+	node, err := db.Get("gw.a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node != nil {
+		t.Errorf("node not right, expect nil, got %+v", node)
+		t.Fail()
+	}
+}
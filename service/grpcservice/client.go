@@ -0,0 +1,505 @@
+package grpcservice
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"google.golang.org/grpc"
+)
+
+// Client implements kvdb.KVDB over gRPC.
+type Client struct {
+	conn *grpc.ClientConn
+	kv   KVDBClient
+}
+
+// NewClient create a Client on conn, which is closed by `Close()` of
+// client.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{
+		conn: conn,
+		kv:   NewKVDBClient(conn),
+	}
+}
+
+// Dial connect to server at target, options are the same as `grpc.Dial()`,
+// for example `grpc.WithInsecure()` or `grpc.WithTransportCredentials()`.
+func Dial(target string, opts ...grpc.DialOption) (kvdb.KVDB, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+func (c *Client) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	return c.GetContext(context.Background(), key, opts...)
+}
+
+// GetContext get children by stream, so that large child scans are not
+// limited by size of message.
+func (c *Client) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	req := &GetRequest{
+		Key:    key,
+		Getter: fromGetter(&gt),
+	}
+	if gt.Children && !gt.Descendants {
+		return c.getChildren(ctx, req)
+	}
+	resp, err := c.kv.Get(ctx, req)
+	if err != nil {
+		return nil, fromStatus(ctx, err)
+	}
+	return resp.Node.node(), nil
+}
+
+// getChildren merges pages of children streamed by server into a node.
+func (c *Client) getChildren(ctx context.Context, req *GetRequest,
+) (*kvdb.Node, error) {
+	stream, err := c.kv.GetChildren(ctx, req)
+	if err != nil {
+		return nil, fromStatus(ctx, err)
+	}
+	var node *kvdb.Node
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return node, nil
+		}
+		if err != nil {
+			return nil, fromStatus(ctx, err)
+		}
+		page := resp.Node.node()
+		if page == nil {
+			return node, nil
+		}
+		if node == nil {
+			node = page
+			continue
+		}
+		for k, v := range page.Children {
+			if node.Children == nil {
+				node.Children = make(map[string]string)
+			}
+			node.Children[k] = v
+		}
+		node.ChildList = append(node.ChildList, page.ChildList...)
+		node.HasMore, node.Next = page.HasMore, page.Next
+	}
+}
+
+func (c *Client) GetMulti(keys []string, opts ...kvdb.GetOption,
+) (map[string]kvdb.Node, error) {
+	return c.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (c *Client) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
+	var gt kvdb.Getter
+	for _, opt := range opts {
+		opt(&gt)
+	}
+	req := &GetMultiRequest{
+		Keys:   keys,
+		Getter: fromGetter(&gt),
+	}
+	resp, err := c.kv.GetMulti(ctx, req)
+	if err != nil {
+		return nil, fromStatus(ctx, err)
+	}
+	nodeMap := make(map[string]kvdb.Node, len(resp.NodeMap))
+	for k, v := range resp.NodeMap {
+		nodeMap[k] = *v.node()
+	}
+	return nodeMap, nil
+}
+
+func (c *Client) GetBytes(key string) ([]byte, error) {
+	return c.GetBytesContext(context.Background(), key)
+}
+
+func (c *Client) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	resp, err := c.kv.GetBytes(ctx, &GetBytesRequest{Key: key})
+	if err != nil {
+		return nil, fromStatus(ctx, err)
+	}
+	if resp.Exist && resp.Value == nil {
+		return []byte{}, nil
+	}
+	return resp.Value, nil
+}
+
+func (c *Client) Set(key, value string, opts ...kvdb.SetOption) error {
+	return c.SetContext(context.Background(), key, value, opts...)
+}
+
+func (c *Client) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := &SetRequest{
+		Key:    key,
+		Value:  []byte(value),
+		Setter: fromSetter(&st),
+	}
+	resp, err := c.kv.Set(ctx, req)
+	if err != nil {
+		return fromStatus(ctx, err)
+	}
+	return resp.Conflict.conflict()
+}
+
+func (c *Client) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return c.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (c *Client) SetBytesContext(ctx context.Context, key string,
+	value []byte, opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := &SetBytesRequest{
+		Key:    key,
+		Value:  value,
+		Setter: fromSetter(&st),
+	}
+	resp, err := c.kv.SetBytes(ctx, req)
+	if err != nil {
+		return fromStatus(ctx, err)
+	}
+	return resp.Conflict.conflict()
+}
+
+func (c *Client) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return c.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (c *Client) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := &SetMultiRequest{
+		KvPairs: fromStrings(kvPairs),
+		Setter:  fromSetter(&st),
+	}
+	_, err := c.kv.SetMulti(ctx, req)
+	return fromStatus(ctx, err)
+}
+
+func (c *Client) SetEntries(entries []kvdb.Entry) error {
+	return c.SetEntriesContext(context.Background(), entries)
+}
+
+func (c *Client) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	req := &SetMultiRequest{
+		Entries: fromEntries(entries),
+	}
+	_, err := c.kv.SetMulti(ctx, req)
+	return fromStatus(ctx, err)
+}
+
+func (c *Client) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return c.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (c *Client) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := &SetNXRequest{
+		Key:    key,
+		Value:  []byte(value),
+		Setter: fromSetter(&st),
+	}
+	resp, err := c.kv.SetNX(ctx, req)
+	if err != nil {
+		return false, fromStatus(ctx, err)
+	}
+	return resp.Ok, nil
+}
+
+func (c *Client) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return c.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (c *Client) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := &CompareAndSwapRequest{
+		Key:    key,
+		Old:    []byte(old),
+		New:    []byte(new),
+		Setter: fromSetter(&st),
+	}
+	resp, err := c.kv.CompareAndSwap(ctx, req)
+	if err != nil {
+		return false, fromStatus(ctx, err)
+	}
+	return resp.Swapped, nil
+}
+
+func (c *Client) Incr(key string, delta int64) (int64, error) {
+	return c.IncrContext(context.Background(), key, delta)
+}
+
+func (c *Client) IncrContext(ctx context.Context, key string,
+	delta int64) (int64, error) {
+	req := &IncrRequest{
+		Key:   key,
+		Delta: delta,
+	}
+	resp, err := c.kv.Incr(ctx, req)
+	if err != nil {
+		return 0, fromStatus(ctx, err)
+	}
+	if resp.NotInteger {
+		return 0, kvdb.ErrorNotInteger
+	}
+	return resp.Value, nil
+}
+
+func (c *Client) Commit(txn *kvdb.Txn) (bool, error) {
+	return c.CommitContext(context.Background(), txn)
+}
+
+func (c *Client) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	resp, err := c.kv.Commit(ctx, &CommitRequest{Txn: fromTxn(txn)})
+	if err != nil {
+		return false, fromStatus(ctx, err)
+	}
+	return resp.Ok, nil
+}
+
+func (c *Client) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return c.DeleteContext(context.Background(), key, opts...)
+}
+
+func (c *Client) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	var dt kvdb.Deleter
+	for _, opt := range opts {
+		opt(&dt)
+	}
+	req := &DeleteRequest{
+		Key:     key,
+		Deleter: fromDeleter(&dt),
+	}
+	_, err := c.kv.Delete(ctx, req)
+	return fromStatus(ctx, err)
+}
+
+func (c *Client) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return c.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (c *Client) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
+	var dt kvdb.Deleter
+	for _, opt := range opts {
+		opt(&dt)
+	}
+	req := &DeleteMultiRequest{
+		Keys:    keys,
+		Deleter: fromDeleter(&dt),
+	}
+	_, err := c.kv.DeleteMulti(ctx, req)
+	return fromStatus(ctx, err)
+}
+
+func (c *Client) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return c.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (c *Client) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	req := &ListKeysRequest{
+		Parent: parent,
+		Start:  start,
+		Limit:  int64(limit),
+		Lister: &Lister{BareKey: ls.BareKey},
+	}
+	resp, err := c.kv.ListKeys(ctx, req)
+	if err != nil {
+		return nil, fromStatus(ctx, err)
+	}
+	return resp.Keys, nil
+}
+
+func (c *Client) Exist(key string) (bool, error) {
+	return c.ExistContext(context.Background(), key)
+}
+
+func (c *Client) ExistContext(ctx context.Context, key string,
+) (bool, error) {
+	resp, err := c.kv.Exist(ctx, &ExistRequest{Key: key})
+	if err != nil {
+		return false, fromStatus(ctx, err)
+	}
+	return resp.Has, nil
+}
+
+func (c *Client) ExistMulti(keys []string) (map[string]bool, error) {
+	return c.ExistMultiContext(context.Background(), keys)
+}
+
+func (c *Client) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	resp, err := c.kv.ExistMulti(ctx, &ExistMultiRequest{Keys: keys})
+	if err != nil {
+		return nil, fromStatus(ctx, err)
+	}
+	return resp.HasMap, nil
+}
+
+func (c *Client) ExpireAt(key string) (time.Time, bool, error) {
+	return c.ExpireAtContext(context.Background(), key)
+}
+
+func (c *Client) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	resp, err := c.kv.ExpireAt(ctx, &ExpireAtRequest{Key: key})
+	if err != nil {
+		return time.Time{}, false, fromStatus(ctx, err)
+	}
+	return toTime(resp.ExpireAt), resp.Exist, nil
+}
+
+func (c *Client) Touch(key string, ttl time.Duration) (bool, error) {
+	return c.TouchContext(context.Background(), key, ttl)
+}
+
+func (c *Client) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	req := &TouchRequest{
+		Key: key,
+		Ttl: int64(ttl),
+	}
+	resp, err := c.kv.Touch(ctx, req)
+	if err != nil {
+		return false, fromStatus(ctx, err)
+	}
+	return resp.Exist, nil
+}
+
+func (c *Client) Persist(key string) (bool, error) {
+	return c.PersistContext(context.Background(), key)
+}
+
+func (c *Client) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	resp, err := c.kv.Persist(ctx, &PersistRequest{Key: key})
+	if err != nil {
+		return false, fromStatus(ctx, err)
+	}
+	return resp.Exist, nil
+}
+
+func (c *Client) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return c.CountContext(context.Background(), key, opts...)
+}
+
+func (c *Client) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	req := &CountRequest{
+		Key:     key,
+		Counter: &Counter{Descendants: ct.Descendants},
+	}
+	resp, err := c.kv.Count(ctx, req)
+	if err != nil {
+		return 0, fromStatus(ctx, err)
+	}
+	return int(resp.Count), nil
+}
+
+func (c *Client) Cleanup() error {
+	return c.CleanupContext(context.Background())
+}
+
+func (c *Client) CleanupContext(ctx context.Context) error {
+	_, err := c.kv.Cleanup(ctx, &CleanupRequest{})
+	return fromStatus(ctx, err)
+}
+
+func (c *Client) Watch(key string, recursive bool) (<-chan kvdb.Event,
+	error) {
+	return c.WatchContext(context.Background(), key, recursive)
+}
+
+// WatchContext receive events of watch by stream in background until ctx is
+// done, client is closed or stream fails, then the channel is closed.
+func (c *Client) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	req := &WatchRequest{
+		Key:       key,
+		Recursive: recursive,
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := c.kv.Watch(streamCtx, req)
+	if err == nil {
+		// header is sent by server once watch is registered
+		_, err = stream.Header()
+	}
+	if err != nil {
+		err = fromStatus(ctx, err)
+		cancel()
+		return nil, err
+	}
+	ch := make(chan kvdb.Event)
+	go func() {
+		defer cancel()
+		defer close(ch)
+		for {
+			e, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- e.event():
+			case <-streamCtx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,353 @@
+package grpcservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// knownErrors are errors of kvdb which are restored by client from status
+// message, so that they could be checked by `errors.Is()`.
+var knownErrors = []error{
+	kvdb.ErrorKeyValuePairs,
+	kvdb.ErrorNotInteger,
+	kvdb.ErrorOverflow,
+	kvdb.ErrorTxnUnsupported,
+	kvdb.ErrorInvalidTxn,
+}
+
+// toStatus converts err returned by db to status error of gRPC.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, kvdb.ErrorTxnUnsupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, kvdb.ErrorOverflow):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, kvdb.ErrorKeyValuePairs),
+		errors.Is(err, kvdb.ErrorInvalidTxn):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus converts status error of gRPC to error of ctx or kvdb if
+// possible.
+func fromStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, e := range knownErrors {
+		if s.Message() == e.Error() {
+			return e
+		}
+	}
+	return err
+}
+
+func fromTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func toTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func fromStrings(ss []string) [][]byte {
+	if ss == nil {
+		return nil
+	}
+	bs := make([][]byte, 0, len(ss))
+	for _, s := range ss {
+		bs = append(bs, []byte(s))
+	}
+	return bs
+}
+
+func toStrings(bs [][]byte) []string {
+	if bs == nil {
+		return nil
+	}
+	ss := make([]string, 0, len(bs))
+	for _, b := range bs {
+		ss = append(ss, string(b))
+	}
+	return ss
+}
+
+func fromGetter(gt *kvdb.Getter) *Getter {
+	return &Getter{
+		Children:    gt.Children,
+		Start:       gt.Start,
+		End:         gt.End,
+		Limit:       int64(gt.Limit),
+		Reverse:     gt.Reverse,
+		Descendants: gt.Descendants,
+		Depth:       int64(gt.Depth),
+	}
+}
+
+func (g *Getter) option() kvdb.GetOption {
+	return func(gt *kvdb.Getter) {
+		if g == nil {
+			return
+		}
+		*gt = kvdb.Getter{
+			Children:    g.Children,
+			Start:       g.Start,
+			End:         g.End,
+			Limit:       int(g.Limit),
+			Reverse:     g.Reverse,
+			Descendants: g.Descendants,
+			Depth:       int(g.Depth),
+		}
+	}
+}
+
+func fromSetter(st *kvdb.Setter) *Setter {
+	return &Setter{
+		ExpireAt:  fromTime(st.ExpireAt),
+		Ttl:       int64(st.TTL),
+		IfVersion: st.IfVersion,
+		Version:   st.Version,
+	}
+}
+
+func (s *Setter) setter() kvdb.Setter {
+	if s == nil {
+		return kvdb.Setter{}
+	}
+	return kvdb.Setter{
+		ExpireAt:  toTime(s.ExpireAt),
+		TTL:       time.Duration(s.Ttl),
+		IfVersion: s.IfVersion,
+		Version:   s.Version,
+	}
+}
+
+func (s *Setter) option() kvdb.SetOption {
+	return func(st *kvdb.Setter) {
+		*st = s.setter()
+	}
+}
+
+func fromDeleter(dt *kvdb.Deleter) *Deleter {
+	return &Deleter{
+		Children:    dt.Children,
+		Descendants: dt.Descendants,
+	}
+}
+
+func (d *Deleter) deleter() kvdb.Deleter {
+	if d == nil {
+		return kvdb.Deleter{}
+	}
+	return kvdb.Deleter{
+		Children:    d.Children,
+		Descendants: d.Descendants,
+	}
+}
+
+func (d *Deleter) option() kvdb.DeleteOption {
+	return func(dt *kvdb.Deleter) {
+		*dt = d.deleter()
+	}
+}
+
+func (c *Counter) option() kvdb.CountOption {
+	return func(ct *kvdb.Counter) {
+		if c != nil {
+			ct.Descendants = c.Descendants
+		}
+	}
+}
+
+func (l *Lister) option() kvdb.ListOption {
+	return func(ls *kvdb.Lister) {
+		if l != nil {
+			ls.BareKey = l.BareKey
+		}
+	}
+}
+
+func fromNode(node *kvdb.Node) *Node {
+	if node == nil {
+		return nil
+	}
+	n := &Node{
+		Value:   []byte(node.Value),
+		Version: node.Version,
+		HasMore: node.HasMore,
+		Next:    node.Next,
+	}
+	if node.Children != nil {
+		n.Children = make(map[string][]byte, len(node.Children))
+		for k, v := range node.Children {
+			n.Children[k] = []byte(v)
+		}
+	}
+	for _, kv := range node.ChildList {
+		n.ChildList = append(n.ChildList,
+			&KV{Key: kv.Key, Value: []byte(kv.Value)})
+	}
+	if node.Descendants != nil {
+		n.Descendants = make(map[string]*Node, len(node.Descendants))
+		for k, v := range node.Descendants {
+			v := v
+			n.Descendants[k] = fromNode(&v)
+		}
+	}
+	return n
+}
+
+func (n *Node) node() *kvdb.Node {
+	if n == nil {
+		return nil
+	}
+	node := &kvdb.Node{
+		Value:   string(n.Value),
+		Version: n.Version,
+		HasMore: n.HasMore,
+		Next:    n.Next,
+	}
+	if n.Children != nil {
+		node.Children = make(map[string]string, len(n.Children))
+		for k, v := range n.Children {
+			node.Children[k] = string(v)
+		}
+	}
+	for _, kv := range n.ChildList {
+		node.ChildList = append(node.ChildList,
+			kvdb.KV{Key: kv.Key, Value: string(kv.Value)})
+	}
+	if n.Descendants != nil {
+		node.Descendants = make(map[string]kvdb.Node, len(n.Descendants))
+		for k, v := range n.Descendants {
+			node.Descendants[k] = *v.node()
+		}
+	}
+	return node
+}
+
+func fromEntries(entries []kvdb.Entry) []*Entry {
+	es := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		es = append(es, &Entry{
+			Key:      e.Key,
+			Value:    []byte(e.Value),
+			ExpireAt: fromTime(e.ExpireAt),
+		})
+	}
+	return es
+}
+
+func toEntries(es []*Entry) []kvdb.Entry {
+	entries := make([]kvdb.Entry, 0, len(es))
+	for _, e := range es {
+		entries = append(entries, kvdb.Entry{
+			Key:      e.Key,
+			Value:    string(e.Value),
+			ExpireAt: toTime(e.ExpireAt),
+		})
+	}
+	return entries
+}
+
+func fromTxn(txn *kvdb.Txn) *Txn {
+	if txn == nil {
+		return nil
+	}
+	t := &Txn{}
+	for _, c := range txn.Conds {
+		t.Conds = append(t.Conds, &Cond{
+			Type:  CondType(c.Type),
+			Key:   c.Key,
+			Value: []byte(c.Value),
+		})
+	}
+	for _, op := range txn.Ops {
+		op := op
+		t.Ops = append(t.Ops, &Op{
+			Type:    OpType(op.Type),
+			Key:     op.Key,
+			Value:   []byte(op.Value),
+			Setter:  fromSetter(&op.Setter),
+			Deleter: fromDeleter(&op.Deleter),
+		})
+	}
+	return t
+}
+
+func (t *Txn) txn() *kvdb.Txn {
+	if t == nil {
+		return nil
+	}
+	txn := &kvdb.Txn{}
+	for _, c := range t.Conds {
+		txn.Conds = append(txn.Conds, kvdb.Cond{
+			Type:  kvdb.CondType(c.Type),
+			Key:   c.Key,
+			Value: string(c.Value),
+		})
+	}
+	for _, op := range t.Ops {
+		txn.Ops = append(txn.Ops, kvdb.Op{
+			Type:    kvdb.OpType(op.Type),
+			Key:     op.Key,
+			Value:   string(op.Value),
+			Setter:  op.Setter.setter(),
+			Deleter: op.Deleter.deleter(),
+		})
+	}
+	return txn
+}
+
+// conflict returns c as error of kvdb, or nil if c is nil.
+func (c *ConflictError) conflict() error {
+	if c == nil {
+		return nil
+	}
+	return &kvdb.ConflictError{Key: c.Key, Version: c.Version}
+}
+
+func fromEvent(e kvdb.Event) *Event {
+	return &Event{
+		Type:        EventType(e.Type),
+		Key:         e.Key,
+		Value:       []byte(e.Value),
+		Children:    e.Children,
+		Descendants: e.Descendants,
+	}
+}
+
+func (e *Event) event() kvdb.Event {
+	return kvdb.Event{
+		Type:        kvdb.EventType(e.Type),
+		Key:         e.Key,
+		Value:       string(e.Value),
+		Children:    e.Children,
+		Descendants: e.Descendants,
+	}
+}
@@ -0,0 +1,223 @@
+package grpcservice_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/memory"
+	"github.com/elvinchan/kvdb/service/grpcservice"
+	"github.com/elvinchan/kvdb/tests"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testDB is a client of server which serves a memory db over bufconn, all
+// of them are closed by `Close()`.
+type testDB struct {
+	*grpcservice.Client
+	server *grpc.Server
+	db     kvdb.KVDB
+}
+
+func (t *testDB) Close() error {
+	err := t.Client.Close()
+	t.server.Stop()
+	if dbErr := t.db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+func newDB() (kvdb.KVDB, error) {
+	db, err := memory.NewDB(kvdb.DefaultLimit(tests.DefaultLimit))
+	if err != nil {
+		return nil, err
+	}
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	grpcservice.RegisterKVDBServer(s, grpcservice.NewServer(db))
+	go func() {
+		_ = s.Serve(l)
+	}()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return l.Dial()
+		}))
+	if err != nil {
+		s.Stop()
+		_ = db.Close()
+		return nil, err
+	}
+	return &testDB{
+		Client: grpcservice.NewClient(conn),
+		server: s,
+		db:     db,
+	}, nil
+}
+
+func TestNewDB(t *testing.T) {
+	db, err := newDB()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if db == nil {
+		t.Errorf("db is nil")
+		t.Fail()
+	}
+	err = db.Close()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	tests.TestGetSet(t, newDB)
+}
+
+func TestSetEntries(t *testing.T) {
+	tests.TestSetEntries(t, newDB)
+}
+
+func TestDelete(t *testing.T) {
+	tests.TestDelete(t, newDB)
+}
+
+func TestDeleteDescendants(t *testing.T) {
+	tests.TestDeleteDescendants(t, newDB)
+}
+
+func TestExist(t *testing.T) {
+	tests.TestExist(t, newDB)
+}
+
+func TestListKeys(t *testing.T) {
+	tests.TestListKeys(t, newDB)
+}
+
+func TestTTL(t *testing.T) {
+	tests.TestTTL(t, newDB)
+}
+
+func TestSetNX(t *testing.T) {
+	tests.TestSetNX(t, newDB)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tests.TestCompareAndSwap(t, newDB)
+}
+
+func TestCommit(t *testing.T) {
+	tests.TestCommit(t, newDB)
+}
+
+func TestVersion(t *testing.T) {
+	tests.TestVersion(t, newDB)
+}
+
+func TestIncr(t *testing.T) {
+	tests.TestIncr(t, newDB)
+}
+
+func TestBytes(t *testing.T) {
+	tests.TestBytes(t, newDB)
+}
+
+func TestTyped(t *testing.T) {
+	tests.TestTyped(t, newDB)
+}
+
+func TestWatch(t *testing.T) {
+	tests.TestWatch(t, newDB)
+}
+
+func TestCount(t *testing.T) {
+	tests.TestCount(t, newDB)
+}
+
+func TestContext(t *testing.T) {
+	tests.TestContext(t, newDB)
+}
+
+func TestGetChildren(t *testing.T) {
+	db, err := newDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+	// more children than a page of stream
+	const total = 2500
+	kvs := []string{"scan", "0"}
+	for i := 0; i < total; i++ {
+		kvs = append(kvs, fmt.Sprintf("scan.%04d", i), strconv.Itoa(i))
+	}
+	if err = db.SetMulti(kvs); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		opts    []kvdb.GetOption
+		count   int
+		first   int
+		step    int
+		hasMore bool
+	}{
+		{[]kvdb.GetOption{kvdb.GetChildren("", 0)}, tests.DefaultLimit, 0, 1,
+			true},
+		{[]kvdb.GetOption{kvdb.GetChildren("", 2200)}, 2200, 0, 1, true},
+		{[]kvdb.GetOption{kvdb.GetChildren("scan.0099", 3000)}, total - 100,
+			100, 1, false},
+		{[]kvdb.GetOption{kvdb.GetChildren("", 2200),
+			kvdb.GetChildrenEnd("scan.1500")}, 1500, 0, 1, false},
+		{[]kvdb.GetOption{kvdb.GetChildrenBefore("", 1500)}, 1500, total - 1,
+			-1, true},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			node, err := db.Get("scan", c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if node == nil || node.Value != "0" {
+				t.Fatalf("node not right, got %v", node)
+			}
+			if len(node.ChildList) != c.count ||
+				len(node.Children) != c.count {
+				t.Errorf("count of children not right, expect %d, got %d, %d",
+					c.count, len(node.ChildList), len(node.Children))
+				t.FailNow()
+			}
+			for j, kv := range node.ChildList {
+				expect := fmt.Sprintf("scan.%04d", c.first+j*c.step)
+				if kv.Key != expect {
+					t.Errorf("child %d not right, expect %s, got %s",
+						j, expect, kv.Key)
+					t.FailNow()
+				}
+			}
+			if node.HasMore != c.hasMore {
+				t.Errorf("has more not right, expect %v, got %v",
+					c.hasMore, node.HasMore)
+				t.Fail()
+			}
+			next := ""
+			if c.hasMore {
+				next = node.ChildList[len(node.ChildList)-1].Key
+			}
+			if node.Next != next {
+				t.Errorf("next not right, expect %s, got %s", next, node.Next)
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,914 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package grpcservice
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion7
+
+// KVDBClient is the client API for KVDB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KVDBClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// GetChildren is the same as Get but streams children page by page, which
+	// is used for large child scans.
+	GetChildren(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (KVDB_GetChildrenClient, error)
+	GetMulti(ctx context.Context, in *GetMultiRequest, opts ...grpc.CallOption) (*GetMultiResponse, error)
+	GetBytes(ctx context.Context, in *GetBytesRequest, opts ...grpc.CallOption) (*GetBytesResponse, error)
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	SetBytes(ctx context.Context, in *SetBytesRequest, opts ...grpc.CallOption) (*SetBytesResponse, error)
+	SetMulti(ctx context.Context, in *SetMultiRequest, opts ...grpc.CallOption) (*SetMultiResponse, error)
+	SetNX(ctx context.Context, in *SetNXRequest, opts ...grpc.CallOption) (*SetNXResponse, error)
+	CompareAndSwap(ctx context.Context, in *CompareAndSwapRequest, opts ...grpc.CallOption) (*CompareAndSwapResponse, error)
+	Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error)
+	Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	DeleteMulti(ctx context.Context, in *DeleteMultiRequest, opts ...grpc.CallOption) (*DeleteMultiResponse, error)
+	ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error)
+	Exist(ctx context.Context, in *ExistRequest, opts ...grpc.CallOption) (*ExistResponse, error)
+	ExistMulti(ctx context.Context, in *ExistMultiRequest, opts ...grpc.CallOption) (*ExistMultiResponse, error)
+	ExpireAt(ctx context.Context, in *ExpireAtRequest, opts ...grpc.CallOption) (*ExpireAtResponse, error)
+	Touch(ctx context.Context, in *TouchRequest, opts ...grpc.CallOption) (*TouchResponse, error)
+	Persist(ctx context.Context, in *PersistRequest, opts ...grpc.CallOption) (*PersistResponse, error)
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	Cleanup(ctx context.Context, in *CleanupRequest, opts ...grpc.CallOption) (*CleanupResponse, error)
+	// Watch streams events of key until client cancels it.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (KVDB_WatchClient, error)
+}
+
+type kVDBClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKVDBClient(cc grpc.ClientConnInterface) KVDBClient {
+	return &kVDBClient{cc}
+}
+
+func (c *kVDBClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) GetChildren(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (KVDB_GetChildrenClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_KVDB_serviceDesc.Streams[0], "/kvdb.KVDB/GetChildren", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVDBGetChildrenClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KVDB_GetChildrenClient interface {
+	Recv() (*GetResponse, error)
+	grpc.ClientStream
+}
+
+type kVDBGetChildrenClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVDBGetChildrenClient) Recv() (*GetResponse, error) {
+	m := new(GetResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVDBClient) GetMulti(ctx context.Context, in *GetMultiRequest, opts ...grpc.CallOption) (*GetMultiResponse, error) {
+	out := new(GetMultiResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/GetMulti", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) GetBytes(ctx context.Context, in *GetBytesRequest, opts ...grpc.CallOption) (*GetBytesResponse, error) {
+	out := new(GetBytesResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/GetBytes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Set", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) SetBytes(ctx context.Context, in *SetBytesRequest, opts ...grpc.CallOption) (*SetBytesResponse, error) {
+	out := new(SetBytesResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/SetBytes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) SetMulti(ctx context.Context, in *SetMultiRequest, opts ...grpc.CallOption) (*SetMultiResponse, error) {
+	out := new(SetMultiResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/SetMulti", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) SetNX(ctx context.Context, in *SetNXRequest, opts ...grpc.CallOption) (*SetNXResponse, error) {
+	out := new(SetNXResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/SetNX", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) CompareAndSwap(ctx context.Context, in *CompareAndSwapRequest, opts ...grpc.CallOption) (*CompareAndSwapResponse, error) {
+	out := new(CompareAndSwapResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/CompareAndSwap", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error) {
+	out := new(IncrResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Incr", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error) {
+	out := new(CommitResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Commit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) DeleteMulti(ctx context.Context, in *DeleteMultiRequest, opts ...grpc.CallOption) (*DeleteMultiResponse, error) {
+	out := new(DeleteMultiResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/DeleteMulti", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error) {
+	out := new(ListKeysResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/ListKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Exist(ctx context.Context, in *ExistRequest, opts ...grpc.CallOption) (*ExistResponse, error) {
+	out := new(ExistResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Exist", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) ExistMulti(ctx context.Context, in *ExistMultiRequest, opts ...grpc.CallOption) (*ExistMultiResponse, error) {
+	out := new(ExistMultiResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/ExistMulti", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) ExpireAt(ctx context.Context, in *ExpireAtRequest, opts ...grpc.CallOption) (*ExpireAtResponse, error) {
+	out := new(ExpireAtResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/ExpireAt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Touch(ctx context.Context, in *TouchRequest, opts ...grpc.CallOption) (*TouchResponse, error) {
+	out := new(TouchResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Touch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Persist(ctx context.Context, in *PersistRequest, opts ...grpc.CallOption) (*PersistResponse, error) {
+	out := new(PersistResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Persist", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Count", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Cleanup(ctx context.Context, in *CleanupRequest, opts ...grpc.CallOption) (*CleanupResponse, error) {
+	out := new(CleanupResponse)
+	err := c.cc.Invoke(ctx, "/kvdb.KVDB/Cleanup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVDBClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (KVDB_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_KVDB_serviceDesc.Streams[1], "/kvdb.KVDB/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVDBWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KVDB_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type kVDBWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVDBWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// KVDBServer is the server API for KVDB service.
+// All implementations must embed UnimplementedKVDBServer
+// for forward compatibility
+type KVDBServer interface {
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// GetChildren is the same as Get but streams children page by page, which
+	// is used for large child scans.
+	GetChildren(*GetRequest, KVDB_GetChildrenServer) error
+	GetMulti(context.Context, *GetMultiRequest) (*GetMultiResponse, error)
+	GetBytes(context.Context, *GetBytesRequest) (*GetBytesResponse, error)
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	SetBytes(context.Context, *SetBytesRequest) (*SetBytesResponse, error)
+	SetMulti(context.Context, *SetMultiRequest) (*SetMultiResponse, error)
+	SetNX(context.Context, *SetNXRequest) (*SetNXResponse, error)
+	CompareAndSwap(context.Context, *CompareAndSwapRequest) (*CompareAndSwapResponse, error)
+	Incr(context.Context, *IncrRequest) (*IncrResponse, error)
+	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	DeleteMulti(context.Context, *DeleteMultiRequest) (*DeleteMultiResponse, error)
+	ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error)
+	Exist(context.Context, *ExistRequest) (*ExistResponse, error)
+	ExistMulti(context.Context, *ExistMultiRequest) (*ExistMultiResponse, error)
+	ExpireAt(context.Context, *ExpireAtRequest) (*ExpireAtResponse, error)
+	Touch(context.Context, *TouchRequest) (*TouchResponse, error)
+	Persist(context.Context, *PersistRequest) (*PersistResponse, error)
+	Count(context.Context, *CountRequest) (*CountResponse, error)
+	Cleanup(context.Context, *CleanupRequest) (*CleanupResponse, error)
+	// Watch streams events of key until client cancels it.
+	Watch(*WatchRequest, KVDB_WatchServer) error
+	mustEmbedUnimplementedKVDBServer()
+}
+
+// UnimplementedKVDBServer must be embedded to have forward compatible implementations.
+type UnimplementedKVDBServer struct {
+}
+
+func (UnimplementedKVDBServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedKVDBServer) GetChildren(*GetRequest, KVDB_GetChildrenServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetChildren not implemented")
+}
+func (UnimplementedKVDBServer) GetMulti(context.Context, *GetMultiRequest) (*GetMultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMulti not implemented")
+}
+func (UnimplementedKVDBServer) GetBytes(context.Context, *GetBytesRequest) (*GetBytesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBytes not implemented")
+}
+func (UnimplementedKVDBServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedKVDBServer) SetBytes(context.Context, *SetBytesRequest) (*SetBytesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetBytes not implemented")
+}
+func (UnimplementedKVDBServer) SetMulti(context.Context, *SetMultiRequest) (*SetMultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMulti not implemented")
+}
+func (UnimplementedKVDBServer) SetNX(context.Context, *SetNXRequest) (*SetNXResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetNX not implemented")
+}
+func (UnimplementedKVDBServer) CompareAndSwap(context.Context, *CompareAndSwapRequest) (*CompareAndSwapResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareAndSwap not implemented")
+}
+func (UnimplementedKVDBServer) Incr(context.Context, *IncrRequest) (*IncrResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Incr not implemented")
+}
+func (UnimplementedKVDBServer) Commit(context.Context, *CommitRequest) (*CommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedKVDBServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKVDBServer) DeleteMulti(context.Context, *DeleteMultiRequest) (*DeleteMultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMulti not implemented")
+}
+func (UnimplementedKVDBServer) ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKeys not implemented")
+}
+func (UnimplementedKVDBServer) Exist(context.Context, *ExistRequest) (*ExistResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exist not implemented")
+}
+func (UnimplementedKVDBServer) ExistMulti(context.Context, *ExistMultiRequest) (*ExistMultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExistMulti not implemented")
+}
+func (UnimplementedKVDBServer) ExpireAt(context.Context, *ExpireAtRequest) (*ExpireAtResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExpireAt not implemented")
+}
+func (UnimplementedKVDBServer) Touch(context.Context, *TouchRequest) (*TouchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Touch not implemented")
+}
+func (UnimplementedKVDBServer) Persist(context.Context, *PersistRequest) (*PersistResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Persist not implemented")
+}
+func (UnimplementedKVDBServer) Count(context.Context, *CountRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedKVDBServer) Cleanup(context.Context, *CleanupRequest) (*CleanupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cleanup not implemented")
+}
+func (UnimplementedKVDBServer) Watch(*WatchRequest, KVDB_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedKVDBServer) mustEmbedUnimplementedKVDBServer() {}
+
+// UnsafeKVDBServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KVDBServer will
+// result in compilation errors.
+type UnsafeKVDBServer interface {
+	mustEmbedUnimplementedKVDBServer()
+}
+
+func RegisterKVDBServer(s grpc.ServiceRegistrar, srv KVDBServer) {
+	s.RegisterService(&_KVDB_serviceDesc, srv)
+}
+
+func _KVDB_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_GetChildren_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVDBServer).GetChildren(m, &kVDBGetChildrenServer{stream})
+}
+
+type KVDB_GetChildrenServer interface {
+	Send(*GetResponse) error
+	grpc.ServerStream
+}
+
+type kVDBGetChildrenServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVDBGetChildrenServer) Send(m *GetResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KVDB_GetMulti_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMultiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).GetMulti(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/GetMulti",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).GetMulti(ctx, req.(*GetMultiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_GetBytes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBytesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).GetBytes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/GetBytes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).GetBytes(ctx, req.(*GetBytesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Set",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_SetBytes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetBytesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).SetBytes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/SetBytes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).SetBytes(ctx, req.(*SetBytesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_SetMulti_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMultiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).SetMulti(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/SetMulti",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).SetMulti(ctx, req.(*SetMultiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_SetNX_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetNXRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).SetNX(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/SetNX",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).SetNX(ctx, req.(*SetNXRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_CompareAndSwap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompareAndSwapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).CompareAndSwap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/CompareAndSwap",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).CompareAndSwap(ctx, req.(*CompareAndSwapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Incr_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Incr(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Incr",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Incr(ctx, req.(*IncrRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Commit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Commit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Commit(ctx, req.(*CommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_DeleteMulti_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMultiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).DeleteMulti(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/DeleteMulti",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).DeleteMulti(ctx, req.(*DeleteMultiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_ListKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).ListKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/ListKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).ListKeys(ctx, req.(*ListKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Exist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Exist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Exist",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Exist(ctx, req.(*ExistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_ExistMulti_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExistMultiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).ExistMulti(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/ExistMulti",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).ExistMulti(ctx, req.(*ExistMultiRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_ExpireAt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpireAtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).ExpireAt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/ExpireAt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).ExpireAt(ctx, req.(*ExpireAtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Touch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TouchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Touch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Touch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Touch(ctx, req.(*TouchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Persist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PersistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Persist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Persist",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Persist(ctx, req.(*PersistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Count",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Cleanup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CleanupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVDBServer).Cleanup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kvdb.KVDB/Cleanup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVDBServer).Cleanup(ctx, req.(*CleanupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVDB_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVDBServer).Watch(m, &kVDBWatchServer{stream})
+}
+
+type KVDB_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type kVDBWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVDBWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _KVDB_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "kvdb.KVDB",
+	HandlerType: (*KVDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _KVDB_Get_Handler,
+		},
+		{
+			MethodName: "GetMulti",
+			Handler:    _KVDB_GetMulti_Handler,
+		},
+		{
+			MethodName: "GetBytes",
+			Handler:    _KVDB_GetBytes_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _KVDB_Set_Handler,
+		},
+		{
+			MethodName: "SetBytes",
+			Handler:    _KVDB_SetBytes_Handler,
+		},
+		{
+			MethodName: "SetMulti",
+			Handler:    _KVDB_SetMulti_Handler,
+		},
+		{
+			MethodName: "SetNX",
+			Handler:    _KVDB_SetNX_Handler,
+		},
+		{
+			MethodName: "CompareAndSwap",
+			Handler:    _KVDB_CompareAndSwap_Handler,
+		},
+		{
+			MethodName: "Incr",
+			Handler:    _KVDB_Incr_Handler,
+		},
+		{
+			MethodName: "Commit",
+			Handler:    _KVDB_Commit_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _KVDB_Delete_Handler,
+		},
+		{
+			MethodName: "DeleteMulti",
+			Handler:    _KVDB_DeleteMulti_Handler,
+		},
+		{
+			MethodName: "ListKeys",
+			Handler:    _KVDB_ListKeys_Handler,
+		},
+		{
+			MethodName: "Exist",
+			Handler:    _KVDB_Exist_Handler,
+		},
+		{
+			MethodName: "ExistMulti",
+			Handler:    _KVDB_ExistMulti_Handler,
+		},
+		{
+			MethodName: "ExpireAt",
+			Handler:    _KVDB_ExpireAt_Handler,
+		},
+		{
+			MethodName: "Touch",
+			Handler:    _KVDB_Touch_Handler,
+		},
+		{
+			MethodName: "Persist",
+			Handler:    _KVDB_Persist_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _KVDB_Count_Handler,
+		},
+		{
+			MethodName: "Cleanup",
+			Handler:    _KVDB_Cleanup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetChildren",
+			Handler:       _KVDB_GetChildren_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _KVDB_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kvdb.proto",
+}
@@ -0,0 +1,300 @@
+// Package grpcservice serves KVDB over gRPC as an alternative to the JSON-RPC
+// service, messages are defined by kvdb.proto which mirrors request and
+// response of package service. Large child scans and watches are streamed.
+package grpcservice
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kvdb.proto
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"google.golang.org/grpc/metadata"
+)
+
+// scanPageSize is the largest number of children of a page sent by
+// `GetChildren()`.
+const scanPageSize = 1000
+
+// Server serves db as KVDBServer, for example:
+//
+//	s := grpc.NewServer()
+//	grpcservice.RegisterKVDBServer(s, grpcservice.NewServer(db))
+//	err := s.Serve(l)
+type Server struct {
+	UnimplementedKVDBServer
+	db kvdb.KVDB
+}
+
+// NewServer create a Server of db.
+func NewServer(db kvdb.KVDB) *Server {
+	return &Server{db: db}
+}
+
+func (s *Server) Get(ctx context.Context, req *GetRequest,
+) (*GetResponse, error) {
+	node, err := s.db.GetContext(ctx, req.Key, req.Getter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &GetResponse{Node: fromNode(node)}, nil
+}
+
+// GetChildren get children of key page by page until limit of getter is
+// reached, so that none of the messages is too large. It's the same as
+// `Get()` if limit is not set, which means default limit of db, or
+// descendants are required.
+func (s *Server) GetChildren(req *GetRequest,
+	stream KVDB_GetChildrenServer) error {
+	ctx := stream.Context()
+	var gt kvdb.Getter
+	req.Getter.option()(&gt)
+	remain := gt.Limit
+	for {
+		if remain > scanPageSize && !gt.Descendants {
+			gt.Limit = scanPageSize
+		} else {
+			gt.Limit = remain
+		}
+		node, err := s.db.GetContext(ctx, req.Key, func(g *kvdb.Getter) {
+			*g = gt
+		})
+		if err != nil {
+			return toStatus(err)
+		}
+		if err = stream.Send(&GetResponse{Node: fromNode(node)}); err != nil {
+			return err
+		}
+		if node == nil || !node.HasMore || len(node.ChildList) == 0 ||
+			gt.Limit == remain {
+			return nil
+		}
+		remain -= len(node.ChildList)
+		gt.Start = node.Next
+	}
+}
+
+func (s *Server) GetMulti(ctx context.Context, req *GetMultiRequest,
+) (*GetMultiResponse, error) {
+	nodeMap, err := s.db.GetMultiContext(ctx, req.Keys, req.Getter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &GetMultiResponse{
+		NodeMap: make(map[string]*Node, len(nodeMap)),
+	}
+	for k, v := range nodeMap {
+		v := v
+		resp.NodeMap[k] = fromNode(&v)
+	}
+	return resp, nil
+}
+
+func (s *Server) GetBytes(ctx context.Context, req *GetBytesRequest,
+) (*GetBytesResponse, error) {
+	value, err := s.db.GetBytesContext(ctx, req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &GetBytesResponse{Value: value, Exist: value != nil}, nil
+}
+
+func (s *Server) Set(ctx context.Context, req *SetRequest,
+) (*SetResponse, error) {
+	err := s.db.SetContext(ctx, req.Key, string(req.Value),
+		req.Setter.option())
+	var conflict *kvdb.ConflictError
+	if errors.As(err, &conflict) {
+		return &SetResponse{Conflict: &ConflictError{
+			Key:     conflict.Key,
+			Version: conflict.Version,
+		}}, nil
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &SetResponse{}, nil
+}
+
+func (s *Server) SetBytes(ctx context.Context, req *SetBytesRequest,
+) (*SetBytesResponse, error) {
+	err := s.db.SetBytesContext(ctx, req.Key, req.Value, req.Setter.option())
+	var conflict *kvdb.ConflictError
+	if errors.As(err, &conflict) {
+		return &SetBytesResponse{Conflict: &ConflictError{
+			Key:     conflict.Key,
+			Version: conflict.Version,
+		}}, nil
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &SetBytesResponse{}, nil
+}
+
+func (s *Server) SetMulti(ctx context.Context, req *SetMultiRequest,
+) (*SetMultiResponse, error) {
+	var err error
+	if len(req.Entries) > 0 {
+		err = s.db.SetEntriesContext(ctx, toEntries(req.Entries))
+	} else {
+		err = s.db.SetMultiContext(ctx, toStrings(req.KvPairs),
+			req.Setter.option())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &SetMultiResponse{}, nil
+}
+
+func (s *Server) SetNX(ctx context.Context, req *SetNXRequest,
+) (*SetNXResponse, error) {
+	ok, err := s.db.SetNXContext(ctx, req.Key, string(req.Value),
+		req.Setter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &SetNXResponse{Ok: ok}, nil
+}
+
+func (s *Server) CompareAndSwap(ctx context.Context,
+	req *CompareAndSwapRequest) (*CompareAndSwapResponse, error) {
+	swapped, err := s.db.CompareAndSwapContext(ctx, req.Key, string(req.Old),
+		string(req.New), req.Setter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &CompareAndSwapResponse{Swapped: swapped}, nil
+}
+
+func (s *Server) Incr(ctx context.Context, req *IncrRequest,
+) (*IncrResponse, error) {
+	v, err := s.db.IncrContext(ctx, req.Key, req.Delta)
+	if errors.Is(err, kvdb.ErrorNotInteger) {
+		return &IncrResponse{NotInteger: true}, nil
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &IncrResponse{Value: v}, nil
+}
+
+func (s *Server) Commit(ctx context.Context, req *CommitRequest,
+) (*CommitResponse, error) {
+	ok, err := s.db.CommitContext(ctx, req.Txn.txn())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &CommitResponse{Ok: ok}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest,
+) (*DeleteResponse, error) {
+	err := s.db.DeleteContext(ctx, req.Key, req.Deleter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteResponse{}, nil
+}
+
+func (s *Server) DeleteMulti(ctx context.Context, req *DeleteMultiRequest,
+) (*DeleteMultiResponse, error) {
+	err := s.db.DeleteMultiContext(ctx, req.Keys, req.Deleter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteMultiResponse{}, nil
+}
+
+func (s *Server) ListKeys(ctx context.Context, req *ListKeysRequest,
+) (*ListKeysResponse, error) {
+	keys, err := s.db.ListKeysContext(ctx, req.Parent, req.Start,
+		int(req.Limit), req.Lister.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ListKeysResponse{Keys: keys}, nil
+}
+
+func (s *Server) Exist(ctx context.Context, req *ExistRequest,
+) (*ExistResponse, error) {
+	has, err := s.db.ExistContext(ctx, req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ExistResponse{Has: has}, nil
+}
+
+func (s *Server) ExistMulti(ctx context.Context, req *ExistMultiRequest,
+) (*ExistMultiResponse, error) {
+	hasMap, err := s.db.ExistMultiContext(ctx, req.Keys)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ExistMultiResponse{HasMap: hasMap}, nil
+}
+
+func (s *Server) ExpireAt(ctx context.Context, req *ExpireAtRequest,
+) (*ExpireAtResponse, error) {
+	at, exist, err := s.db.ExpireAtContext(ctx, req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ExpireAtResponse{ExpireAt: fromTime(at), Exist: exist}, nil
+}
+
+func (s *Server) Touch(ctx context.Context, req *TouchRequest,
+) (*TouchResponse, error) {
+	exist, err := s.db.TouchContext(ctx, req.Key, time.Duration(req.Ttl))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &TouchResponse{Exist: exist}, nil
+}
+
+func (s *Server) Persist(ctx context.Context, req *PersistRequest,
+) (*PersistResponse, error) {
+	exist, err := s.db.PersistContext(ctx, req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &PersistResponse{Exist: exist}, nil
+}
+
+func (s *Server) Count(ctx context.Context, req *CountRequest,
+) (*CountResponse, error) {
+	count, err := s.db.CountContext(ctx, req.Key, req.Counter.option())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &CountResponse{Count: int64(count)}, nil
+}
+
+func (s *Server) Cleanup(ctx context.Context, _ *CleanupRequest,
+) (*CleanupResponse, error) {
+	if err := s.db.CleanupContext(ctx); err != nil {
+		return nil, toStatus(err)
+	}
+	return &CleanupResponse{}, nil
+}
+
+// Watch sends header once watch is registered, so that client could get
+// error of registration, then sends events until client cancels it or db is
+// closed.
+func (s *Server) Watch(req *WatchRequest, stream KVDB_WatchServer) error {
+	events, err := s.db.WatchContext(stream.Context(), req.Key, req.Recursive)
+	if err != nil {
+		return toStatus(err)
+	}
+	if err = stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for e := range events {
+		if err = stream.Send(fromEvent(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
+	"reflect"
 	"sync"
 	"time"
 
@@ -16,14 +18,51 @@ type rpcClient struct {
 	*rpc.Client
 	Dial func() (*rpc.Client, error)
 	mu   sync.RWMutex
+	// done is closed when client is closed, to stop polling of watches
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func DialKVDBService(network, address string) (kvdb.KVDB, error) {
+type dialOptions struct {
+	tlsConfig  *tls.Config
+	credential Credential
+}
+
+type DialOption func(*dialOptions)
+
+// TLS connect to server over TLS with config, which should contain RootCAs to
+// verify server certificate if it's not signed by system CA, and client
+// certificate if server requires it. ServerName of config should be set if
+// it's not the host of address.
+func TLS(config *tls.Config) DialOption {
+	return func(o *dialOptions) {
+		o.tlsConfig = config
+	}
+}
+
+func DialKVDBService(network, address string, opts ...DialOption,
+) (kvdb.KVDB, error) {
+	var o dialOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	dialer := func() (*rpc.Client, error) {
-		conn, err := net.Dial(network, address)
+		var conn net.Conn
+		var err error
+		if o.tlsConfig != nil {
+			conn, err = tls.Dial(network, address, o.tlsConfig)
+		} else {
+			conn, err = net.Dial(network, address)
+		}
 		if err != nil {
 			return nil, err
 		}
+		if o.credential != nil {
+			if err = authenticate(conn, o.credential); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
 		return rpc.NewClientWithCodec(jsonrpc.NewClientCodec(conn)), nil
 	}
 	c, err := dialer()
@@ -34,16 +73,24 @@ func DialKVDBService(network, address string) (kvdb.KVDB, error) {
 		rpcClient{
 			Client: c,
 			Dial:   dialer,
+			done:   make(chan struct{}),
 		},
 	}, nil
 }
 
 func (c *rpcClient) close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.Client.Close()
 }
 
-func (c *rpcClient) doCall(serviceMethod string, args interface{}, reply interface{}) error {
-	return retry.Do(context.Background(), func(ctx context.Context, attempt uint) error {
+func (c *rpcClient) doCall(ctx context.Context, serviceMethod string,
+	args interface{}, reply interface{}) error {
+	var denied bool
+	err := retry.Do(ctx, func(ctx context.Context, attempt uint) error {
 		if attempt > 0 {
 			client, err := c.Dial()
 			if err != nil {
@@ -58,6 +105,38 @@ func (c *rpcClient) doCall(serviceMethod string, args interface{}, reply interfa
 		}
 		c.mu.RLock()
 		defer c.mu.RUnlock()
-		return c.Client.Call(serviceMethod, args, reply)
+		err := c.call(ctx, serviceMethod, args, reply)
+		// permission is denied again by retry
+		if err == rpc.ServerError(ErrorPermissionDenied.Error()) {
+			denied = true
+			return nil
+		}
+		return err
 	}, retry.Backoff(retry.Linear(time.Millisecond*200)), retry.Limit(2))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if denied {
+		return ErrorPermissionDenied
+	}
+	return err
+}
+
+// call invokes the named function and waits for it to complete or ctx to be
+// done, whichever happens first. Response is decoded into a fresh value and
+// copied to reply only after call is done, since pending call keeps decoding
+// after ctx is done.
+func (c *rpcClient) call(ctx context.Context, serviceMethod string,
+	args interface{}, reply interface{}) error {
+	rv := reflect.ValueOf(reply).Elem()
+	fresh := reflect.New(rv.Type())
+	call := c.Client.Go(serviceMethod, args, fresh.Interface(),
+		make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		rv.Set(fresh.Elem())
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/elvinchan/kvdb/service"
+)
+
+// authTimeout is the longest time of authentication on connect.
+const authTimeout = time.Second * 10
+
+// errorCredential is returned by authenticators if credential is invalid.
+var errorCredential = errors.New("invalid credential")
+
+// Authenticator verify credential answered by client for challenge on
+// connect, and returns principal of client, which is used by Policy.
+type Authenticator interface {
+	Authenticate(challenge, credential []byte) (string, error)
+}
+
+type tokenAuth map[string]string
+
+func (t tokenAuth) Authenticate(_, credential []byte) (string, error) {
+	// every token is compared in constant time
+	var principal string
+	var ok bool
+	for token, p := range t {
+		if subtle.ConstantTimeCompare([]byte(token), credential) == 1 {
+			principal, ok = p, true
+		}
+	}
+	if !ok {
+		return "", errorCredential
+	}
+	return principal, nil
+}
+
+// TokenAuth authenticate clients by tokens, which maps token to principal.
+// It works with credential `service.Token()`.
+func TokenAuth(tokens map[string]string) Authenticator {
+	return tokenAuth(tokens)
+}
+
+type hmacAuth map[string][]byte
+
+func (h hmacAuth) Authenticate(challenge, credential []byte) (string, error) {
+	i := strings.LastIndexByte(string(credential), ':')
+	if i < 0 {
+		return "", errorCredential
+	}
+	id := string(credential[:i])
+	secret, ok := h[id]
+	if !ok {
+		return "", errorCredential
+	}
+	sum, err := hex.DecodeString(string(credential[i+1:]))
+	if err != nil {
+		return "", errorCredential
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(challenge)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return "", errorCredential
+	}
+	return id, nil
+}
+
+// HMACAuth authenticate clients by HMAC-SHA256 of challenge, secrets maps id
+// of client to it's secret, and id is the principal. It works with credential
+// `service.HMAC()`.
+func HMACAuth(secrets map[string][]byte) Authenticator {
+	return hmacAuth(secrets)
+}
+
+// Auth require clients to authenticate by authenticator on connect.
+func Auth(authenticator Authenticator) ServerOption {
+	return func(s *Server) {
+		s.auth = authenticator
+	}
+}
+
+// Permission restricts keys and methods a principal could access.
+type Permission struct {
+	// Prefixes are key paths which the principal could access along with their
+	// descendants, empty means all keys.
+	Prefixes []string
+	// ReadOnly denies methods which write.
+	ReadOnly bool
+}
+
+// Policy maps principal to it's permission, principal not in policy is denied
+// any method. Principal of clients is empty if authentication is not
+// required.
+type Policy map[string]Permission
+
+// Authorize restrict principals by policy, which is checked before calling
+// db. Methods which affect all keys, such as `Cleanup()`, are only allowed for
+// permission without prefixes. Prefixes are matched by separator of
+// `KeyPathSep()`.
+func Authorize(policy Policy) ServerOption {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// authenticate send challenge to client on nc and verify it's credential,
+// and returns principal of client.
+func (s *Server) authenticate(nc net.Conn) (string, error) {
+	if err := nc.SetDeadline(time.Now().Add(authTimeout)); err != nil {
+		return "", err
+	}
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	enc := json.NewEncoder(nc)
+	err := enc.Encode(service.AuthChallenge{Challenge: challenge})
+	if err != nil {
+		return "", err
+	}
+	// client sends nothing before response, so decoder never reads ahead
+	var req service.AuthRequest
+	if err = json.NewDecoder(nc).Decode(&req); err != nil {
+		return "", err
+	}
+	principal, err := s.auth.Authenticate(challenge, req.Credential)
+	if err != nil {
+		_ = enc.Encode(service.AuthResponse{
+			Error: service.ErrorAuthFailed.Error(),
+		})
+		return "", err
+	}
+	if err = enc.Encode(service.AuthResponse{}); err != nil {
+		return "", err
+	}
+	return principal, nc.SetDeadline(time.Time{})
+}
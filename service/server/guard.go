@@ -0,0 +1,359 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/service"
+)
+
+// guardDB checks permission of a principal before calling db, which is
+// served for each connection if policy is set.
+type guardDB struct {
+	db      kvdb.KVDB
+	perm    Permission
+	allowed bool
+	sep     string
+}
+
+func newGuardDB(db kvdb.KVDB, policy Policy, principal, sep string,
+) *guardDB {
+	perm, ok := policy[principal]
+	return &guardDB{
+		db:      db,
+		perm:    perm,
+		allowed: ok,
+		sep:     sep,
+	}
+}
+
+// check returns service.ErrorPermissionDenied if any key is not within
+// prefixes of permission, or write is not allowed.
+func (g *guardDB) check(write bool, keys ...string) error {
+	if !g.allowed || (write && g.perm.ReadOnly) {
+		return service.ErrorPermissionDenied
+	}
+	if len(g.perm.Prefixes) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		if !g.within(key) {
+			return service.ErrorPermissionDenied
+		}
+	}
+	return nil
+}
+
+// checkAll is the same as check but for all keys.
+func (g *guardDB) checkAll(write bool) error {
+	if err := g.check(write); err != nil {
+		return err
+	}
+	if len(g.perm.Prefixes) > 0 {
+		return service.ErrorPermissionDenied
+	}
+	return nil
+}
+
+func (g *guardDB) within(key string) bool {
+	for _, p := range g.perm.Prefixes {
+		if p == "" || key == p || strings.HasPrefix(key, p+g.sep) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *guardDB) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	return g.GetContext(context.Background(), key, opts...)
+}
+
+func (g *guardDB) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	if err := g.check(false, key); err != nil {
+		return nil, err
+	}
+	return g.db.GetContext(ctx, key, opts...)
+}
+
+func (g *guardDB) GetMulti(keys []string, opts ...kvdb.GetOption,
+) (map[string]kvdb.Node, error) {
+	return g.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (g *guardDB) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
+	if err := g.check(false, keys...); err != nil {
+		return nil, err
+	}
+	return g.db.GetMultiContext(ctx, keys, opts...)
+}
+
+func (g *guardDB) GetBytes(key string) ([]byte, error) {
+	return g.GetBytesContext(context.Background(), key)
+}
+
+func (g *guardDB) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	if err := g.check(false, key); err != nil {
+		return nil, err
+	}
+	return g.db.GetBytesContext(ctx, key)
+}
+
+func (g *guardDB) Set(key, value string, opts ...kvdb.SetOption) error {
+	return g.SetContext(context.Background(), key, value, opts...)
+}
+
+func (g *guardDB) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	if err := g.check(true, key); err != nil {
+		return err
+	}
+	return g.db.SetContext(ctx, key, value, opts...)
+}
+
+func (g *guardDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return g.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (g *guardDB) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	keys := make([]string, 0, len(kvPairs)/2)
+	for i := 0; i < len(kvPairs); i += 2 {
+		keys = append(keys, kvPairs[i])
+	}
+	if err := g.check(true, keys...); err != nil {
+		return err
+	}
+	return g.db.SetMultiContext(ctx, kvPairs, opts...)
+}
+
+func (g *guardDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return g.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (g *guardDB) SetBytesContext(ctx context.Context, key string,
+	value []byte, opts ...kvdb.SetOption) error {
+	if err := g.check(true, key); err != nil {
+		return err
+	}
+	return g.db.SetBytesContext(ctx, key, value, opts...)
+}
+
+func (g *guardDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return g.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (g *guardDB) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	if err := g.check(true, key); err != nil {
+		return false, err
+	}
+	return g.db.SetNXContext(ctx, key, value, opts...)
+}
+
+func (g *guardDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return g.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (g *guardDB) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	if err := g.check(true, key); err != nil {
+		return false, err
+	}
+	return g.db.CompareAndSwapContext(ctx, key, old, new, opts...)
+}
+
+func (g *guardDB) Incr(key string, delta int64) (int64, error) {
+	return g.IncrContext(context.Background(), key, delta)
+}
+
+func (g *guardDB) IncrContext(ctx context.Context, key string, delta int64,
+) (int64, error) {
+	if err := g.check(true, key); err != nil {
+		return 0, err
+	}
+	return g.db.IncrContext(ctx, key, delta)
+}
+
+func (g *guardDB) Commit(txn *kvdb.Txn) (bool, error) {
+	return g.CommitContext(context.Background(), txn)
+}
+
+// CommitContext check keys of preconditions for read, and keys of operations
+// for write.
+func (g *guardDB) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	if txn != nil {
+		for _, c := range txn.Conds {
+			if err := g.check(false, c.Key); err != nil {
+				return false, err
+			}
+		}
+		for _, op := range txn.Ops {
+			if err := g.check(true, op.Key); err != nil {
+				return false, err
+			}
+		}
+	}
+	return g.db.CommitContext(ctx, txn)
+}
+
+func (g *guardDB) SetEntries(entries []kvdb.Entry) error {
+	return g.SetEntriesContext(context.Background(), entries)
+}
+
+func (g *guardDB) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	for _, e := range entries {
+		if err := g.check(true, e.Key); err != nil {
+			return err
+		}
+	}
+	return g.db.SetEntriesContext(ctx, entries)
+}
+
+func (g *guardDB) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return g.DeleteContext(context.Background(), key, opts...)
+}
+
+func (g *guardDB) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	if err := g.check(true, key); err != nil {
+		return err
+	}
+	return g.db.DeleteContext(ctx, key, opts...)
+}
+
+func (g *guardDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return g.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (g *guardDB) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
+	if err := g.check(true, keys...); err != nil {
+		return err
+	}
+	return g.db.DeleteMultiContext(ctx, keys, opts...)
+}
+
+func (g *guardDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return g.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (g *guardDB) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	if err := g.check(false, parent); err != nil {
+		return nil, err
+	}
+	return g.db.ListKeysContext(ctx, parent, start, limit, opts...)
+}
+
+func (g *guardDB) Exist(key string) (bool, error) {
+	return g.ExistContext(context.Background(), key)
+}
+
+func (g *guardDB) ExistContext(ctx context.Context, key string) (bool, error) {
+	if err := g.check(false, key); err != nil {
+		return false, err
+	}
+	return g.db.ExistContext(ctx, key)
+}
+
+func (g *guardDB) ExistMulti(keys []string) (map[string]bool, error) {
+	return g.ExistMultiContext(context.Background(), keys)
+}
+
+func (g *guardDB) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	if err := g.check(false, keys...); err != nil {
+		return nil, err
+	}
+	return g.db.ExistMultiContext(ctx, keys)
+}
+
+func (g *guardDB) ExpireAt(key string) (time.Time, bool, error) {
+	return g.ExpireAtContext(context.Background(), key)
+}
+
+func (g *guardDB) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	if err := g.check(false, key); err != nil {
+		return time.Time{}, false, err
+	}
+	return g.db.ExpireAtContext(ctx, key)
+}
+
+func (g *guardDB) Touch(key string, ttl time.Duration) (bool, error) {
+	return g.TouchContext(context.Background(), key, ttl)
+}
+
+func (g *guardDB) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	if err := g.check(true, key); err != nil {
+		return false, err
+	}
+	return g.db.TouchContext(ctx, key, ttl)
+}
+
+func (g *guardDB) Persist(key string) (bool, error) {
+	return g.PersistContext(context.Background(), key)
+}
+
+func (g *guardDB) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	if err := g.check(true, key); err != nil {
+		return false, err
+	}
+	return g.db.PersistContext(ctx, key)
+}
+
+func (g *guardDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return g.CountContext(context.Background(), key, opts...)
+}
+
+func (g *guardDB) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	if err := g.check(false, key); err != nil {
+		return 0, err
+	}
+	return g.db.CountContext(ctx, key, opts...)
+}
+
+func (g *guardDB) Watch(key string, recursive bool) (<-chan kvdb.Event,
+	error) {
+	return g.WatchContext(context.Background(), key, recursive)
+}
+
+func (g *guardDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	if err := g.check(false, key); err != nil {
+		return nil, err
+	}
+	return g.db.WatchContext(ctx, key, recursive)
+}
+
+func (g *guardDB) Cleanup() error {
+	return g.CleanupContext(context.Background())
+}
+
+func (g *guardDB) CleanupContext(ctx context.Context) error {
+	if err := g.checkAll(true); err != nil {
+		return err
+	}
+	return g.db.CleanupContext(ctx)
+}
+
+// Close does nothing, since db is shared by all connections.
+func (g *guardDB) Close() error {
+	return nil
+}
@@ -1,34 +1,153 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"log"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
+	"sync"
 	"time"
 
 	"github.com/elvinchan/kvdb"
 	"github.com/elvinchan/kvdb/service"
 )
 
+// KVServer serves requests of a connection. Watches are shared by all
+// connections, so that client could poll it's watch after reconnected, and
+// are only visible to the same principal.
 type KVServer struct {
-	db kvdb.KVDB
+	db        kvdb.KVDB
+	principal string
+	watches   *watchSet
 }
 
-func StartServer(db kvdb.KVDB, network, address string) error {
+// ErrServerClosed is returned by `Serve()` after `Shutdown()` is called.
+var ErrServerClosed = errors.New("kvdb: server closed")
+
+// shutdownPollInterval is how often idle connections are checked and closed
+// during shutdown.
+const shutdownPollInterval = time.Millisecond * 10
+
+// Server serves KVDB service on listeners, and could be stopped by
+// `Shutdown()`.
+type Server struct {
+	db        kvdb.KVDB
+	kv        *KVServer
+	rpc       *rpc.Server
+	closeDB   bool
+	tlsConfig *tls.Config
+	auth      Authenticator
+	policy    Policy
+	sep       string
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	shutdown  bool
+	dbClosed  bool
+	mu        sync.Mutex
+}
+
+type ServerOption func(*Server)
+
+// CloseDBOnShutdown close db after all connections are closed by
+// `Shutdown()`.
+func CloseDBOnShutdown() ServerOption {
+	return func(s *Server) {
+		s.closeDB = true
+	}
+}
+
+// TLS serve connections over TLS with config, which should contain server
+// certificate. Client certificate is verified if ClientAuth and ClientCAs of
+// config are set.
+func TLS(config *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// KeyPathSep specify separator of key path of db, which should be the same
+// as `kvdb.KeyPathSep()` of db, since prefixes of `Authorize()` are matched by
+// it. Default is separator of `kvdb.InitOption()`.
+func KeyPathSep(sep string) ServerOption {
+	return func(s *Server) {
+		s.sep = sep
+	}
+}
+
+// NewServer create a Server of db.
+func NewServer(db kvdb.KVDB, opts ...ServerOption) (*Server, error) {
+	kv := &KVServer{
+		db:      db,
+		watches: newWatchSet(),
+	}
 	server := rpc.NewServer()
-	if err := server.RegisterName(service.KVDBServiceName, &KVServer{db}); err != nil {
+	if err := server.RegisterName(service.KVDBServiceName, kv); err != nil {
+		return nil, err
+	}
+	s := &Server{
+		db:        db,
+		kv:        kv,
+		rpc:       server,
+		sep:       kvdb.InitOption().KeyPathSep,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// StartServer serve db on network and address, and blocks until error.
+func StartServer(db kvdb.KVDB, network, address string) error {
+	s, err := NewServer(db)
+	if err != nil {
 		return err
 	}
+	return s.ListenAndServe(network, address)
+}
+
+// ListenAndServe listen on network and address and serve on it.
+func (s *Server) ListenAndServe(network, address string) error {
 	l, err := net.Listen(network, address)
 	if err != nil {
 		return err
 	}
 	log.Printf("start listen, network: %s, address: %s", network, address)
+	return s.Serve(l)
+}
+
+// Serve accept connections on l and serve each of them in a goroutine, which
+// is over TLS if TLS option is set. It always returns a non-nil error and
+// closes l, which is ErrServerClosed after `Shutdown()` is called.
+func (s *Server) Serve(l net.Listener) error {
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+	}
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.listeners, l)
+		_ = l.Close()
+	}()
 	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
-		conn, err := l.Accept()
+		nc, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
 					tempDelay = 5 * time.Millisecond
@@ -42,9 +161,164 @@ func StartServer(db kvdb.KVDB, network, address string) error {
 				time.Sleep(tempDelay)
 				continue
 			}
-			log.Fatal("failed accept conn:", err)
+			return err
+		}
+		tempDelay = 0
+		c := &conn{ServerCodec: jsonrpc.NewServerCodec(nc)}
+		if s.auth != nil {
+			// authentication is in progress, so that c is not closed as idle
+			c.pending = 1
+		}
+		s.mu.Lock()
+		if s.shutdown {
+			s.mu.Unlock()
+			_ = c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(nc, c)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn, c *conn) {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.conns, c)
+	}()
+	server := s.rpc
+	if s.auth != nil || s.policy != nil {
+		var principal string
+		var err error
+		if s.auth != nil {
+			principal, err = s.authenticate(nc)
+			c.done()
+			if err != nil {
+				log.Print("failed authenticate conn:", err)
+				_ = c.Close()
+				return
+			}
+		}
+		if server, err = s.newRPC(principal); err != nil {
+			log.Print("failed serve conn:", err)
+			_ = c.Close()
+			return
+		}
+	}
+	// returns after responses of all requests on c are written
+	server.ServeCodec(c)
+}
+
+// newRPC returns rpc server of connection for principal, which shares watches
+// with other connections and checks policy if it's set.
+func (s *Server) newRPC(principal string) (*rpc.Server, error) {
+	var db kvdb.KVDB = s.db
+	if s.policy != nil {
+		db = newGuardDB(s.db, s.policy, principal, s.sep)
+	}
+	server := rpc.NewServer()
+	err := server.RegisterName(service.KVDBServiceName, &KVServer{
+		db:        db,
+		principal: principal,
+		watches:   s.kv.watches,
+	})
+	return server, err
+}
+
+// Shutdown stop accepting connections and close all watches, then close idle
+// connections until all connections are closed, and close db if
+// CloseDBOnShutdown is set. Connections are closed forcibly if ctx is done
+// before that, ctx.Err() is returned and db is not closed since requests may
+// be still in progress.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	s.mu.Unlock()
+	// polls in progress return as soon as their watches are closed
+	s.kv.watches.closeAll()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for !s.closeIdleConns() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for c := range s.conns {
+				_ = c.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
 		}
-		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closeDB || s.dbClosed {
+		return nil
+	}
+	s.dbClosed = true
+	return s.db.Close()
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
+// closeIdleConns close connections without request in progress, and returns
+// if all connections are closed.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.closeIfIdle()
+	}
+	return len(s.conns) == 0
+}
+
+// conn counts requests in progress of a connection, a request is in progress
+// from it's header is read until it's response is written.
+type conn struct {
+	rpc.ServerCodec
+	pending int
+	closed  bool
+	mu      sync.Mutex
+}
+
+func (c *conn) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		c.mu.Lock()
+		c.pending++
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *conn) WriteResponse(r *rpc.Response, body interface{}) error {
+	defer c.done()
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// done mark a request is finished.
+func (c *conn) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+}
+
+func (c *conn) closeIfIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == 0 && !c.closed {
+		c.closed = true
+		_ = c.ServerCodec.Close()
 	}
 }
 
@@ -52,9 +326,7 @@ func (s *KVServer) Get(req service.GetRequest,
 	resp *service.GetResponse) error {
 	node, err := s.db.Get(req.Key, func(g *kvdb.Getter) {
 		if req.Getter != nil {
-			g.Children = req.Getter.Children
-			g.Start = req.Getter.Start
-			g.Limit = req.Getter.Limit
+			*g = *req.Getter
 		}
 	})
 	resp.Node = node
@@ -65,38 +337,112 @@ func (s *KVServer) GetMulti(req service.GetMultiRequest,
 	resp *service.GetMultiResponse) error {
 	nodeMap, err := s.db.GetMulti(req.Keys, func(g *kvdb.Getter) {
 		if req.Getter != nil {
-			g.Children = req.Getter.Children
-			g.Start = req.Getter.Start
-			g.Limit = req.Getter.Limit
+			*g = *req.Getter
 		}
 	})
 	resp.NodeMap = nodeMap
 	return err
 }
 
+func (s *KVServer) GetBytes(req service.GetBytesRequest,
+	resp *service.GetBytesResponse) error {
+	value, err := s.db.GetBytes(req.Key)
+	resp.Value = value
+	return err
+}
+
 func (s *KVServer) Set(req service.SetRequest,
 	resp *service.SetResponse) error {
-	return s.db.Set(req.Key, req.Value, func(s *kvdb.Setter) {
+	err := s.db.Set(req.Key, req.Value, func(s *kvdb.Setter) {
+		if req.Setter != nil {
+			*s = *req.Setter
+		}
+	})
+	var conflict *kvdb.ConflictError
+	if errors.As(err, &conflict) {
+		resp.Conflict = conflict
+		return nil
+	}
+	return err
+}
+
+func (s *KVServer) SetBytes(req service.SetBytesRequest,
+	resp *service.SetBytesResponse) error {
+	err := s.db.SetBytes(req.Key, req.Value, func(s *kvdb.Setter) {
 		if req.Setter != nil {
-			s.ExpireAt = req.Setter.ExpireAt
+			*s = *req.Setter
 		}
 	})
+	var conflict *kvdb.ConflictError
+	if errors.As(err, &conflict) {
+		resp.Conflict = conflict
+		return nil
+	}
+	return err
 }
 
 func (s *KVServer) SetMulti(req service.SetMultiRequest,
 	resp *service.SetMultiResponse) error {
+	if len(req.Entries) > 0 {
+		return s.db.SetEntries(req.Entries)
+	}
 	return s.db.SetMulti(req.KvPairs, func(s *kvdb.Setter) {
 		if req.Setter != nil {
-			s.ExpireAt = req.Setter.ExpireAt
+			*s = *req.Setter
 		}
 	})
 }
 
+func (s *KVServer) SetNX(req service.SetNXRequest,
+	resp *service.SetNXResponse) error {
+	ok, err := s.db.SetNX(req.Key, req.Value, func(s *kvdb.Setter) {
+		if req.Setter != nil {
+			*s = *req.Setter
+		}
+	})
+	resp.Ok = ok
+	return err
+}
+
+func (s *KVServer) CompareAndSwap(req service.CompareAndSwapRequest,
+	resp *service.CompareAndSwapResponse) error {
+	swapped, err := s.db.CompareAndSwap(req.Key, req.Old, req.New,
+		func(s *kvdb.Setter) {
+			if req.Setter != nil {
+				*s = *req.Setter
+			}
+		})
+	resp.Swapped = swapped
+	return err
+}
+
+func (s *KVServer) Incr(req service.IncrRequest,
+	resp *service.IncrResponse) error {
+	v, err := s.db.Incr(req.Key, req.Delta)
+	if errors.Is(err, kvdb.ErrorNotInteger) {
+		resp.NotInteger = true
+		return nil
+	}
+	if errors.Is(err, kvdb.ErrorOverflow) {
+		resp.Overflow = true
+		return nil
+	}
+	resp.Value = v
+	return err
+}
+
+func (s *KVServer) Commit(req service.CommitRequest,
+	resp *service.CommitResponse) error {
+	ok, err := s.db.Commit(req.Txn)
+	resp.Ok = ok
+	return err
+}
+
 func (s *KVServer) Delete(req service.DeleteRequest,
 	resp *service.DeleteResponse) error {
 	return s.db.Delete(req.Key, func(d *kvdb.Deleter) {
 		if req.Deleter != nil {
-			d.Children = req.Deleter.Children
+			*d = *req.Deleter
 		}
 	})
 }
@@ -105,11 +451,23 @@ func (s *KVServer) DeleteMulti(req service.DeleteMultiRequest,
 	resp *service.DeleteMultiResponse) error {
 	return s.db.DeleteMulti(req.Keys, func(d *kvdb.Deleter) {
 		if req.Deleter != nil {
-			d.Children = req.Deleter.Children
+			*d = *req.Deleter
 		}
 	})
 }
 
+func (s *KVServer) ListKeys(req service.ListKeysRequest,
+	resp *service.ListKeysResponse) error {
+	keys, err := s.db.ListKeys(req.Parent, req.Start, req.Limit,
+		func(l *kvdb.Lister) {
+			if req.Lister != nil {
+				*l = *req.Lister
+			}
+		})
+	resp.Keys = keys
+	return err
+}
+
 func (s *KVServer) Exist(req service.ExistRequest,
 	resp *service.ExistResponse) error {
 	has, err := s.db.Exist(req.Key)
@@ -117,7 +475,112 @@ func (s *KVServer) Exist(req service.ExistRequest,
 	return err
 }
 
+func (s *KVServer) ExistMulti(req service.ExistMultiRequest,
+	resp *service.ExistMultiResponse) error {
+	hasMap, err := s.db.ExistMulti(req.Keys)
+	resp.HasMap = hasMap
+	return err
+}
+
+func (s *KVServer) ExpireAt(req service.ExpireAtRequest,
+	resp *service.ExpireAtResponse) error {
+	at, exist, err := s.db.ExpireAt(req.Key)
+	resp.ExpireAt = at
+	resp.Exist = exist
+	return err
+}
+
+func (s *KVServer) Touch(req service.TouchRequest,
+	resp *service.TouchResponse) error {
+	exist, err := s.db.Touch(req.Key, req.TTL)
+	resp.Exist = exist
+	return err
+}
+
+func (s *KVServer) Persist(req service.PersistRequest,
+	resp *service.PersistResponse) error {
+	exist, err := s.db.Persist(req.Key)
+	resp.Exist = exist
+	return err
+}
+
+func (s *KVServer) Count(req service.CountRequest,
+	resp *service.CountResponse) error {
+	count, err := s.db.Count(req.Key, func(c *kvdb.Counter) {
+		if req.Counter != nil {
+			*c = *req.Counter
+		}
+	})
+	resp.Count = count
+	return err
+}
+
 func (s *KVServer) Cleanup(_ service.CleanupRequest,
 	_ *service.CleanupResponse) error {
 	return s.db.Cleanup()
 }
+
+func (s *KVServer) Watch(req service.WatchRequest,
+	resp *service.WatchResponse) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := s.db.WatchContext(ctx, req.Key, req.Recursive)
+	if err != nil {
+		cancel()
+		return err
+	}
+	id, ok := s.watches.add(s.principal, events, cancel)
+	if !ok {
+		cancel()
+		return errTooManyWatches
+	}
+	resp.ID = id
+	return nil
+}
+
+// Poll returns as soon as any event is available, along with events already
+// queued, or returns nothing if no event arrives in wait.
+func (s *KVServer) Poll(req service.PollRequest,
+	resp *service.PollResponse) error {
+	w, ok := s.watches.acquire(req.ID, s.principal)
+	if !ok {
+		resp.Closed = true
+		return nil
+	}
+	defer s.watches.release(w)
+	wait := req.Wait
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for len(resp.Events) < maxPollEvents {
+		var e kvdb.Event
+		var ok bool
+		if len(resp.Events) == 0 {
+			select {
+			case e, ok = <-w.events:
+			case <-timer.C:
+				return nil
+			}
+		} else {
+			select {
+			case e, ok = <-w.events:
+			default:
+				return nil
+			}
+		}
+		if !ok {
+			resp.Closed = true
+			s.watches.remove(req.ID, s.principal)
+			return nil
+		}
+		resp.Events = append(resp.Events, e)
+	}
+	return nil
+}
+
+func (s *KVServer) Unwatch(req service.UnwatchRequest,
+	_ *service.UnwatchResponse) error {
+	s.watches.remove(req.ID, s.principal)
+	return nil
+}
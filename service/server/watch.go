@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elvinchan/kvdb"
+)
+
+const (
+	// maxPollWait is the longest time a poll waits for events.
+	maxPollWait = time.Second * 30
+	// maxPollEvents is the most events returned by a poll.
+	maxPollEvents = 100
+	// watchIdleTimeout is how long a watch is kept without poll.
+	watchIdleTimeout = time.Minute
+	// maxWatches is the most watches of a principal, since events of every
+	// watch are queued on server until they are polled.
+	maxWatches = 100
+)
+
+// errTooManyWatches is returned by `Watch()` if principal has maxWatches.
+var errTooManyWatches = errors.New("kvdb: too many watches")
+
+// watch is a watch of db registered by client, which is polled by id.
+type watch struct {
+	owner  string
+	events <-chan kvdb.Event
+	cancel context.CancelFunc
+	// polls is number of polls in progress, and active is the time last poll
+	// finished, watch is expired if it's idle for watchIdleTimeout.
+	polls  int
+	active time.Time
+}
+
+// watchSet keeps watches by id. Watches idle for watchIdleTimeout are removed
+// when watch is added or acquired, which are left by clients closed or gone
+// without unwatch.
+type watchSet struct {
+	watches map[string]*watch
+	lastID  uint64
+	mu      sync.Mutex
+}
+
+func newWatchSet() *watchSet {
+	return &watchSet{
+		watches: make(map[string]*watch),
+	}
+}
+
+// add returns id of watch, or false if owner has maxWatches.
+func (ws *watchSet) add(owner string, events <-chan kvdb.Event,
+	cancel context.CancelFunc) (string, bool) {
+	now := time.Now()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.expire(now)
+	var n int
+	for _, w := range ws.watches {
+		if w.owner == owner {
+			n++
+		}
+	}
+	if n >= maxWatches {
+		return "", false
+	}
+	ws.lastID++
+	id := strconv.FormatUint(ws.lastID, 10)
+	ws.watches[id] = &watch{
+		owner:  owner,
+		events: events,
+		cancel: cancel,
+		active: now,
+	}
+	return id, true
+}
+
+// acquire returns watch of id owned by owner for poll, which should be
+// released after poll.
+func (ws *watchSet) acquire(id, owner string) (*watch, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.expire(time.Now())
+	w, ok := ws.watches[id]
+	if !ok || w.owner != owner {
+		return nil, false
+	}
+	w.polls++
+	return w, true
+}
+
+func (ws *watchSet) release(w *watch) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	w.polls--
+	w.active = time.Now()
+}
+
+func (ws *watchSet) remove(id, owner string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if w, ok := ws.watches[id]; ok && w.owner == owner {
+		w.cancel()
+		delete(ws.watches, id)
+	}
+}
+
+// closeAll close all watches, which is called on shutdown.
+func (ws *watchSet) closeAll() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for id, w := range ws.watches {
+		w.cancel()
+		delete(ws.watches, id)
+	}
+}
+
+// expire should be called with lock held.
+func (ws *watchSet) expire(now time.Time) {
+	for id, w := range ws.watches {
+		if w.polls == 0 && now.Sub(w.active) > watchIdleTimeout {
+			w.cancel()
+			delete(ws.watches, id)
+		}
+	}
+}
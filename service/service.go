@@ -1,11 +1,21 @@
 package service
 
 import (
+	"context"
+	"time"
+
 	"github.com/elvinchan/kvdb"
 )
 
 const KVDBServiceName = "KVDB"
 
+const (
+	// pollWait is how long a poll of watch waits on server, which should be
+	// less than idle timeout of watch on server.
+	pollWait       = time.Second * 10
+	unwatchTimeout = time.Second * 5
+)
+
 type GetRequest struct {
 	Key    string       `json:"key"`
 	Getter *kvdb.Getter `json:"getter"`
@@ -24,21 +34,92 @@ type GetMultiResponse struct {
 	NodeMap map[string]kvdb.Node `json:"nodeMap"`
 }
 
+// GetBytesRequest and other bytes messages carry value as []byte, which is
+// encoded as base64 by JSON so that it's binary safe.
+type GetBytesRequest struct {
+	Key string `json:"key"`
+}
+
+type GetBytesResponse struct {
+	Value []byte `json:"value"`
+}
+
 type SetRequest struct {
 	Key    string       `json:"key"`
 	Value  string       `json:"value"`
 	Setter *kvdb.Setter `json:"setter"`
 }
 
-type SetResponse struct{}
+type SetResponse struct {
+	// Conflict is returned by response instead of error, so that client could
+	// get the typed error.
+	Conflict *kvdb.ConflictError `json:"conflict,omitempty"`
+}
+
+type SetBytesRequest struct {
+	Key    string       `json:"key"`
+	Value  []byte       `json:"value"`
+	Setter *kvdb.Setter `json:"setter"`
+}
+
+type SetBytesResponse struct {
+	Conflict *kvdb.ConflictError `json:"conflict,omitempty"`
+}
 
 type SetMultiRequest struct {
 	KvPairs []string     `json:"kvPairs"`
 	Setter  *kvdb.Setter `json:"setter"`
+	// Entries is used instead of KvPairs and Setter if not empty, which
+	// carries expire time of every entry.
+	Entries []kvdb.Entry `json:"entries,omitempty"`
 }
 
 type SetMultiResponse struct{}
 
+type SetNXRequest struct {
+	Key    string       `json:"key"`
+	Value  string       `json:"value"`
+	Setter *kvdb.Setter `json:"setter"`
+}
+
+type SetNXResponse struct {
+	Ok bool `json:"ok"`
+}
+
+type CompareAndSwapRequest struct {
+	Key    string       `json:"key"`
+	Old    string       `json:"old"`
+	New    string       `json:"new"`
+	Setter *kvdb.Setter `json:"setter"`
+}
+
+type CompareAndSwapResponse struct {
+	Swapped bool `json:"swapped"`
+}
+
+type IncrRequest struct {
+	Key   string `json:"key"`
+	Delta int64  `json:"delta"`
+}
+
+type IncrResponse struct {
+	Value int64 `json:"value"`
+	// NotInteger is true if value of key is not an integer, so that client
+	// could return kvdb.ErrorNotInteger.
+	NotInteger bool `json:"notInteger,omitempty"`
+	// Overflow is true if result overflows, so that client could return
+	// kvdb.ErrorOverflow.
+	Overflow bool `json:"overflow,omitempty"`
+}
+
+type CommitRequest struct {
+	Txn *kvdb.Txn `json:"txn"`
+}
+
+type CommitResponse struct {
+	Ok bool `json:"ok"`
+}
+
 type DeleteRequest struct {
 	Key     string        `json:"key"`
 	Deleter *kvdb.Deleter `json:"deleter"`
@@ -53,6 +134,17 @@ type DeleteMultiRequest struct {
 
 type DeleteMultiResponse struct{}
 
+type ListKeysRequest struct {
+	Parent string       `json:"parent"`
+	Start  string       `json:"start"`
+	Limit  int          `json:"limit"`
+	Lister *kvdb.Lister `json:"lister"`
+}
+
+type ListKeysResponse struct {
+	Keys []string `json:"keys"`
+}
+
 type ExistRequest struct {
 	Key string `json:"key"`
 }
@@ -61,19 +153,107 @@ type ExistResponse struct {
 	Has bool `json:"has"`
 }
 
+type ExistMultiRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type ExistMultiResponse struct {
+	HasMap map[string]bool `json:"hasMap"`
+}
+
+type ExpireAtRequest struct {
+	Key string `json:"key"`
+}
+
+type ExpireAtResponse struct {
+	ExpireAt time.Time `json:"expireAt"`
+	Exist    bool      `json:"exist"`
+}
+
+type TouchRequest struct {
+	Key string        `json:"key"`
+	TTL time.Duration `json:"ttl"`
+}
+
+type TouchResponse struct {
+	Exist bool `json:"exist"`
+}
+
+type PersistRequest struct {
+	Key string `json:"key"`
+}
+
+type PersistResponse struct {
+	Exist bool `json:"exist"`
+}
+
+type CountRequest struct {
+	Key     string        `json:"key"`
+	Counter *kvdb.Counter `json:"counter"`
+}
+
+type CountResponse struct {
+	Count int `json:"count"`
+}
+
 type CleanupRequest struct{}
 
 type CleanupResponse struct{}
 
+type WatchRequest struct {
+	Key       string `json:"key"`
+	Recursive bool   `json:"recursive"`
+}
+
+type WatchResponse struct {
+	ID string `json:"id"`
+}
+
+// PollRequest waits for events of watch up to Wait, events are returned as
+// soon as any is available.
+type PollRequest struct {
+	ID   string        `json:"id"`
+	Wait time.Duration `json:"wait"`
+}
+
+type PollResponse struct {
+	Events []kvdb.Event `json:"events"`
+	// Closed is true if watch is closed or not found on server, which expires
+	// if it's not polled for a while.
+	Closed bool `json:"closed,omitempty"`
+}
+
+type UnwatchRequest struct {
+	ID string `json:"id"`
+}
+
+type UnwatchResponse struct{}
+
 type KVDBInterface interface {
 	Get(req GetRequest, resp *GetResponse) error
 	GetMulti(req GetMultiRequest, resp *GetMultiResponse) error
+	GetBytes(req GetBytesRequest, resp *GetBytesResponse) error
 	Set(req SetRequest, resp *SetResponse) error
+	SetBytes(req SetBytesRequest, resp *SetBytesResponse) error
 	SetMulti(req SetMultiRequest, resp *SetMultiResponse) error
+	SetNX(req SetNXRequest, resp *SetNXResponse) error
+	CompareAndSwap(req CompareAndSwapRequest,
+		resp *CompareAndSwapResponse) error
+	Incr(req IncrRequest, resp *IncrResponse) error
+	Commit(req CommitRequest, resp *CommitResponse) error
 	Delete(req DeleteRequest, resp *DeleteResponse) error
 	DeleteMulti(req DeleteMultiRequest, resp *DeleteMultiResponse) error
+	ListKeys(req ListKeysRequest, resp *ListKeysResponse) error
 	Exist(req ExistRequest, resp *ExistResponse) error
+	ExistMulti(req ExistMultiRequest, resp *ExistMultiResponse) error
+	ExpireAt(req ExpireAtRequest, resp *ExpireAtResponse) error
+	Touch(req TouchRequest, resp *TouchResponse) error
+	Persist(req PersistRequest, resp *PersistResponse) error
+	Count(req CountRequest, resp *CountResponse) error
 	Cleanup(req CleanupRequest, resp *CleanupResponse) error
+	Watch(req WatchRequest, resp *WatchResponse) error
+	Poll(req PollRequest, resp *PollResponse) error
+	Unwatch(req UnwatchRequest, resp *UnwatchResponse) error
 }
 
 type KVDBClient struct {
@@ -81,6 +261,11 @@ type KVDBClient struct {
 }
 
 func (c *KVDBClient) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	return c.GetContext(context.Background(), key, opts...)
+}
+
+func (c *KVDBClient) GetContext(ctx context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -90,12 +275,17 @@ func (c *KVDBClient) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error)
 		Getter: &gt,
 	}
 	var resp GetResponse
-	err := c.doCall(KVDBServiceName+".Get", req, &resp)
+	err := c.doCall(ctx, KVDBServiceName+".Get", req, &resp)
 	return resp.Node, err
 }
 
 func (c *KVDBClient) GetMulti(keys []string, opts ...kvdb.GetOption,
 ) (map[string]kvdb.Node, error) {
+	return c.GetMultiContext(context.Background(), keys, opts...)
+}
+
+func (c *KVDBClient) GetMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
 	var gt kvdb.Getter
 	for _, opt := range opts {
 		opt(&gt)
@@ -105,11 +295,30 @@ func (c *KVDBClient) GetMulti(keys []string, opts ...kvdb.GetOption,
 		Getter: &gt,
 	}
 	var resp GetMultiResponse
-	err := c.doCall(KVDBServiceName+".GetMulti", req, &resp)
+	err := c.doCall(ctx, KVDBServiceName+".GetMulti", req, &resp)
 	return resp.NodeMap, err
 }
 
+func (c *KVDBClient) GetBytes(key string) ([]byte, error) {
+	return c.GetBytesContext(context.Background(), key)
+}
+
+func (c *KVDBClient) GetBytesContext(ctx context.Context, key string,
+) ([]byte, error) {
+	req := GetBytesRequest{
+		Key: key,
+	}
+	var resp GetBytesResponse
+	err := c.doCall(ctx, KVDBServiceName+".GetBytes", req, &resp)
+	return resp.Value, err
+}
+
 func (c *KVDBClient) Set(key, value string, opts ...kvdb.SetOption) error {
+	return c.SetContext(context.Background(), key, value, opts...)
+}
+
+func (c *KVDBClient) SetContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
@@ -120,10 +329,43 @@ func (c *KVDBClient) Set(key, value string, opts ...kvdb.SetOption) error {
 		Setter: &st,
 	}
 	var resp SetResponse
-	return c.doCall(KVDBServiceName+".Set", req, &resp)
+	err := c.doCall(ctx, KVDBServiceName+".Set", req, &resp)
+	if err == nil && resp.Conflict != nil {
+		return resp.Conflict
+	}
+	return err
+}
+
+func (c *KVDBClient) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return c.SetBytesContext(context.Background(), key, value, opts...)
+}
+
+func (c *KVDBClient) SetBytesContext(ctx context.Context, key string,
+	value []byte, opts ...kvdb.SetOption) error {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := SetBytesRequest{
+		Key:    key,
+		Value:  value,
+		Setter: &st,
+	}
+	var resp SetBytesResponse
+	err := c.doCall(ctx, KVDBServiceName+".SetBytes", req, &resp)
+	if err == nil && resp.Conflict != nil {
+		return resp.Conflict
+	}
+	return err
 }
 
 func (c *KVDBClient) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
+	return c.SetMultiContext(context.Background(), kvPairs, opts...)
+}
+
+func (c *KVDBClient) SetMultiContext(ctx context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
 	var st kvdb.Setter
 	for _, opt := range opts {
 		opt(&st)
@@ -133,10 +375,112 @@ func (c *KVDBClient) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
 		Setter:  &st,
 	}
 	var resp SetResponse
-	return c.doCall(KVDBServiceName+".SetMulti", req, &resp)
+	return c.doCall(ctx, KVDBServiceName+".SetMulti", req, &resp)
+}
+
+func (c *KVDBClient) SetEntries(entries []kvdb.Entry) error {
+	return c.SetEntriesContext(context.Background(), entries)
+}
+
+func (c *KVDBClient) SetEntriesContext(ctx context.Context,
+	entries []kvdb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	req := SetMultiRequest{
+		Entries: entries,
+	}
+	var resp SetMultiResponse
+	return c.doCall(ctx, KVDBServiceName+".SetMulti", req, &resp)
+}
+
+func (c *KVDBClient) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	return c.SetNXContext(context.Background(), key, value, opts...)
+}
+
+func (c *KVDBClient) SetNXContext(ctx context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := SetNXRequest{
+		Key:    key,
+		Value:  value,
+		Setter: &st,
+	}
+	var resp SetNXResponse
+	err := c.doCall(ctx, KVDBServiceName+".SetNX", req, &resp)
+	return resp.Ok, err
+}
+
+func (c *KVDBClient) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return c.CompareAndSwapContext(context.Background(), key, old, new,
+		opts...)
+}
+
+func (c *KVDBClient) CompareAndSwapContext(ctx context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	req := CompareAndSwapRequest{
+		Key:    key,
+		Old:    old,
+		New:    new,
+		Setter: &st,
+	}
+	var resp CompareAndSwapResponse
+	err := c.doCall(ctx, KVDBServiceName+".CompareAndSwap", req, &resp)
+	return resp.Swapped, err
+}
+
+func (c *KVDBClient) Incr(key string, delta int64) (int64, error) {
+	return c.IncrContext(context.Background(), key, delta)
+}
+
+func (c *KVDBClient) IncrContext(ctx context.Context, key string,
+	delta int64) (int64, error) {
+	req := IncrRequest{
+		Key:   key,
+		Delta: delta,
+	}
+	var resp IncrResponse
+	if err := c.doCall(ctx, KVDBServiceName+".Incr", req, &resp); err != nil {
+		return 0, err
+	}
+	if resp.NotInteger {
+		return 0, kvdb.ErrorNotInteger
+	}
+	if resp.Overflow {
+		return 0, kvdb.ErrorOverflow
+	}
+	return resp.Value, nil
+}
+
+func (c *KVDBClient) Commit(txn *kvdb.Txn) (bool, error) {
+	return c.CommitContext(context.Background(), txn)
+}
+
+func (c *KVDBClient) CommitContext(ctx context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	req := CommitRequest{
+		Txn: txn,
+	}
+	var resp CommitResponse
+	err := c.doCall(ctx, KVDBServiceName+".Commit", req, &resp)
+	return resp.Ok, err
 }
 
 func (c *KVDBClient) Delete(key string, opts ...kvdb.DeleteOption) error {
+	return c.DeleteContext(context.Background(), key, opts...)
+}
+
+func (c *KVDBClient) DeleteContext(ctx context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
@@ -146,10 +490,15 @@ func (c *KVDBClient) Delete(key string, opts ...kvdb.DeleteOption) error {
 		Deleter: &dt,
 	}
 	var resp DeleteResponse
-	return c.doCall(KVDBServiceName+".Delete", req, &resp)
+	return c.doCall(ctx, KVDBServiceName+".Delete", req, &resp)
 }
 
 func (c *KVDBClient) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
+	return c.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+func (c *KVDBClient) DeleteMultiContext(ctx context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
 	var dt kvdb.Deleter
 	for _, opt := range opts {
 		opt(&dt)
@@ -159,21 +508,202 @@ func (c *KVDBClient) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error
 		Deleter: &dt,
 	}
 	var resp DeleteMultiResponse
-	return c.doCall(KVDBServiceName+".DeleteMulti", req, &resp)
+	return c.doCall(ctx, KVDBServiceName+".DeleteMulti", req, &resp)
+}
+
+func (c *KVDBClient) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	return c.ListKeysContext(context.Background(), parent, start, limit,
+		opts...)
+}
+
+func (c *KVDBClient) ListKeysContext(ctx context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	var ls kvdb.Lister
+	for _, opt := range opts {
+		opt(&ls)
+	}
+	req := ListKeysRequest{
+		Parent: parent,
+		Start:  start,
+		Limit:  limit,
+		Lister: &ls,
+	}
+	var resp ListKeysResponse
+	err := c.doCall(ctx, KVDBServiceName+".ListKeys", req, &resp)
+	return resp.Keys, err
 }
 
 func (c *KVDBClient) Exist(key string) (bool, error) {
+	return c.ExistContext(context.Background(), key)
+}
+
+func (c *KVDBClient) ExistContext(ctx context.Context, key string,
+) (bool, error) {
 	req := ExistRequest{
 		Key: key,
 	}
 	var resp ExistResponse
-	err := c.doCall(KVDBServiceName+".Exist", req, &resp)
+	err := c.doCall(ctx, KVDBServiceName+".Exist", req, &resp)
 	return resp.Has, err
 }
 
+func (c *KVDBClient) ExistMulti(keys []string) (map[string]bool, error) {
+	return c.ExistMultiContext(context.Background(), keys)
+}
+
+func (c *KVDBClient) ExistMultiContext(ctx context.Context, keys []string,
+) (map[string]bool, error) {
+	req := ExistMultiRequest{
+		Keys: keys,
+	}
+	var resp ExistMultiResponse
+	err := c.doCall(ctx, KVDBServiceName+".ExistMulti", req, &resp)
+	return resp.HasMap, err
+}
+
+func (c *KVDBClient) ExpireAt(key string) (time.Time, bool, error) {
+	return c.ExpireAtContext(context.Background(), key)
+}
+
+func (c *KVDBClient) ExpireAtContext(ctx context.Context, key string,
+) (time.Time, bool, error) {
+	req := ExpireAtRequest{
+		Key: key,
+	}
+	var resp ExpireAtResponse
+	err := c.doCall(ctx, KVDBServiceName+".ExpireAt", req, &resp)
+	return resp.ExpireAt, resp.Exist, err
+}
+
+func (c *KVDBClient) Touch(key string, ttl time.Duration) (bool, error) {
+	return c.TouchContext(context.Background(), key, ttl)
+}
+
+func (c *KVDBClient) TouchContext(ctx context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	req := TouchRequest{
+		Key: key,
+		TTL: ttl,
+	}
+	var resp TouchResponse
+	err := c.doCall(ctx, KVDBServiceName+".Touch", req, &resp)
+	return resp.Exist, err
+}
+
+func (c *KVDBClient) Persist(key string) (bool, error) {
+	return c.PersistContext(context.Background(), key)
+}
+
+func (c *KVDBClient) PersistContext(ctx context.Context, key string,
+) (bool, error) {
+	req := PersistRequest{
+		Key: key,
+	}
+	var resp PersistResponse
+	err := c.doCall(ctx, KVDBServiceName+".Persist", req, &resp)
+	return resp.Exist, err
+}
+
+func (c *KVDBClient) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	return c.CountContext(context.Background(), key, opts...)
+}
+
+func (c *KVDBClient) CountContext(ctx context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	var ct kvdb.Counter
+	for _, opt := range opts {
+		opt(&ct)
+	}
+	req := CountRequest{
+		Key:     key,
+		Counter: &ct,
+	}
+	var resp CountResponse
+	err := c.doCall(ctx, KVDBServiceName+".Count", req, &resp)
+	return resp.Count, err
+}
+
 func (c *KVDBClient) Cleanup() error {
+	return c.CleanupContext(context.Background())
+}
+
+func (c *KVDBClient) CleanupContext(ctx context.Context) error {
 	var resp CleanupResponse
-	return c.doCall(KVDBServiceName+".Cleanup", CleanupRequest{}, &resp)
+	return c.doCall(ctx, KVDBServiceName+".Cleanup", CleanupRequest{}, &resp)
+}
+
+func (c *KVDBClient) Watch(key string, recursive bool) (<-chan kvdb.Event,
+	error) {
+	return c.WatchContext(context.Background(), key, recursive)
+}
+
+// WatchContext register watch on server, and long poll events of it in
+// background until ctx is done, client is closed, watch is closed by server
+// or poll fails, then the channel is closed and watch is unregistered.
+func (c *KVDBClient) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	req := WatchRequest{
+		Key:       key,
+		Recursive: recursive,
+	}
+	var resp WatchResponse
+	if err := c.doCall(ctx, KVDBServiceName+".Watch", req, &resp); err != nil {
+		return nil, err
+	}
+	ch := make(chan kvdb.Event)
+	go c.poll(ctx, resp.ID, ch)
+	return ch, nil
+}
+
+func (c *KVDBClient) poll(ctx context.Context, id string,
+	ch chan<- kvdb.Event) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer close(ch)
+	defer c.unwatch(id)
+	for {
+		req := PollRequest{
+			ID:   id,
+			Wait: pollWait,
+		}
+		var resp PollResponse
+		if err := c.doCall(ctx, KVDBServiceName+".Poll", req, &resp); err != nil {
+			return
+		}
+		for _, e := range resp.Events {
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if resp.Closed {
+			return
+		}
+	}
+}
+
+// unwatch unregister watch on server, which is skipped if client is closed,
+// since the watch expires on server anyway.
+func (c *KVDBClient) unwatch(id string) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), unwatchTimeout)
+	defer cancel()
+	var resp UnwatchResponse
+	_ = c.doCall(ctx, KVDBServiceName+".Unwatch", UnwatchRequest{ID: id},
+		&resp)
 }
 
 func (c *KVDBClient) Close() error {
@@ -1,25 +1,48 @@
 package service_test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/elvinchan/kvdb"
+	"github.com/elvinchan/kvdb/internal"
 	"github.com/elvinchan/kvdb/service"
 	"github.com/elvinchan/kvdb/service/server"
 )
 
 type MockDB struct {
 	store   map[string]string
+	hub     *internal.Hub
 	mockErr error
 	errCnt  int
+	delay   time.Duration
+	closed  bool
 	mu      sync.Mutex
 }
 
 func (db *MockDB) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	db.mu.Lock()
+	delay := db.delay
+	db.mu.Unlock()
+	time.Sleep(delay)
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	if db.mockErr != nil {
@@ -28,7 +51,7 @@ func (db *MockDB) Get(key string, opts ...kvdb.GetOption) (*kvdb.Node, error) {
 	}
 	value, ok := db.store[key]
 	if ok {
-		return &kvdb.Node{Value: value}, nil
+		return &kvdb.Node{Value: value, Version: 1}, nil
 	}
 	return nil, nil
 }
@@ -51,10 +74,34 @@ func (db *MockDB) Set(key, value string, opts ...kvdb.SetOption) error {
 		db.errCnt++
 		return db.mockErr
 	}
+	var st kvdb.Setter
+	for _, opt := range opts {
+		opt(&st)
+	}
+	// mock version is 1 for existing key
+	if _, ok := db.store[key]; st.IfVersion && ok != (st.Version == 1) {
+		return &kvdb.ConflictError{Key: key, Version: st.Version}
+	}
 	db.store[key] = value
+	if db.hub != nil {
+		db.hub.Set(key, value, internal.ExpireTime(&st, time.Now()))
+	}
 	return nil
 }
 
+func (db *MockDB) GetBytes(key string) ([]byte, error) {
+	node, err := db.Get(key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return []byte(node.Value), nil
+}
+
+func (db *MockDB) SetBytes(key string, value []byte,
+	opts ...kvdb.SetOption) error {
+	return db.Set(key, string(value), opts...)
+}
+
 func (db *MockDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
 	for i := 0; i < len(kvPairs); i += 2 {
 		db.store[kvPairs[i]] = kvPairs[i+1]
@@ -62,8 +109,76 @@ func (db *MockDB) SetMulti(kvPairs []string, opts ...kvdb.SetOption) error {
 	return nil
 }
 
+func (db *MockDB) SetEntries(entries []kvdb.Entry) error {
+	for _, e := range entries {
+		db.store[e.Key] = e.Value
+	}
+	return nil
+}
+
+func (db *MockDB) SetNX(key, value string, opts ...kvdb.SetOption,
+) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.store[key]; ok {
+		return false, nil
+	}
+	db.store[key] = value
+	return true, nil
+}
+
+func (db *MockDB) CompareAndSwap(key, old, new string,
+	opts ...kvdb.SetOption) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if v, ok := db.store[key]; !ok || v != old {
+		return false, nil
+	}
+	db.store[key] = new
+	return true, nil
+}
+
+func (db *MockDB) Incr(key string, delta int64) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	v, ok := db.store[key]
+	if !ok {
+		v = "0"
+	}
+	n, err := internal.Incr(v, delta)
+	if err != nil {
+		return 0, err
+	}
+	db.store[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (db *MockDB) Commit(txn *kvdb.Txn) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, c := range txn.Conds {
+		v, ok := db.store[c.Key]
+		if (c.Type == kvdb.CondExist && !ok) ||
+			(c.Type == kvdb.CondNotExist && ok) ||
+			(c.Type == kvdb.CondValue && (!ok || v != c.Value)) {
+			return false, nil
+		}
+	}
+	for _, op := range txn.Ops {
+		if op.Type == kvdb.OpSet {
+			db.store[op.Key] = op.Value
+		} else {
+			delete(db.store, op.Key)
+		}
+	}
+	return true, nil
+}
+
 func (db *MockDB) Delete(key string, opts ...kvdb.DeleteOption) error {
 	delete(db.store, key)
+	if db.hub != nil {
+		db.hub.Delete(key, nil)
+	}
 	return nil
 }
 
@@ -74,17 +189,181 @@ func (db *MockDB) DeleteMulti(keys []string, opts ...kvdb.DeleteOption) error {
 	return nil
 }
 
+func (db *MockDB) ListKeys(parent, start string, limit int,
+	opts ...kvdb.ListOption) ([]string, error) {
+	var keys []string
+	for k := range db.store {
+		if strings.HasPrefix(k, parent+".") && k > start {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
 func (db *MockDB) Exist(key string) (bool, error) {
 	_, ok := db.store[key]
 	return ok, nil
 }
 
+func (db *MockDB) ExistMulti(keys []string) (map[string]bool, error) {
+	v := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		_, v[key] = db.store[key]
+	}
+	return v, nil
+}
+
+func (db *MockDB) ExpireAt(key string) (time.Time, bool, error) {
+	_, ok := db.store[key]
+	return time.Time{}, ok, nil
+}
+
+func (db *MockDB) Touch(key string, ttl time.Duration) (bool, error) {
+	_, ok := db.store[key]
+	return ok, nil
+}
+
+func (db *MockDB) Persist(key string) (bool, error) {
+	_, ok := db.store[key]
+	return ok, nil
+}
+
+func (db *MockDB) Count(key string, opts ...kvdb.CountOption) (int, error) {
+	var count int
+	for k := range db.store {
+		if strings.HasPrefix(k, key+".") {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (db *MockDB) Cleanup() error {
 	db.store = make(map[string]string)
 	return nil
 }
 
+func (db *MockDB) GetContext(_ context.Context, key string,
+	opts ...kvdb.GetOption) (*kvdb.Node, error) {
+	return db.Get(key, opts...)
+}
+
+func (db *MockDB) GetMultiContext(_ context.Context, keys []string,
+	opts ...kvdb.GetOption) (map[string]kvdb.Node, error) {
+	return db.GetMulti(keys, opts...)
+}
+
+func (db *MockDB) SetContext(_ context.Context, key, value string,
+	opts ...kvdb.SetOption) error {
+	return db.Set(key, value, opts...)
+}
+
+func (db *MockDB) GetBytesContext(_ context.Context, key string,
+) ([]byte, error) {
+	return db.GetBytes(key)
+}
+
+func (db *MockDB) SetBytesContext(_ context.Context, key string,
+	value []byte, opts ...kvdb.SetOption) error {
+	return db.SetBytes(key, value, opts...)
+}
+
+func (db *MockDB) SetMultiContext(_ context.Context, kvPairs []string,
+	opts ...kvdb.SetOption) error {
+	return db.SetMulti(kvPairs, opts...)
+}
+
+func (db *MockDB) SetEntriesContext(_ context.Context,
+	entries []kvdb.Entry) error {
+	return db.SetEntries(entries)
+}
+
+func (db *MockDB) SetNXContext(_ context.Context, key, value string,
+	opts ...kvdb.SetOption) (bool, error) {
+	return db.SetNX(key, value, opts...)
+}
+
+func (db *MockDB) CompareAndSwapContext(_ context.Context, key, old,
+	new string, opts ...kvdb.SetOption) (bool, error) {
+	return db.CompareAndSwap(key, old, new, opts...)
+}
+
+func (db *MockDB) IncrContext(_ context.Context, key string, delta int64,
+) (int64, error) {
+	return db.Incr(key, delta)
+}
+
+func (db *MockDB) CommitContext(_ context.Context, txn *kvdb.Txn,
+) (bool, error) {
+	return db.Commit(txn)
+}
+
+func (db *MockDB) DeleteContext(_ context.Context, key string,
+	opts ...kvdb.DeleteOption) error {
+	return db.Delete(key, opts...)
+}
+
+func (db *MockDB) DeleteMultiContext(_ context.Context, keys []string,
+	opts ...kvdb.DeleteOption) error {
+	return db.DeleteMulti(keys, opts...)
+}
+
+func (db *MockDB) ListKeysContext(_ context.Context, parent, start string,
+	limit int, opts ...kvdb.ListOption) ([]string, error) {
+	return db.ListKeys(parent, start, limit, opts...)
+}
+
+func (db *MockDB) ExistContext(_ context.Context, key string) (bool, error) {
+	return db.Exist(key)
+}
+
+func (db *MockDB) ExistMultiContext(_ context.Context, keys []string,
+) (map[string]bool, error) {
+	return db.ExistMulti(keys)
+}
+
+func (db *MockDB) ExpireAtContext(_ context.Context, key string,
+) (time.Time, bool, error) {
+	return db.ExpireAt(key)
+}
+
+func (db *MockDB) TouchContext(_ context.Context, key string,
+	ttl time.Duration) (bool, error) {
+	return db.Touch(key, ttl)
+}
+
+func (db *MockDB) PersistContext(_ context.Context, key string,
+) (bool, error) {
+	return db.Persist(key)
+}
+
+func (db *MockDB) CountContext(_ context.Context, key string,
+	opts ...kvdb.CountOption) (int, error) {
+	return db.Count(key, opts...)
+}
+
+func (db *MockDB) CleanupContext(_ context.Context) error {
+	return db.Cleanup()
+}
+
+func (db *MockDB) Watch(key string, recursive bool) (<-chan kvdb.Event,
+	error) {
+	return db.WatchContext(context.Background(), key, recursive)
+}
+
+func (db *MockDB) WatchContext(ctx context.Context, key string,
+	recursive bool) (<-chan kvdb.Event, error) {
+	return db.hub.Watch(ctx, key, recursive)
+}
+
 func (db *MockDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closed = true
 	return nil
 }
 
@@ -94,6 +373,7 @@ func TestServer(t *testing.T) {
 	go func() {
 		err := server.StartServer(&MockDB{
 			store: make(map[string]string),
+			hub:   internal.NewHub(kvdb.InitOption()),
 		}, "unix", sockFile)
 		if err != nil {
 			panic(err)
@@ -112,6 +392,13 @@ func TestServer(t *testing.T) {
 		}
 	}()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := db.WatchContext(ctx, "service", true)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
 	key := "service.g"
 	value := "0"
 	err = db.Set(key, value)
@@ -120,6 +407,23 @@ func TestServer(t *testing.T) {
 		t.Fail()
 	}
 
+	// events are long polled from server
+	select {
+	case e := <-events:
+		expect := kvdb.Event{Type: kvdb.EventSet, Key: key, Value: value}
+		if e != expect {
+			t.Errorf("event of Watch() not right, expect %v, got %v",
+				expect, e)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Errorf("event of Watch() not received")
+		t.Fail()
+	}
+	cancel()
+	for range events {
+	}
+
 	rst, err := db.Get(key)
 	if err != nil {
 		t.Error(err)
@@ -133,6 +437,150 @@ func TestServer(t *testing.T) {
 		t.Fail()
 	}
 
+	err = db.Set(key, value, kvdb.SetIfVersion(rst.Version))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set(key, value, kvdb.SetIfVersion(0))
+	var conflict *kvdb.ConflictError
+	if !errors.As(err, &conflict) || conflict.Key != key {
+		t.Errorf("error of Set() not right, expect conflict of %s, got %v",
+			key, err)
+		t.Fail()
+	}
+
+	// invalid UTF-8 is kept by base64 encoding of JSON
+	bin := []byte{0, 0xff, 0xfe, 'a'}
+	err = db.SetBytes("service.b", bin)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	b, err := db.GetBytes("service.b")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !reflect.DeepEqual(b, bin) {
+		t.Errorf("result of GetBytes() not right, expect %v, got %v", bin, b)
+		t.Fail()
+	}
+	b, err = db.GetBytes("service.none")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if b != nil {
+		t.Errorf("result of GetBytes() not right, expect nil, got %v", b)
+		t.Fail()
+	}
+
+	// binary codec is safe over service
+	typed := kvdb.NewTyped(db, kvdb.GobCodec)
+	type item struct {
+		Name string
+		Data []byte
+	}
+	err = typed.Set("service.t", item{Name: "t", Data: bin})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	var it item
+	found, err := typed.Get("service.t", &it)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !found || it.Name != "t" || !reflect.DeepEqual(it.Data, bin) {
+		t.Errorf("result of typed Get() not right, expect %v, got %v",
+			bin, it)
+		t.Fail()
+	}
+
+	ok, err := db.SetNX(key, "1")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if ok {
+		t.Errorf("result of SetNX() not right, expect %v, got %v", false, ok)
+		t.Fail()
+	}
+
+	ok, err = db.CompareAndSwap(key, value, value)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !ok {
+		t.Errorf("result of CompareAndSwap() not right, expect %v, got %v",
+			true, ok)
+		t.Fail()
+	}
+
+	n, err := db.Incr(key, 2)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if n != 2 {
+		t.Errorf("result of Incr() not right, expect %v, got %v", 2, n)
+		t.Fail()
+	}
+
+	_, err = db.Incr(key, -2)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	err = db.Set("service.s", "s")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	_, err = db.Incr("service.s", 1)
+	if !errors.Is(err, kvdb.ErrorNotInteger) {
+		t.Errorf("error of Incr() not right, expect %v, got %v",
+			kvdb.ErrorNotInteger, err)
+		t.Fail()
+	}
+	err = db.Set("service.s", strconv.FormatInt(math.MaxInt64, 10))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	_, err = db.Incr("service.s", 1)
+	if !errors.Is(err, kvdb.ErrorOverflow) {
+		t.Errorf("error of Incr() not right, expect %v, got %v",
+			kvdb.ErrorOverflow, err)
+		t.Fail()
+	}
+
+	ok, err = db.Commit(kvdb.NewTxn().If(kvdb.IfValue(key, "1")).
+		Delete(key))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if ok {
+		t.Errorf("result of Commit() not right, expect %v, got %v", false, ok)
+		t.Fail()
+	}
+
+	ok, err = db.Commit(kvdb.NewTxn().If(kvdb.IfValue(key, value)).
+		Set(key, value, kvdb.SetTTL(time.Minute)))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !ok {
+		t.Errorf("result of Commit() not right, expect %v, got %v", true, ok)
+		t.Fail()
+	}
+
 	has, err := db.Exist(key)
 	if err != nil {
 		t.Error(err)
@@ -143,6 +591,48 @@ func TestServer(t *testing.T) {
 		t.Fail()
 	}
 
+	_, exist, err := db.ExpireAt(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !exist {
+		t.Errorf("result of ExpireAt() not right, expect %v, got %v",
+			true, exist)
+		t.Fail()
+	}
+
+	exist, err = db.Touch(key, time.Minute)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !exist {
+		t.Errorf("result of Touch() not right, expect %v, got %v", true, exist)
+		t.Fail()
+	}
+
+	exist, err = db.Persist(key + ".none")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if exist {
+		t.Errorf("result of Persist() not right, expect %v, got %v",
+			false, exist)
+		t.Fail()
+	}
+
+	hasMap, err := db.ExistMulti([]string{key, key + ".none"})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !hasMap[key] || hasMap[key+".none"] {
+		t.Errorf("result of ExistMulti() not right, got %v", hasMap)
+		t.Fail()
+	}
+
 	err = db.Delete(key)
 	if err != nil {
 		t.Error(err)
@@ -190,6 +680,28 @@ func TestServer(t *testing.T) {
 		}
 	}
 
+	count, err := db.Count(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if count != len(kvs)/2 {
+		t.Errorf("result of Count() not right, expect %v, got %v",
+			len(kvs)/2, count)
+		t.Fail()
+	}
+
+	listKeys, err := db.ListKeys(key, "", -1)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !reflect.DeepEqual(listKeys, keys) {
+		t.Errorf("result of ListKeys() not right, expect %v, got %v",
+			keys, listKeys)
+		t.Fail()
+	}
+
 	err = db.DeleteMulti(keys)
 	if err != nil {
 		t.Error(err)
@@ -205,6 +717,25 @@ func TestServer(t *testing.T) {
 		t.Fail()
 	}
 
+	err = db.SetEntries([]kvdb.Entry{
+		{Key: kvs[0], Value: kvs[1]},
+		{Key: kvs[2], Value: kvs[3], ExpireAt: time.Now().Add(time.Hour)},
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	rsts, err = db.GetMulti(keys)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if len(rsts) != len(kvs)/2 {
+		t.Errorf("length of results not right, expect %v, got %v",
+			len(kvs)/2, len(rsts))
+		t.Fail()
+	}
+
 	err = db.Set(key, value)
 	if err != nil {
 		t.Error(err)
@@ -298,3 +829,578 @@ func TestRetry(t *testing.T) {
 	}
 	mockDB.mu.Unlock()
 }
+
+func TestContext(t *testing.T) {
+	sockFile := "test_context.sock"
+	defer os.Remove(sockFile)
+	mockDB := &MockDB{
+		store: make(map[string]string),
+	}
+	go func() {
+		err := server.StartServer(mockDB, "unix", sockFile)
+		if err != nil {
+			panic(err)
+		}
+	}()
+	time.Sleep(time.Millisecond * 100)
+	db, err := service.DialKVDBService("unix", sockFile)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer func() {
+		if err := db.(*service.KVDBClient).Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = db.SetContext(ctx, "service.c", "0")
+	if err != context.Canceled {
+		t.Errorf("err not right, expect %s, got %s", context.Canceled, err)
+		t.Fail()
+	}
+
+	// retry loop should stop when deadline exceeded
+	mockDB.mu.Lock()
+	mockDB.mockErr = errors.New("mock error")
+	mockDB.mu.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(),
+		time.Millisecond*100)
+	defer cancel()
+	_, err = db.GetContext(ctx, "service.c")
+	if err != context.DeadlineExceeded {
+		t.Errorf("err not right, expect %s, got %s",
+			context.DeadlineExceeded, err)
+		t.Fail()
+	}
+	mockDB.mu.Lock()
+	if mockDB.errCnt != 1 {
+		t.Errorf("error count not right, expect %d, got %d", 1, mockDB.errCnt)
+		t.Fail()
+	}
+	mockDB.mockErr = nil
+	mockDB.mu.Unlock()
+
+	// cancel during call of slow server, response decoded after that should
+	// not be written to result
+	err = db.Set("service.c", "1")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	mockDB.mu.Lock()
+	mockDB.delay = time.Millisecond * 200
+	mockDB.mu.Unlock()
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	rst, err := db.GetContext(ctx, "service.c")
+	if err != context.Canceled {
+		t.Errorf("err not right, expect %s, got %v", context.Canceled, err)
+		t.Fail()
+	}
+	if rst != nil {
+		t.Errorf("result not right, expect nil, got %v", rst)
+		t.Fail()
+	}
+	// wait for response of canceled call
+	time.Sleep(time.Millisecond * 300)
+	if rst != nil {
+		t.Errorf("result not right, expect nil, got %v", rst)
+		t.Fail()
+	}
+	mockDB.mu.Lock()
+	mockDB.delay = 0
+	mockDB.mu.Unlock()
+	rst, err = db.Get("service.c")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != "1" {
+		t.Errorf("result not right, expect %s, got %v", "1", rst)
+		t.Fail()
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	sockFile := "test_shutdown.sock"
+	defer os.Remove(sockFile)
+	mockDB := &MockDB{
+		store: make(map[string]string),
+		hub:   internal.NewHub(kvdb.InitOption()),
+	}
+	srv, err := server.NewServer(mockDB, server.CloseDBOnShutdown())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	db, err := service.DialKVDBService("unix", sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.(*service.KVDBClient).Close()
+
+	key := "service.sd"
+	err = db.Set(key, "0")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	// long poll of watch should not block shutdown
+	events, err := db.Watch(key, false)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	mockDB.mu.Lock()
+	mockDB.delay = time.Millisecond * 200
+	mockDB.mu.Unlock()
+	got := make(chan error, 1)
+	go func() {
+		rst, err := db.Get(key)
+		if err == nil && (rst == nil || rst.Value != "0") {
+			err = fmt.Errorf("result not right, expect %s, got %v", "0", rst)
+		}
+		got <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	start := time.Now()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("duration of Shutdown() not right, got %v", d)
+		t.Fail()
+	}
+	// request in progress is served before connection closed
+	if err = <-got; err != nil {
+		t.Errorf("err of request in progress not right, expect nil, got %v",
+			err)
+		t.Fail()
+	}
+	if err = <-served; err != server.ErrServerClosed {
+		t.Errorf("err of Serve() not right, expect %v, got %v",
+			server.ErrServerClosed, err)
+		t.Fail()
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("channel of Watch() not closed after shutdown")
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Errorf("channel of Watch() not closed after shutdown")
+		t.Fail()
+	}
+	mockDB.mu.Lock()
+	if !mockDB.closed {
+		t.Errorf("db not closed after shutdown")
+		t.Fail()
+	}
+	mockDB.mu.Unlock()
+
+	if err = srv.Serve(l); err != server.ErrServerClosed {
+		t.Errorf("err of Serve() not right, expect %v, got %v",
+			server.ErrServerClosed, err)
+		t.Fail()
+	}
+	mockDB.mu.Lock()
+	mockDB.delay = 0
+	mockDB.mu.Unlock()
+	if _, err = db.Get(key); err == nil {
+		t.Errorf("err of Get() after shutdown not right, expect not nil")
+		t.Fail()
+	}
+}
+
+// newCert create certificate of tmpl signed by parent, or self-signed if
+// parent is nil.
+func newCert(t *testing.T, tmpl *x509.Certificate, parent *tls.Certificate,
+) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, signerCert := key, tmpl
+	if parent != nil {
+		signer, signerCert = parent.PrivateKey.(*ecdsa.PrivateKey), parent.Leaf
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert,
+		&key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kvdb ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := newCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "kvdb server"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	clientCert := newCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "kvdb client"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	srv, err := server.NewServer(&MockDB{
+		store: make(map[string]string),
+	}, server.TLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+
+	cases := []struct {
+		opts   []service.DialOption
+		expect bool
+	}{
+		// mutual TLS
+		{[]service.DialOption{service.TLS(&tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{clientCert},
+		})}, true},
+		// client certificate missing
+		{[]service.DialOption{service.TLS(&tls.Config{
+			RootCAs: pool,
+		})}, false},
+		// server certificate not trusted
+		{[]service.DialOption{service.TLS(&tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+		})}, false},
+		// plaintext
+		{nil, false},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			db, err := service.DialKVDBService("tcp", l.Addr().String(),
+				c.opts...)
+			if err == nil {
+				defer db.(*service.KVDBClient).Close()
+				ctx, cancel := context.WithTimeout(context.Background(),
+					time.Second*2)
+				defer cancel()
+				err = db.SetContext(ctx, "service.tls", "1")
+			}
+			if (err == nil) != c.expect {
+				t.Errorf("result of case %d not right, expect %v, got %v",
+					i, c.expect, err)
+				t.Fail()
+			}
+			if err != nil {
+				return
+			}
+			rst, err := db.Get("service.tls")
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if rst == nil || rst.Value != "1" {
+				t.Errorf("result not right, expect %s, got %v", "1", rst)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("secret")
+	cases := []struct {
+		auth   server.Authenticator
+		opts   []service.DialOption
+		expect bool
+	}{
+		{server.TokenAuth(map[string]string{"t": "a"}),
+			[]service.DialOption{service.Auth(service.Token("t"))}, true},
+		{server.TokenAuth(map[string]string{"t": "a"}),
+			[]service.DialOption{service.Auth(service.Token("x"))}, false},
+		{server.TokenAuth(map[string]string{"t": "a"}), nil, false},
+		{server.HMACAuth(map[string][]byte{"a": secret}),
+			[]service.DialOption{service.Auth(service.HMAC("a", secret))}, true},
+		{server.HMACAuth(map[string][]byte{"a": secret}),
+			[]service.DialOption{service.Auth(service.HMAC("a",
+				[]byte("x")))}, false},
+		{server.HMACAuth(map[string][]byte{"a": secret}),
+			[]service.DialOption{service.Auth(service.HMAC("b", secret))},
+			false},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			sockFile := "test_auth.sock"
+			defer os.Remove(sockFile)
+			srv, err := server.NewServer(&MockDB{
+				store: make(map[string]string),
+			}, server.Auth(c.auth))
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := net.Listen("unix", sockFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				_ = srv.Serve(l)
+			}()
+			defer func() {
+				if err := srv.Shutdown(context.Background()); err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+			}()
+
+			db, err := service.DialKVDBService("unix", sockFile, c.opts...)
+			if err == nil {
+				defer db.(*service.KVDBClient).Close()
+				err = db.Set("service.auth", "1")
+			} else if !errors.Is(err, service.ErrorAuthFailed) {
+				t.Errorf("err of DialKVDBService() not right, expect %v, "+
+					"got %v", service.ErrorAuthFailed, err)
+				t.Fail()
+			}
+			if (err == nil) != c.expect {
+				t.Errorf("result of case %d not right, expect %v, got %v",
+					i, c.expect, err)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	sockFile := "test_authorize.sock"
+	defer os.Remove(sockFile)
+	srv, err := server.NewServer(&MockDB{
+		store: make(map[string]string),
+		hub:   internal.NewHub(kvdb.InitOption()),
+	}, server.Auth(server.TokenAuth(map[string]string{
+		"ta": "admin",
+		"tp": "prefix",
+		"tr": "reader",
+		"tn": "nobody",
+	})), server.Authorize(server.Policy{
+		"admin":  {},
+		"prefix": {Prefixes: []string{"service.p"}},
+		"reader": {ReadOnly: true},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+
+	dbs := make(map[string]kvdb.KVDB)
+	for _, token := range []string{"ta", "tp", "tr", "tn"} {
+		db, err := service.DialKVDBService("unix", sockFile,
+			service.Auth(service.Token(token)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.(*service.KVDBClient).Close()
+		dbs[token] = db
+	}
+	watch := func(db kvdb.KVDB, key string) error {
+		_, err := db.Watch(key, true)
+		return err
+	}
+	cases := []struct {
+		token  string
+		fn     func(db kvdb.KVDB) error
+		expect bool
+	}{
+		{"ta", func(db kvdb.KVDB) error {
+			return db.Set("service.a", "1")
+		}, true},
+		{"ta", func(db kvdb.KVDB) error {
+			return db.Cleanup()
+		}, true},
+		{"tp", func(db kvdb.KVDB) error {
+			return db.Set("service.p.a", "1")
+		}, true},
+		{"tp", func(db kvdb.KVDB) error {
+			_, err := db.ListKeys("service.p", "", 0)
+			return err
+		}, true},
+		{"tp", func(db kvdb.KVDB) error {
+			return watch(db, "service.p")
+		}, true},
+		{"tp", func(db kvdb.KVDB) error {
+			_, err := db.Get("service.a")
+			return err
+		}, false},
+		{"tp", func(db kvdb.KVDB) error {
+			// not a descendant of service.p
+			return db.Set("service.pa", "1")
+		}, false},
+		{"tp", func(db kvdb.KVDB) error {
+			return db.SetMulti([]string{"service.p.a", "1", "service.a", "1"})
+		}, false},
+		{"tp", func(db kvdb.KVDB) error {
+			_, err := db.Commit(kvdb.NewTxn().If(kvdb.IfExist("service.a")).
+				Set("service.p.a", "2"))
+			return err
+		}, false},
+		{"tp", func(db kvdb.KVDB) error {
+			return watch(db, "service")
+		}, false},
+		{"tp", func(db kvdb.KVDB) error {
+			return db.Cleanup()
+		}, false},
+		{"tr", func(db kvdb.KVDB) error {
+			_, err := db.Get("service.a")
+			return err
+		}, true},
+		{"tr", func(db kvdb.KVDB) error {
+			return db.Delete("service.a")
+		}, false},
+		{"tr", func(db kvdb.KVDB) error {
+			_, err := db.Incr("service.i", 1)
+			return err
+		}, false},
+		{"tn", func(db kvdb.KVDB) error {
+			_, err := db.Exist("service.a")
+			return err
+		}, false},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := c.fn(dbs[c.token])
+			if c.expect && err != nil {
+				t.Errorf("err of case %d not right, expect nil, got %v", i, err)
+				t.Fail()
+			}
+			if !c.expect && !errors.Is(err, service.ErrorPermissionDenied) {
+				t.Errorf("err of case %d not right, expect %v, got %v",
+					i, service.ErrorPermissionDenied, err)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestAuthorizeKeyPathSep(t *testing.T) {
+	sockFile := "test_authorize_sep.sock"
+	defer os.Remove(sockFile)
+	srv, err := server.NewServer(&MockDB{
+		store: make(map[string]string),
+		hub:   internal.NewHub(kvdb.InitOption()),
+	}, server.KeyPathSep("/"), server.Authorize(server.Policy{
+		"": {Prefixes: []string{"tenant"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	}()
+
+	db, err := service.DialKVDBService("unix", sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.(*service.KVDBClient).Close()
+	cases := []struct {
+		key    string
+		expect bool
+	}{
+		{"tenant", true},
+		{"tenant/x", true},
+		{"tenant/x/y", true},
+		// siblings sharing prefix of tenant
+		{"tenant.evil", false},
+		{"tenantx", false},
+		{"other/x", false},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := db.Set(c.key, "1")
+			if c.expect && err != nil {
+				t.Errorf("err of Set(%s) not right, expect nil, got %v",
+					c.key, err)
+				t.Fail()
+			}
+			if !c.expect && !errors.Is(err, service.ErrorPermissionDenied) {
+				t.Errorf("err of Set(%s) not right, expect %v, got %v",
+					c.key, service.ErrorPermissionDenied, err)
+				t.Fail()
+			}
+		})
+	}
+}
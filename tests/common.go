@@ -1,7 +1,12 @@
 package tests
 
 import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -141,22 +146,23 @@ func TestGetSet(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 			Start                     string
 			Limit                     int
 			KeyRstIndex, KeyRstLength int
+			HasMore                   bool
 		}{
-			{0, "", -1, 1, 4},
-			{0, "", 1, 1, 1},
-			{0, "", 0, 1, 2},
-			{0, "group.g.child1", -1, 2, 3},
-			{0, "group.g.child1", 0, 2, 2},
-			{0, "group.g.child1", 1, 2, 1},
-			{0, "child1", -1, 2, 3},
-			{0, "child1", 0, 2, 2},
-			{0, "child1", 1, 2, 1},
-			{2, "", -1, 0, 0},
-			{3, "", 2, 5, 2},
-			{3, "group.g.child3.grandchild2", 2, 7, 1},
-			{3, "group.g.child3.grandchild3", -1, 0, 0},
-			{3, "grandchild2", 2, 7, 1},
-			{3, "grandchild3", -1, 0, 0},
+			{0, "", -1, 1, 4, false},
+			{0, "", 1, 1, 1, true},
+			{0, "", 0, 1, 2, true},
+			{0, "group.g.child1", -1, 2, 3, false},
+			{0, "group.g.child1", 0, 2, 2, true},
+			{0, "group.g.child1", 1, 2, 1, true},
+			{0, "child1", -1, 2, 3, false},
+			{0, "child1", 0, 2, 2, true},
+			{0, "child1", 1, 2, 1, true},
+			{2, "", -1, 0, 0, false},
+			{3, "", 2, 5, 2, true},
+			{3, "group.g.child3.grandchild2", 2, 7, 1, false},
+			{3, "group.g.child3.grandchild3", -1, 0, 0, false},
+			{3, "grandchild2", 2, 7, 1, false},
+			{3, "grandchild3", -1, 0, 0, false},
 		}
 
 		for i, c := range cases {
@@ -182,6 +188,161 @@ func TestGetSet(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 						}
 					}
 				}
+				if rst == nil {
+					return
+				}
+				if len(rst.ChildList) != c.KeyRstLength {
+					t.Errorf("length of child list not right, expect %v, got %v",
+						c.KeyRstLength, len(rst.ChildList))
+					t.Fail()
+				} else {
+					for j, kv := range rst.ChildList {
+						k := (c.KeyRstIndex + j) * 2
+						if kv.Key != kvs[k] || kv.Value != kvs[k+1] {
+							t.Errorf("child not right, expect %s: %s, got %s: %s",
+								kvs[k], kvs[k+1], kv.Key, kv.Value)
+							t.Fail()
+						}
+					}
+				}
+				if rst.HasMore != c.HasMore {
+					t.Errorf("has more not right, expect %v, got %v",
+						c.HasMore, rst.HasMore)
+					t.Fail()
+				}
+				var next string
+				if c.HasMore {
+					next = kvs[(c.KeyRstIndex+c.KeyRstLength-1)*2]
+				}
+				if rst.Next != next {
+					t.Errorf("next not right, expect %s, got %s", next, rst.Next)
+					t.Fail()
+				}
+			})
+		}
+	})
+
+	t.Run("ChildrenPagination", func(t *testing.T) {
+		db, err := newDB()
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				panic(err)
+			}
+		}()
+		err = db.SetMulti(kvs)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+
+		cases := []struct {
+			Option func(start string, limit int) kvdb.GetOption
+			Expect []string
+		}{
+			{kvdb.GetChildren, []string{kvs[2], kvs[4], kvs[6], kvs[8]}},
+			{kvdb.GetChildrenBefore, []string{kvs[8], kvs[6], kvs[4], kvs[2]}},
+		}
+
+		for i, c := range cases {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				var got []string
+				var start string
+				for {
+					rst, err := db.Get(kvs[0], c.Option(start, 1))
+					if err != nil {
+						t.Error(err)
+						t.Fail()
+						return
+					}
+					for _, kv := range rst.ChildList {
+						got = append(got, kv.Key)
+					}
+					if !rst.HasMore {
+						break
+					}
+					start = rst.Next
+				}
+				if !reflect.DeepEqual(got, c.Expect) {
+					t.Errorf("children not right, expect %v, got %v", c.Expect, got)
+					t.Fail()
+				}
+			})
+		}
+	})
+
+	t.Run("BoundedChildren", func(t *testing.T) {
+		db, err := newDB()
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				panic(err)
+			}
+		}()
+		err = db.SetMulti(kvs)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+
+		cases := []struct {
+			KeyGet     int
+			Start, End string
+			Limit      int
+			Reverse    bool
+			KeyRst     []int
+			HasMore    bool
+		}{
+			{0, "", "", -1, true, []int{4, 3, 2, 1}, false},
+			{0, "", "", 2, true, []int{4, 3}, true},
+			{0, "child3", "", 0, true, []int{2, 1}, false},
+			{0, "group.g.child4", "child1", -1, true, []int{3, 2}, false},
+			{0, "", "child3", -1, false, []int{1, 2}, false},
+			{0, "child1", "group.g.child4", 1, false, []int{2}, true},
+			{0, "child2", "child3", -1, false, []int{}, false},
+			{3, "", "", 1, true, []int{7}, true},
+			{3, "grandchild1", "", -1, true, []int{}, false},
+		}
+
+		for i, c := range cases {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				opt := kvdb.GetChildren(c.Start, c.Limit)
+				if c.Reverse {
+					opt = kvdb.GetChildrenBefore(c.Start, c.Limit)
+				}
+				rst, err := db.Get(kvs[c.KeyGet*2], opt, kvdb.GetChildrenEnd(c.End))
+				if err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+				if rst == nil {
+					t.Errorf("result not right, expect not nil")
+					t.Fail()
+					return
+				}
+				got := make([]string, 0, len(rst.ChildList))
+				for _, kv := range rst.ChildList {
+					got = append(got, kv.Key)
+				}
+				expect := make([]string, 0, len(c.KeyRst))
+				for _, j := range c.KeyRst {
+					expect = append(expect, kvs[j*2])
+				}
+				if !reflect.DeepEqual(got, expect) {
+					t.Errorf("children not right, expect %v, got %v", expect, got)
+					t.Fail()
+				}
+				if rst.HasMore != c.HasMore {
+					t.Errorf("has more not right, expect %v, got %v",
+						c.HasMore, rst.HasMore)
+					t.Fail()
+				}
 			})
 		}
 	})
@@ -284,6 +445,94 @@ func TestGetSet(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 		}
 	})
 
+	t.Run("WithDescendants", func(t *testing.T) {
+		db, err := newDB()
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				panic(err)
+			}
+		}()
+		err = db.SetMulti(kvs)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+
+		cases := []struct {
+			Depth int
+			// index of key -> index of children
+			Tree map[int][]int
+		}{
+			{1, map[int][]int{0: {1, 2, 3, 4}}},
+			{2, map[int][]int{0: {1, 2, 3, 4}, 3: {5, 6, 7}}},
+			{0, map[int][]int{0: {1, 2, 3, 4}, 3: {5, 6, 7}}},
+			{-1, map[int][]int{0: {1, 2, 3, 4}, 3: {5, 6, 7}}},
+		}
+
+		var check func(t *testing.T, idx int, descendants map[string]kvdb.Node,
+			tree map[int][]int)
+		check = func(t *testing.T, idx int, descendants map[string]kvdb.Node,
+			tree map[int][]int) {
+			if len(descendants) != len(tree[idx]) {
+				t.Errorf("length of descendants of %s not right, expect %v, got %v",
+					kvs[idx*2], len(tree[idx]), len(descendants))
+				t.Fail()
+				return
+			}
+			for _, ci := range tree[idx] {
+				d, ok := descendants[kvs[ci*2]]
+				if !ok {
+					t.Errorf("descendant %s not exist", kvs[ci*2])
+					t.Fail()
+				} else if d.Value != kvs[ci*2+1] {
+					t.Errorf("value not right, expect %s, got %s",
+						kvs[ci*2+1], d.Value)
+					t.Fail()
+				}
+				check(t, ci, d.Descendants, tree)
+			}
+		}
+
+		for i, c := range cases {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				rst, err := db.Get(kvs[0], kvdb.GetDescendants(c.Depth))
+				if err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+				if rst == nil {
+					t.Errorf("result not right, expect not nil")
+					t.Fail()
+				} else if rst.Children != nil {
+					t.Errorf("children not right, expect nil")
+					t.Fail()
+				} else {
+					check(t, 0, rst.Descendants, c.Tree)
+				}
+
+				rsts, err := db.GetMulti([]string{kvs[0], kvs[6]},
+					kvdb.GetDescendants(c.Depth))
+				if err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+				if len(rsts) != 2 {
+					t.Errorf("length of results not right, expect %v, got %v",
+						2, len(rsts))
+					t.Fail()
+				} else {
+					check(t, 0, rsts[kvs[0]].Descendants, c.Tree)
+					check(t, 3, rsts[kvs[6]].Descendants,
+						map[int][]int{3: {5, 6, 7}})
+				}
+			})
+		}
+	})
+
 	t.Run("WithExpire", func(t *testing.T) {
 		db, err := newDB()
 		if err != nil {
@@ -434,6 +683,103 @@ func TestGetSet(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 	})
 }
 
+func TestSetEntries(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	now := time.Now()
+	entries := []kvdb.Entry{
+		{Key: "group.se", Value: "1"},
+		{Key: "group.se.child1", Value: "2", ExpireAt: now.Add(time.Hour)},
+		{Key: "group.se.child2", Value: "3", ExpireAt: now.Add(ExpireAfter)},
+		{Key: "group.se.child3", Value: "4", ExpireAt: now.Add(-time.Second)},
+	}
+	err = db.SetEntries(entries)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	check := func(expect []int) {
+		rst, err := db.Get(entries[0].Key, kvdb.GetChildren("", -1))
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if rst == nil {
+			t.Errorf("result not right, expect not nil")
+			t.Fail()
+			return
+		}
+		if rst.Value != entries[0].Value {
+			t.Errorf("value not right, expect %s, got %s",
+				entries[0].Value, rst.Value)
+			t.Fail()
+		}
+		if len(rst.ChildList) != len(expect) {
+			t.Errorf("length of children not right, expect %v, got %v",
+				len(expect), len(rst.ChildList))
+			t.Fail()
+			return
+		}
+		for i, j := range expect {
+			if rst.ChildList[i].Key != entries[j].Key ||
+				rst.ChildList[i].Value != entries[j].Value {
+				t.Errorf("child not right, expect %v, got %v",
+					entries[j], rst.ChildList[i])
+				t.Fail()
+			}
+		}
+	}
+	check([]int{1, 2})
+	time.Sleep(ExpireAfter)
+	check([]int{1})
+
+	// the last entry wins if key is repeated
+	keyDup := "group.sedup"
+	err = db.SetEntries([]kvdb.Entry{
+		{Key: keyDup, Value: "1", ExpireAt: now.Add(time.Hour)},
+		{Key: keyDup, Value: "2"},
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	rst, err := db.Get(keyDup)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != "2" {
+		t.Errorf("result of %s not right, expect value %s, got %v",
+			keyDup, "2", rst)
+		t.Fail()
+	}
+	at, exist, err := db.ExpireAt(keyDup)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !exist || !at.IsZero() {
+		t.Errorf("expire time of %s not right, expect zero, got %v",
+			keyDup, at)
+		t.Fail()
+	}
+
+	err = db.SetEntries(nil)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
 func TestDelete(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 	kvs := []string{
 		"group.d", "1",
@@ -442,6 +788,7 @@ func TestDelete(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 		"group.d.child3", "4",
 		"group.d.child3.grandchild1", "5",
 		"group.d.child3.grandchild2", "6",
+		"group.d.child3.grandchild1.greatgrandchild1", "7",
 	}
 	var keys []string
 	for i := 0; i < len(kvs); i += 2 {
@@ -655,34 +1002,149 @@ func TestDelete(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 	})
 }
 
-func TestExist(t *testing.T, newDB func() (kvdb.KVDB, error)) {
-	db, err := newDB()
-	if err != nil {
-		panic(err)
+func TestDeleteDescendants(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	kvs := []string{
+		"group.dd", "1",
+		"group.dd.child1", "2",
+		"group.dd.child1.grandchild1", "3",
+		"group.dd.child1.grandchild1.greatgrandchild1", "4",
+		"group.dd.child2", "5",
+		"group.dd.child3.grandchild2", "6", // without parent
+		"group.dd.child3.grandchild2.greatgrandchild2", "7",
+		"group.ddx", "8", // sibling with common prefix
+		"group.ddx.child1", "9",
+		"group.de", "10",
+		"group.de.child1.grandchild1", "11",
 	}
-	defer func() {
-		err := db.Close()
-		if err != nil {
-			panic(err)
-		}
-	}()
-	key := "group.e"
-	has, err := db.Exist(key)
-	if err != nil {
-		t.Error(err)
-		t.Fail()
+	var keys []string
+	for i := 0; i < len(kvs); i += 2 {
+		keys = append(keys, kvs[i])
 	}
 
-	if has {
-		t.Errorf("result of Exist() not right, expect %v, got %v", false, has)
-		t.Fail()
+	check := func(t *testing.T, db kvdb.KVDB, deleted map[int]bool) {
+		for i := 0; i < len(kvs); i += 2 {
+			rst, err := db.Get(kvs[i])
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if deleted[i/2] {
+				if rst != nil {
+					t.Errorf("result of %s not right, expect nil", kvs[i])
+					t.Fail()
+				}
+			} else {
+				if rst == nil {
+					t.Errorf("result of %s not right, expect not nil", kvs[i])
+					t.Fail()
+				} else if rst.Value != kvs[i+1] {
+					t.Errorf("value not right, expect %v, got %v",
+						kvs[i+1], rst.Value)
+					t.Fail()
+				}
+			}
+		}
 	}
 
-	err = db.Set(key, "1")
-	if err != nil {
-		t.Error(err)
-		t.Fail()
-	}
+	t.Run("Delete", func(t *testing.T) {
+		db, err := newDB()
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				panic(err)
+			}
+		}()
+		err = db.SetMulti(kvs)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		check(t, db, nil)
+
+		err = db.Delete(kvs[0], kvdb.DeleteDescendants())
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		check(t, db, map[int]bool{0: true, 1: true, 2: true, 3: true, 4: true,
+			5: true, 6: true})
+
+		rst, err := db.Get("group", kvdb.GetDescendants(0))
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if rst != nil {
+			t.Errorf("result not right, expect nil")
+			t.Fail()
+		}
+	})
+
+	t.Run("DeleteMulti", func(t *testing.T) {
+		db, err := newDB()
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				panic(err)
+			}
+		}()
+		err = db.SetMulti(kvs)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		check(t, db, nil)
+
+		err = db.DeleteMulti([]string{kvs[2], kvs[18]},
+			kvdb.DeleteDescendants())
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		check(t, db, map[int]bool{1: true, 2: true, 3: true, 9: true, 10: true})
+
+		err = db.DeleteMulti(keys)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+	})
+}
+
+func TestExist(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	key := "group.e"
+	has, err := db.Exist(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	if has {
+		t.Errorf("result of Exist() not right, expect %v, got %v", false, has)
+		t.Fail()
+	}
+
+	err = db.Set(key, "1")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
 
 	has, err = db.Exist(key)
 	if err != nil {
@@ -694,4 +1156,1237 @@ func TestExist(t *testing.T, newDB func() (kvdb.KVDB, error)) {
 		t.Errorf("result of Exist() not right, expect %v, got %v", true, has)
 		t.Fail()
 	}
+
+	expiredKey := "group.e.expired"
+	err = db.Set(expiredKey, "2", kvdb.SetExpire(time.Now().Add(-time.Second)))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	has, err = db.Exist(expiredKey)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	if has {
+		t.Errorf("result of Exist() not right, expect %v, got %v", false, has)
+		t.Fail()
+	}
+
+	liveKey := "group.e.live"
+	err = db.Set(liveKey, "3", kvdb.SetExpire(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	expect := map[string]bool{
+		key:          true,
+		expiredKey:   false,
+		liveKey:      true,
+		"group.e.no": false,
+	}
+	keys := make([]string, 0, len(expect))
+	for k := range expect {
+		keys = append(keys, k)
+	}
+	hasMap, err := db.ExistMulti(keys)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(hasMap, expect) {
+		t.Errorf("result of ExistMulti() not right, expect %v, got %v",
+			expect, hasMap)
+		t.Fail()
+	}
+}
+
+func TestListKeys(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	err = db.SetMulti([]string{
+		"group.ls", "1",
+		"group.ls.child1", "2",
+		"group.ls.child2", "3",
+		"group.ls.child4", "4",
+		"group.ls.child2.grandchild1", "5",
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set("group.ls.child3", "6",
+		kvdb.SetExpire(time.Now().Add(-time.Second)))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	cases := []struct {
+		Parent, Start string
+		Limit         int
+		BareKey       bool
+		Keys          []string
+	}{
+		{"group.ls", "", -1, false, []string{
+			"group.ls.child1", "group.ls.child2", "group.ls.child4",
+		}},
+		{"group.ls", "", 0, false, []string{
+			"group.ls.child1", "group.ls.child2",
+		}},
+		{"group.ls", "child1", 1, false, []string{"group.ls.child2"}},
+		{"group.ls", "group.ls.child2", -1, false, []string{"group.ls.child4"}},
+		{"group.ls", "", -1, true, []string{"child1", "child2", "child4"}},
+		{"group.ls.child2", "", -1, false, []string{
+			"group.ls.child2.grandchild1",
+		}},
+		{"group.ls.child4", "", -1, false, []string{}},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var opts []kvdb.ListOption
+			if c.BareKey {
+				opts = append(opts, kvdb.ListBareKey())
+			}
+			keys, err := db.ListKeys(c.Parent, c.Start, c.Limit, opts...)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if len(keys) != len(c.Keys) ||
+				(len(keys) > 0 && !reflect.DeepEqual(keys, c.Keys)) {
+				t.Errorf("result of ListKeys() not right, expect %v, got %v",
+					c.Keys, keys)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	checkExpireAt := func(key string, exist, expire bool) {
+		at, has, err := db.ExpireAt(key)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if has != exist {
+			t.Errorf("exist of ExpireAt(%s) not right, expect %v, got %v",
+				key, exist, has)
+			t.Fail()
+		}
+		if !at.IsZero() != expire {
+			t.Errorf("result of ExpireAt(%s) not right, expect expire %v, got %v",
+				key, expire, at)
+			t.Fail()
+		} else if expire && (at.Before(time.Now().Add(-time.Second)) ||
+			at.After(time.Now().Add(ExpireAfter+time.Second))) {
+			t.Errorf("result of ExpireAt(%s) not right, got %v", key, at)
+			t.Fail()
+		}
+	}
+	checkResult := func(name string, expect, got bool, err error) {
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if got != expect {
+			t.Errorf("result of %s not right, expect %v, got %v",
+				name, expect, got)
+			t.Fail()
+		}
+	}
+
+	keyA, keyB, keyNone := "group.ttl.a", "group.ttl.b", "group.ttl.none"
+	err = db.Set(keyA, "1", kvdb.SetTTL(ExpireAfter))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.SetMulti([]string{keyB, "2"})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	checkExpireAt(keyA, true, true)
+	checkExpireAt(keyB, true, false)
+	checkExpireAt(keyNone, false, false)
+
+	has, err := db.Touch(keyB, ExpireAfter)
+	checkResult("Touch()", true, has, err)
+	has, err = db.Persist(keyA)
+	checkResult("Persist()", true, has, err)
+	has, err = db.Touch(keyNone, ExpireAfter)
+	checkResult("Touch()", false, has, err)
+	has, err = db.Persist(keyNone)
+	checkResult("Persist()", false, has, err)
+	checkExpireAt(keyA, true, false)
+	checkExpireAt(keyB, true, true)
+
+	time.Sleep(ExpireAfter * 2)
+	rst, err := db.Get(keyA)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != "1" {
+		t.Errorf("result not right, expect %s, got %v", "1", rst)
+		t.Fail()
+	}
+	rst, err = db.Get(keyB)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst != nil {
+		t.Errorf("result not right, expect nil")
+		t.Fail()
+	}
+	checkExpireAt(keyB, false, false)
+	has, err = db.Touch(keyB, ExpireAfter)
+	checkResult("Touch()", false, has, err)
+	has, err = db.Persist(keyB)
+	checkResult("Persist()", false, has, err)
+}
+
+func TestSetNX(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	checkValue := func(key, value string) {
+		rst, err := db.Get(key)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if rst == nil || rst.Value != value {
+			t.Errorf("result of Get(%s) not right, expect %s, got %v",
+				key, value, rst)
+			t.Fail()
+		}
+	}
+
+	keyA, keyB := "group.nx.a", "group.nx.b"
+	cases := []struct {
+		key    string
+		value  string
+		opts   []kvdb.SetOption
+		expect bool
+	}{
+		{keyA, "1", []kvdb.SetOption{kvdb.SetTTL(ExpireAfter)}, true},
+		{keyA, "2", nil, false},
+		{keyB, "1", nil, true},
+		{keyB, "2", nil, false},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ok, err := db.SetNX(c.key, c.value, c.opts...)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if ok != c.expect {
+				t.Errorf("result of SetNX(%s) not right, expect %v, got %v",
+					c.key, c.expect, ok)
+				t.Fail()
+			}
+		})
+	}
+	checkValue(keyA, "1")
+	checkValue(keyB, "1")
+
+	// expired key is treated as not exist
+	time.Sleep(ExpireAfter * 2)
+	ok, err := db.SetNX(keyA, "3")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !ok {
+		t.Errorf("result of SetNX(%s) not right, expect %v, got %v",
+			keyA, true, ok)
+		t.Fail()
+	}
+	checkValue(keyA, "3")
+	at, _, err := db.ExpireAt(keyA)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !at.IsZero() {
+		t.Errorf("result of ExpireAt(%s) not right, expect zero, got %v",
+			keyA, at)
+		t.Fail()
+	}
+	keys, err := db.ListKeys("group.nx", "", -1)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !reflect.DeepEqual(keys, []string{keyA, keyB}) {
+		t.Errorf("result of ListKeys() not right, expect %v, got %v",
+			[]string{keyA, keyB}, keys)
+		t.Fail()
+	}
+}
+
+func TestCompareAndSwap(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	keyA, keyB, keyNone := "group.cas.a", "group.cas.b", "group.cas.none"
+	err = db.SetMulti([]string{keyA, "1", keyB, "1"})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	cases := []struct {
+		key    string
+		old    string
+		new    string
+		opts   []kvdb.SetOption
+		expect bool
+	}{
+		{keyA, "0", "2", nil, false},
+		{keyA, "1", "2", nil, true},
+		{keyA, "1", "3", nil, false},
+		{keyA, "2", "2", nil, true},
+		{keyB, "1", "2", []kvdb.SetOption{kvdb.SetTTL(ExpireAfter)}, true},
+		{keyNone, "", "1", nil, false},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ok, err := db.CompareAndSwap(c.key, c.old, c.new, c.opts...)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if ok != c.expect {
+				t.Errorf("result of CompareAndSwap(%s) not right, expect %v, got %v",
+					c.key, c.expect, ok)
+				t.Fail()
+			}
+		})
+	}
+	rst, err := db.GetMulti([]string{keyA, keyB, keyNone})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	expect := map[string]string{keyA: "2", keyB: "2"}
+	if len(rst) != len(expect) {
+		t.Errorf("length of result not right, expect %d, got %d",
+			len(expect), len(rst))
+		t.Fail()
+	}
+	for k, v := range expect {
+		if rst[k].Value != v {
+			t.Errorf("result of %s not right, expect %s, got %s",
+				k, v, rst[k].Value)
+			t.Fail()
+		}
+	}
+
+	// expired key could not be swapped
+	time.Sleep(ExpireAfter * 2)
+	ok, err := db.CompareAndSwap(keyB, "2", "3")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if ok {
+		t.Errorf("result of CompareAndSwap(%s) not right, expect %v, got %v",
+			keyB, false, ok)
+		t.Fail()
+	}
+}
+
+func TestCommit(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	commit := func(txn *kvdb.Txn, expect bool) {
+		ok, err := db.Commit(txn)
+		if errors.Is(err, kvdb.ErrorTxnUnsupported) {
+			t.Skip(err)
+		}
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if ok != expect {
+			t.Errorf("result of Commit() not right, expect %v, got %v",
+				expect, ok)
+			t.Fail()
+		}
+	}
+	checkValues := func(expect map[string]string) {
+		keys := make([]string, 0, len(expect))
+		for k := range expect {
+			keys = append(keys, k)
+		}
+		rst, err := db.GetMulti(keys)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		for k, v := range expect {
+			node, ok := rst[k]
+			if v == "" && ok {
+				t.Errorf("result of %s not right, expect not exist, got %s",
+					k, node.Value)
+				t.Fail()
+			} else if v != "" && node.Value != v {
+				t.Errorf("result of %s not right, expect %s, got %v",
+					k, v, node.Value)
+				t.Fail()
+			}
+		}
+	}
+
+	keyA, keyC, keyD := "group.txn.a", "group.txn.c", "group.txn.d"
+	err = db.SetMulti([]string{
+		keyA, "1",
+		keyA + ".b1", "x",
+		keyA + ".b2", "y",
+		keyC, "3",
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	commit(nil, true)
+	commit(kvdb.NewTxn().If(kvdb.IfValue(keyA, "0")).Set(keyD, "4"), false)
+	commit(kvdb.NewTxn().If(kvdb.IfNotExist(keyA)).Delete(keyC), false)
+	checkValues(map[string]string{keyA: "1", keyC: "3", keyD: ""})
+
+	commit(kvdb.NewTxn().
+		If(kvdb.IfExist(keyA), kvdb.IfValue(keyC, "3"), kvdb.IfNotExist(keyD)).
+		Set(keyA, "2").
+		Set(keyA+".b3", "z").
+		Delete(keyA, kvdb.DeleteChildren()).
+		Set(keyA, "2").
+		Set(keyD, "4", kvdb.SetTTL(ExpireAfter)).
+		Delete(keyC), true)
+	checkValues(map[string]string{
+		keyA:         "2",
+		keyA + ".b1": "",
+		keyA + ".b2": "",
+		keyA + ".b3": "",
+		keyC:         "",
+		keyD:         "4",
+	})
+
+	// later operation on the same key wins
+	keyE, keyF := "group.txn.e", "group.txn.f"
+	commit(kvdb.NewTxn().
+		Delete(keyE).Set(keyE, "5").
+		Set(keyF, "6").Delete(keyF), true)
+	checkValues(map[string]string{keyE: "5", keyF: ""})
+
+	keyG := "group.txn.g"
+	err = db.SetMulti([]string{keyG, "7", keyG + ".h.i", "8"})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	commit(kvdb.NewTxn().
+		Set(keyG+".j.k", "9").
+		Delete(keyG, kvdb.DeleteDescendants()), true)
+	n, err := db.Count(keyG, kvdb.CountDescendants())
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if n != 0 {
+		t.Errorf("result of Count() not right, expect %d, got %d", 0, n)
+		t.Fail()
+	}
+	checkValues(map[string]string{keyG: "", keyG + ".h.i": ""})
+
+	// expired key is treated as not exist
+	time.Sleep(ExpireAfter * 2)
+	commit(kvdb.NewTxn().If(kvdb.IfExist(keyD)).Set(keyD, "0"), false)
+	commit(kvdb.NewTxn().If(kvdb.IfNotExist(keyD)).Set(keyD, "4"), true)
+	checkValues(map[string]string{keyD: "4"})
+
+	_, err = db.Commit(&kvdb.Txn{Ops: []kvdb.Op{{Key: keyD}}})
+	if !errors.Is(err, kvdb.ErrorInvalidTxn) {
+		t.Errorf("error not right, expect %v, got %v",
+			kvdb.ErrorInvalidTxn, err)
+		t.Fail()
+	}
+}
+
+func TestVersion(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	checkVersion := func(key string, version int64) {
+		rst, err := db.Get(key)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if version == 0 {
+			if rst != nil {
+				t.Errorf("result of Get(%s) not right, expect nil, got %v",
+					key, rst)
+				t.Fail()
+			}
+			return
+		}
+		if rst == nil || rst.Version != version {
+			t.Errorf("version of %s not right, expect %d, got %v",
+				key, version, rst)
+			t.Fail()
+		}
+	}
+	checkErr := func(err error, conflict *kvdb.ConflictError) {
+		var ce *kvdb.ConflictError
+		if conflict == nil && err != nil {
+			t.Error(err)
+			t.Fail()
+		} else if conflict != nil &&
+			(!errors.As(err, &ce) || *ce != *conflict) {
+			t.Errorf("error not right, expect %v, got %v", conflict, err)
+			t.Fail()
+		}
+	}
+
+	keyA, keyB, keyC := "group.ver.a", "group.ver.b", "group.ver.c"
+	checkVersion(keyA, 0)
+	checkErr(db.Set(keyA, "1"), nil)
+	checkVersion(keyA, 1)
+	checkErr(db.Set(keyA, "2"), nil)
+	checkVersion(keyA, 2)
+	checkErr(db.SetMulti([]string{keyA, "3", keyB, "1"}), nil)
+	checkErr(db.SetEntries([]kvdb.Entry{{Key: keyA, Value: "4"}}), nil)
+	rst, err := db.GetMulti([]string{keyA, keyB})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst[keyA].Version != 4 || rst[keyB].Version != 1 {
+		t.Errorf("result of GetMulti() not right, expect version %d and %d, got %v",
+			4, 1, rst)
+		t.Fail()
+	}
+
+	// expire time change is not a write of value
+	_, err = db.Touch(keyA, time.Minute)
+	checkErr(err, nil)
+	_, err = db.Persist(keyA)
+	checkErr(err, nil)
+	checkVersion(keyA, 4)
+
+	checkErr(db.Set(keyA, "5", kvdb.SetIfVersion(4)), nil)
+	checkVersion(keyA, 5)
+	checkErr(db.Set(keyA, "6", kvdb.SetIfVersion(4)),
+		&kvdb.ConflictError{Key: keyA, Version: 4})
+	checkErr(db.Set(keyA, "6", kvdb.SetIfVersion(0)),
+		&kvdb.ConflictError{Key: keyA, Version: 0})
+	checkErr(db.Set(keyC, "1", kvdb.SetIfVersion(1)),
+		&kvdb.ConflictError{Key: keyC, Version: 1})
+	checkVersion(keyC, 0)
+	checkErr(db.Set(keyC, "1", kvdb.SetIfVersion(0)), nil)
+	checkVersion(keyC, 1)
+	node, err := db.Get(keyA)
+	checkErr(err, nil)
+	if node == nil || node.Value != "5" {
+		t.Errorf("result of Get(%s) not right, expect %s, got %v",
+			keyA, "5", node)
+		t.Fail()
+	}
+
+	keyD := "group.ver.d"
+	_, err = db.SetNX(keyD, "1")
+	checkErr(err, nil)
+	checkVersion(keyD, 1)
+	_, err = db.CompareAndSwap(keyD, "1", "2")
+	checkErr(err, nil)
+	checkVersion(keyD, 2)
+	_, err = db.Commit(kvdb.NewTxn().Set(keyD, "3").Set(keyD, "4"))
+	if errors.Is(err, kvdb.ErrorTxnUnsupported) {
+		err = db.Set(keyD, "3")
+		checkErr(err, nil)
+		err = db.Set(keyD, "4")
+	}
+	checkErr(err, nil)
+	checkVersion(keyD, 4)
+
+	// version restarts after deleted or expired
+	checkErr(db.Delete(keyD), nil)
+	checkErr(db.Set(keyD, "1"), nil)
+	checkVersion(keyD, 1)
+	checkErr(db.Set(keyD, "2", kvdb.SetTTL(ExpireAfter)), nil)
+	checkVersion(keyD, 2)
+	time.Sleep(ExpireAfter * 2)
+	checkErr(db.Set(keyD, "1", kvdb.SetIfVersion(0)), nil)
+	checkVersion(keyD, 1)
+}
+
+func TestIncr(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	keyA, keyB, keyS := "group.incr.a", "group.incr.b", "group.incr.s"
+	keyC, keyMax, keyMin := "group.incr.c", "group.incr.max", "group.incr.min"
+	// keys are cleared since DB may be reused by repeated test runs
+	err = db.DeleteMulti([]string{keyA, keyB, keyS, keyC, keyMax, keyMin})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.SetMulti([]string{
+		keyMax, strconv.FormatInt(math.MaxInt64, 10),
+		keyMin, strconv.FormatInt(math.MinInt64, 10),
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set(keyB, "10", kvdb.SetTTL(ExpireAfter))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set(keyS, "s")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	cases := []struct {
+		key    string
+		delta  int64
+		expect int64
+		err    error
+	}{
+		{keyA, 1, 1, nil},
+		{keyA, 2, 3, nil},
+		{keyA, -5, -2, nil},
+		{keyB, 5, 15, nil},
+		{keyS, 1, 0, kvdb.ErrorNotInteger},
+		{keyMax, 1, 0, kvdb.ErrorOverflow},
+		{keyMax, -1, math.MaxInt64 - 1, nil},
+		{keyMin, -1, 0, kvdb.ErrorOverflow},
+		{keyMin, math.MaxInt64, -1, nil},
+		{keyMin, math.MinInt64, 0, kvdb.ErrorOverflow},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			rst, err := db.Incr(c.key, c.delta)
+			if !errors.Is(err, c.err) {
+				t.Errorf("error of Incr(%s) not right, expect %v, got %v",
+					c.key, c.err, err)
+				t.Fail()
+			}
+			if rst != c.expect {
+				t.Errorf("result of Incr(%s) not right, expect %d, got %d",
+					c.key, c.expect, rst)
+				t.Fail()
+			}
+		})
+	}
+	rst, err := db.GetMulti([]string{keyA, keyB, keyS, keyMax, keyMin})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	expect := map[string]kvdb.Node{
+		keyA:   {Value: "-2", Version: 3},
+		keyB:   {Value: "15", Version: 2},
+		keyS:   {Value: "s", Version: 1},
+		keyMax: {Value: strconv.FormatInt(math.MaxInt64-1, 10), Version: 2},
+		keyMin: {Value: "-1", Version: 2},
+	}
+	if !reflect.DeepEqual(rst, expect) {
+		t.Errorf("result of GetMulti() not right, expect %v, got %v",
+			expect, rst)
+		t.Fail()
+	}
+
+	// expire time of live key is kept
+	at, exist, err := db.ExpireAt(keyB)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !exist || at.IsZero() {
+		t.Errorf("expire time of %s not right, expect not zero, got %v",
+			keyB, at)
+		t.Fail()
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := db.Incr(keyC, 1); err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+			}()
+		}
+		wg.Wait()
+		rst, err := db.Get(keyC)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if rst == nil || rst.Value != "10" {
+			t.Errorf("result of Get(%s) not right, expect %s, got %v",
+				keyC, "10", rst)
+			t.Fail()
+		}
+	})
+
+	// expired key is treated as 0 and never expires
+	time.Sleep(ExpireAfter * 2)
+	n, err := db.Incr(keyB, 1)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if n != 1 {
+		t.Errorf("result of Incr(%s) not right, expect %d, got %d",
+			keyB, 1, n)
+		t.Fail()
+	}
+	at, exist, err = db.ExpireAt(keyB)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !exist || !at.IsZero() {
+		t.Errorf("expire time of %s not right, expect zero, got %v",
+			keyB, at)
+		t.Fail()
+	}
+}
+
+func TestBytes(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	bin := make([]byte, 256)
+	for i := range bin {
+		bin[i] = byte(i)
+	}
+	keyA, keyB, keyE := "group.bytes.a", "group.bytes.b", "group.bytes.e"
+	keyS, keyNone := "group.bytes.s", "group.bytes.none"
+	err = db.SetBytes(keyA, bin)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.SetBytes(keyB, bin, kvdb.SetTTL(ExpireAfter))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.SetBytes(keyE, []byte{})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set(keyS, "s")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	cases := []struct {
+		key    string
+		expect []byte
+	}{
+		{keyA, bin},
+		{keyB, bin},
+		{keyE, []byte{}},
+		{keyS, []byte("s")},
+		{keyNone, nil},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			rst, err := db.GetBytes(c.key)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if !reflect.DeepEqual(rst, c.expect) {
+				t.Errorf("result of GetBytes(%s) not right, expect %v, got %v",
+					c.key, c.expect, rst)
+				t.Fail()
+			}
+		})
+	}
+
+	// bytes are the same as string value
+	rst, err := db.Get(keyA)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != string(bin) {
+		t.Errorf("result of Get(%s) not right, expect %q, got %v",
+			keyA, bin, rst)
+		t.Fail()
+	}
+	ok, err := db.CompareAndSwap(keyA, string(bin), "a")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if !ok {
+		t.Errorf("result of CompareAndSwap(%s) not right, expect %v, got %v",
+			keyA, true, ok)
+		t.Fail()
+	}
+
+	time.Sleep(ExpireAfter * 2)
+	b, err := db.GetBytes(keyB)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if b != nil {
+		t.Errorf("result of GetBytes(%s) not right, expect nil, got %v",
+			keyB, b)
+		t.Fail()
+	}
+}
+
+func TestTyped(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	type item struct {
+		Name  string
+		Count int
+		Data  []byte
+	}
+	codecs := []kvdb.Codec{kvdb.JSONCodec, kvdb.MsgpackCodec, kvdb.GobCodec}
+	for i, codec := range codecs {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			typed := kvdb.NewTyped(db, codec)
+			parent := "group.typed." + strconv.Itoa(i)
+			keyA, keyB, keyE := parent+".a", parent+".b", parent+".e"
+			items := map[string]item{
+				parent: {Name: "parent"},
+				keyA:   {Name: "a", Count: 1, Data: []byte{0, 0xff}},
+				keyB:   {Name: "b", Count: 2},
+			}
+			for k, v := range items {
+				if err := typed.Set(k, v); err != nil {
+					t.Error(err)
+					t.Fail()
+				}
+			}
+			err := typed.Set(keyE, item{Name: "e"}, kvdb.SetTTL(ExpireAfter))
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+
+			var v item
+			ok, err := typed.Get(keyA, &v)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if !ok || !reflect.DeepEqual(v, items[keyA]) {
+				t.Errorf("result of Get(%s) not right, expect %v, got %v %v",
+					keyA, items[keyA], ok, v)
+				t.Fail()
+			}
+			ok, err = typed.Get(parent+".none", &v)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if ok {
+				t.Errorf("result of Get(%s) not right, expect %v, got %v",
+					parent+".none", false, ok)
+				t.Fail()
+			}
+
+			var m map[string]item
+			err = typed.GetMulti([]string{parent, keyA, parent + ".none"}, &m)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			expect := map[string]item{parent: items[parent], keyA: items[keyA]}
+			if !reflect.DeepEqual(m, expect) {
+				t.Errorf("result of GetMulti() not right, expect %v, got %v",
+					expect, m)
+				t.Fail()
+			}
+			err = typed.GetMulti([]string{keyA}, m)
+			if !errors.Is(err, kvdb.ErrorInvalidMap) {
+				t.Errorf("error of GetMulti() not right, expect %v, got %v",
+					kvdb.ErrorInvalidMap, err)
+				t.Fail()
+			}
+
+			time.Sleep(ExpireAfter * 2)
+			var children map[string]item
+			keys, err := typed.Children(parent, "", 10, &children)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if !reflect.DeepEqual(keys, []string{keyA, keyB}) {
+				t.Errorf("result of Children() not right, expect %v, got %v",
+					[]string{keyA, keyB}, keys)
+				t.Fail()
+			}
+			expect = map[string]item{keyA: items[keyA], keyB: items[keyB]}
+			if !reflect.DeepEqual(children, expect) {
+				t.Errorf("result of Children() not right, expect %v, got %v",
+					expect, children)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	keyA, keyB, keyC := "group.watch.a", "group.watch.a.b", "group.watch.c"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	all, err := db.WatchContext(ctx, "group.watch", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, err := db.WatchContext(ctx, keyB, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Set(keyA, "1")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set(keyB, "2", kvdb.SetTTL(ExpireAfter))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Set(keyC, "3")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	_, err = db.Incr(keyC, 1)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	time.Sleep(ExpireAfter * 2)
+	// nothing is reported for keys not exist
+	err = db.Delete("group.watch.none")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.DeleteMulti([]string{"group.watch.none", "group.watch.c.none"},
+		kvdb.DeleteDescendants())
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.Delete(keyA, kvdb.DeleteChildren())
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	cases := []struct {
+		ch     <-chan kvdb.Event
+		expect []kvdb.Event
+	}{
+		{all, []kvdb.Event{
+			{Type: kvdb.EventSet, Key: keyA, Value: "1"},
+			{Type: kvdb.EventSet, Key: keyB, Value: "2"},
+			{Type: kvdb.EventSet, Key: keyC, Value: "3"},
+			{Type: kvdb.EventSet, Key: keyC, Value: "4"},
+			{Type: kvdb.EventExpire, Key: keyB},
+			{Type: kvdb.EventDelete, Key: keyA, Children: true},
+		}},
+		{one, []kvdb.Event{
+			{Type: kvdb.EventSet, Key: keyB, Value: "2"},
+			{Type: kvdb.EventExpire, Key: keyB},
+			{Type: kvdb.EventDelete, Key: keyA, Children: true},
+		}},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			for j, expect := range c.expect {
+				select {
+				case e := <-c.ch:
+					if e != expect {
+						t.Errorf("event %d not right, expect %v, got %v",
+							j, expect, e)
+						t.Fail()
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("event %d not received", j)
+				}
+			}
+		})
+	}
+
+	cancel()
+	for i, c := range cases {
+		select {
+		case _, ok := <-c.ch:
+			if ok {
+				t.Errorf("channel %d not closed after context canceled", i)
+				t.Fail()
+			}
+		case <-time.After(time.Second):
+			t.Errorf("channel %d not closed after context canceled", i)
+			t.Fail()
+		}
+	}
+}
+
+func TestCount(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	err = db.SetMulti([]string{
+		"group.cnt", "1",
+		"group.cnt.child1", "2",
+		"group.cnt.child2", "3",
+		"group.cnt.child1.grandchild1", "4",
+		"group.cnt.child1.grandchild1.greatgrandchild1", "5",
+		"group.cnt.child4.grandchild2", "6", // parent absent
+		"group.cnt0.child1", "7", // sibling with same prefix
+	})
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	err = db.SetMulti([]string{
+		"group.cnt.child3", "8",
+		"group.cnt.child2.grandchild3", "9",
+	}, kvdb.SetExpire(time.Now().Add(-time.Second)))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	cases := []struct {
+		Key         string
+		Descendants bool
+		Count       int
+	}{
+		{"group.cnt", false, 2},
+		{"group.cnt", true, 5},
+		{"group.cnt.child1", false, 1},
+		{"group.cnt.child1", true, 2},
+		{"group.cnt.child4", false, 1},
+		{"group.cnt.child2", true, 0},
+		{"group.cntx", true, 0},
+	}
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var opts []kvdb.CountOption
+			if c.Descendants {
+				opts = append(opts, kvdb.CountDescendants())
+			}
+			count, err := db.Count(c.Key, opts...)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+			}
+			if count != c.Count {
+				t.Errorf("result of Count() not right, expect %v, got %v",
+					c.Count, count)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T, newDB func() (kvdb.KVDB, error)) {
+	db, err := newDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	key := "group.ctx"
+	err = db.SetContext(context.Background(), key, "1")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	rst, err := db.GetContext(context.Background(), key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != "1" {
+		t.Errorf("result not right, expect %s, got %v", "1", rst)
+		t.Fail()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = db.GetContext(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Errorf("err of GetContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if _, err = db.GetMultiContext(ctx, []string{key}); !errors.Is(err,
+		context.Canceled) {
+		t.Errorf("err of GetMultiContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if err = db.SetContext(ctx, key, "2"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err of SetContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if err = db.SetMultiContext(ctx, []string{key, "2"}); !errors.Is(err,
+		context.Canceled) {
+		t.Errorf("err of SetMultiContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if err = db.DeleteContext(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Errorf("err of DeleteContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if err = db.DeleteMultiContext(ctx, []string{key}); !errors.Is(err,
+		context.Canceled) {
+		t.Errorf("err of DeleteMultiContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if _, err = db.ExistContext(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Errorf("err of ExistContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+	if err = db.CleanupContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("err of CleanupContext() not right, expect %s, got %s",
+			context.Canceled, err)
+		t.Fail()
+	}
+
+	rst, err = db.Get(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if rst == nil || rst.Value != "1" {
+		t.Errorf("result not right, expect %s, got %v", "1", rst)
+		t.Fail()
+	}
 }
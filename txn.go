@@ -0,0 +1,104 @@
+package kvdb
+
+import "errors"
+
+var (
+	// ErrorTxnUnsupported is returned by `Commit()` if the DB could not commit
+	// operations atomically, such as MongoDB which is not a replica set.
+	ErrorTxnUnsupported = errors.New("transaction unsupported")
+	// ErrorInvalidTxn is returned by `Commit()` if type of any condition or
+	// operation of transaction is unknown.
+	ErrorInvalidTxn = errors.New("invalid transaction")
+)
+
+type CondType int
+
+const (
+	// CondExist requires key exists and not expired.
+	CondExist CondType = iota + 1
+	// CondNotExist requires key not exists or expired.
+	CondNotExist
+	// CondValue requires value of live key equals to the given value.
+	CondValue
+)
+
+// Cond is a precondition of transaction.
+type Cond struct {
+	Type  CondType `json:"type"`
+	Key   string   `json:"key"`
+	Value string   `json:"value,omitempty"`
+}
+
+// IfExist specify transaction commits only if key exists and not expired.
+func IfExist(key string) Cond {
+	return Cond{Type: CondExist, Key: key}
+}
+
+// IfNotExist specify transaction commits only if key not exists or expired.
+func IfNotExist(key string) Cond {
+	return Cond{Type: CondNotExist, Key: key}
+}
+
+// IfValue specify transaction commits only if value of live key is value.
+func IfValue(key, value string) Cond {
+	return Cond{Type: CondValue, Key: key, Value: value}
+}
+
+type OpType int
+
+const (
+	OpSet OpType = iota + 1
+	OpDelete
+)
+
+// Op is a set or delete operation of transaction.
+type Op struct {
+	Type    OpType  `json:"type"`
+	Key     string  `json:"key"`
+	Value   string  `json:"value,omitempty"`
+	Setter  Setter  `json:"setter"`
+	Deleter Deleter `json:"deleter"`
+}
+
+// Txn is a group of set and delete operations with preconditions, which is
+// committed atomically by `Commit()`. Operations are applied in order, so a
+// later operation on the same key wins.
+type Txn struct {
+	Conds []Cond `json:"conds,omitempty"`
+	Ops   []Op   `json:"ops,omitempty"`
+}
+
+// NewTxn returns an empty transaction, use `If()`, `Set()` and `Delete()` to
+// build it, for example:
+//
+//	txn := kvdb.NewTxn().If(kvdb.IfValue("a", "1")).
+//		Set("a", "2").Delete("b", kvdb.DeleteChildren())
+func NewTxn() *Txn {
+	return &Txn{}
+}
+
+// If add preconditions, transaction commits only if all of them hold.
+func (t *Txn) If(conds ...Cond) *Txn {
+	t.Conds = append(t.Conds, conds...)
+	return t
+}
+
+// Set add a set operation, options are the same as `Set()`.
+func (t *Txn) Set(key, value string, opts ...SetOption) *Txn {
+	op := Op{Type: OpSet, Key: key, Value: value}
+	for _, opt := range opts {
+		opt(&op.Setter)
+	}
+	t.Ops = append(t.Ops, op)
+	return t
+}
+
+// Delete add a delete operation, options are the same as `Delete()`.
+func (t *Txn) Delete(key string, opts ...DeleteOption) *Txn {
+	op := Op{Type: OpDelete, Key: key}
+	for _, opt := range opts {
+		opt(&op.Deleter)
+	}
+	t.Ops = append(t.Ops, op)
+	return t
+}
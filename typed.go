@@ -0,0 +1,165 @@
+package kvdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrorInvalidMap is returned by `Typed` if destination of multiple values is
+// not a pointer to map with string key.
+var ErrorInvalidMap = errors.New("invalid map, should be a pointer to map " +
+	"with string key")
+
+// Codec marshal typed value to bytes stored as value of key, and unmarshal it
+// back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+	GobCodec     Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Typed wraps a KVDB to set and get typed values marshaled by codec, so it
+// works with any backend and the service client.
+// Values are read by `GetBytes()` one by one, which is binary safe for every
+// codec over service, but reading multiple values is not atomic.
+type Typed struct {
+	db    KVDB
+	codec Codec
+}
+
+// NewTyped returns a typed wrapper of db, nil codec means JSONCodec.
+func NewTyped(db KVDB, codec Codec) *Typed {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &Typed{db: db, codec: codec}
+}
+
+// Get unmarshal value of key into v, which should be a pointer, and returns if
+// key exists. v is not touched if key not exists or expired.
+func (t *Typed) Get(key string, v interface{}) (bool, error) {
+	return t.GetContext(context.Background(), key, v)
+}
+
+// GetContext is the same as Get but with a context.
+func (t *Typed) GetContext(ctx context.Context, key string, v interface{},
+) (bool, error) {
+	data, err := t.db.GetBytesContext(ctx, key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, t.codec.Unmarshal(data, v)
+}
+
+// GetMulti unmarshal values of keys into m, which should be a pointer to map
+// with string key, such as *map[string]T. Keys not exist or expired are not
+// set in m, and m is allocated if it's nil.
+func (t *Typed) GetMulti(keys []string, m interface{}) error {
+	return t.GetMultiContext(context.Background(), keys, m)
+}
+
+// GetMultiContext is the same as GetMulti but with a context.
+func (t *Typed) GetMultiContext(ctx context.Context, keys []string,
+	m interface{}) error {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() ||
+		rv.Elem().Kind() != reflect.Map ||
+		rv.Elem().Type().Key().Kind() != reflect.String {
+		return ErrorInvalidMap
+	}
+	mv := rv.Elem()
+	if mv.IsNil() {
+		mv.Set(reflect.MakeMap(mv.Type()))
+	}
+	for _, key := range keys {
+		elem := reflect.New(mv.Type().Elem())
+		ok, err := t.GetContext(ctx, key, elem.Interface())
+		if err != nil {
+			return err
+		}
+		if ok {
+			mv.SetMapIndex(reflect.ValueOf(key).Convert(mv.Type().Key()),
+				elem.Elem())
+		}
+	}
+	return nil
+}
+
+// Children unmarshal values of live children of parent into m with
+// pagination, and returns keys of children in order. Start and limit are the
+// same as `ListKeys()`, and m is the same as `GetMulti()`.
+// Children expired after listed are not set in m.
+func (t *Typed) Children(parent, start string, limit int, m interface{},
+) ([]string, error) {
+	return t.ChildrenContext(context.Background(), parent, start, limit, m)
+}
+
+// ChildrenContext is the same as Children but with a context.
+func (t *Typed) ChildrenContext(ctx context.Context, parent, start string,
+	limit int, m interface{}) ([]string, error) {
+	keys, err := t.db.ListKeysContext(ctx, parent, start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return keys, t.GetMultiContext(ctx, keys, m)
+}
+
+// Set marshal v and set it as value of key, options are the same as `Set()`.
+func (t *Typed) Set(key string, v interface{}, opts ...SetOption) error {
+	return t.SetContext(context.Background(), key, v, opts...)
+}
+
+// SetContext is the same as Set but with a context.
+func (t *Typed) SetContext(ctx context.Context, key string, v interface{},
+	opts ...SetOption) error {
+	data, err := t.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.db.SetBytesContext(ctx, key, data, opts...)
+}
@@ -0,0 +1,30 @@
+package kvdb
+
+// EventType is type of change of key reported by `Watch()`.
+type EventType int
+
+const (
+	// EventSet is reported when value of key is set.
+	EventSet EventType = iota + 1
+	// EventDelete is reported when key is deleted.
+	EventDelete
+	// EventExpire is reported when key expires.
+	EventExpire
+	// EventOverflow is reported as the last event before channel is closed,
+	// if receiver falls too far behind and later events are dropped. Receiver
+	// should read key again and watch it again.
+	EventOverflow
+)
+
+// Event is a change of key reported by `Watch()`.
+type Event struct {
+	Type EventType `json:"type"`
+	Key  string    `json:"key"`
+	// Value is the new value of key, only for EventSet.
+	Value string `json:"value,omitempty"`
+	// Children and Descendants are true if children or descendants of key are
+	// deleted along with it, only for EventDelete. Such event is also reported
+	// to watchers of the deleted children or descendants.
+	Children    bool `json:"children,omitempty"`
+	Descendants bool `json:"descendants,omitempty"`
+}